@@ -0,0 +1,146 @@
+package supervisor
+
+import (
+  "bytes"
+  "context"
+  "fmt"
+  "github.com/MarconiProtocol/cli/core/processes"
+  "github.com/MarconiProtocol/cli/core/supervisor"
+  "github.com/gorilla/rpc/v2/json2"
+  "io"
+  "io/ioutil"
+  "net"
+  "net/http"
+  "net/url"
+  "strconv"
+)
+
+// the host is ignored, requests are sent over the unix socket
+const SUPERVISOR_URL = "http://supervisor"
+
+/*
+  Client of the supervisor control socket
+*/
+type Client struct {
+  socketPath string
+  httpClient *http.Client
+}
+
+func NewClient(baseDir string) *Client {
+  socketPath := supervisor.GetSocketPath(baseDir)
+  return &Client{
+    socketPath: socketPath,
+    httpClient: &http.Client{
+      Transport: &http.Transport{
+        DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+          var dialer net.Dialer
+          return dialer.DialContext(ctx, "unix", socketPath)
+        },
+      },
+    },
+  }
+}
+
+/*
+  Returns whether a supervisor is listening on the control socket
+*/
+func (c *Client) IsRunning() bool {
+  conn, err := net.DialTimeout("unix", c.socketPath, supervisor.SOCKET_DIAL_TIMEOUT)
+  if err != nil {
+    return false
+  }
+  conn.Close()
+  return true
+}
+
+func (c *Client) call(method string, args interface{}, reply interface{}) error {
+  message, err := json2.EncodeClientRequest(method, args)
+  if err != nil {
+    return err
+  }
+
+  resp, err := c.httpClient.Post(SUPERVISOR_URL+supervisor.RPC_PATH, "application/json", bytes.NewReader(message))
+  if err != nil {
+    return err
+  }
+  defer resp.Body.Close()
+
+  return json2.DecodeClientResponse(resp.Body, reply)
+}
+
+/*
+  Start processes in the supervisor, the processes are supervised whether background is set or not
+*/
+func (c *Client) StartProcesses(ids []string, background bool) error {
+  return c.call("ProcessService.StartRPC", &supervisor.StartArgs{Ids: ids}, &supervisor.EmptyReply{})
+}
+
+func (c *Client) KillProcess(id string) error {
+  return c.call("ProcessService.StopRPC", &supervisor.ProcessArgs{Id: id}, &supervisor.EmptyReply{})
+}
+
+func (c *Client) RestartProcess(id string, background bool) error {
+  return c.call("ProcessService.RestartRPC", &supervisor.ProcessArgs{Id: id}, &supervisor.EmptyReply{})
+}
+
+func (c *Client) GetProcessRunningMap() (map[string]processes.ProcessStatus, error) {
+  reply := supervisor.ListReply{}
+  err := c.call("ProcessService.ListRPC", &supervisor.EmptyArgs{}, &reply)
+  return reply.Statuses, err
+}
+
+func (c *Client) GetProcessUsage() ([]processes.ProcessUsage, error) {
+  reply := supervisor.StatusReply{}
+  err := c.call("ProcessService.StatusRPC", &supervisor.EmptyArgs{}, &reply)
+  return reply.Usages, err
+}
+
+/*
+  Writes the lines of the process log matching the options to out, if follow is set lines are
+  streamed as they are logged until stop is closed
+*/
+func (c *Client) Logs(id string, options processes.LogOptions, follow bool, out io.Writer, stop <-chan struct{}) error {
+  query := url.Values{}
+  query.Set("id", id)
+  query.Set("lines", strconv.Itoa(options.Lines))
+  if options.Pattern != nil {
+    query.Set("grep", options.Pattern.String())
+  }
+  if !options.Since.IsZero() {
+    query.Set("since", strconv.FormatInt(options.Since.Unix(), 10))
+  }
+  query.Set("follow", strconv.FormatBool(follow))
+
+  ctx, cancel := context.WithCancel(context.Background())
+  defer cancel()
+  if stop != nil {
+    go func() {
+      select {
+      case <-stop:
+        cancel()
+      case <-ctx.Done():
+      }
+    }()
+  }
+
+  request, err := http.NewRequest("GET", SUPERVISOR_URL+supervisor.LOGS_PATH+"?"+query.Encode(), nil)
+  if err != nil {
+    return err
+  }
+  resp, err := c.httpClient.Do(request.WithContext(ctx))
+  if err != nil {
+    return err
+  }
+  defer resp.Body.Close()
+
+  if resp.StatusCode != http.StatusOK {
+    message, _ := ioutil.ReadAll(resp.Body)
+    return fmt.Errorf("%s", bytes.TrimSpace(message))
+  }
+  _, err = io.Copy(out, resp.Body)
+  if ctx.Err() != nil {
+    // stopped by the caller
+    return nil
+  }
+  return err
+}
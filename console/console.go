@@ -6,6 +6,7 @@ import (
   "github.com/MarconiProtocol/cli/console/context"
   "github.com/MarconiProtocol/cli/console/modes/credentials"
   "github.com/MarconiProtocol/cli/console/modes/marconi_net"
+  "github.com/MarconiProtocol/cli/console/modes/package_manager"
   "github.com/MarconiProtocol/cli/console/modes/process"
   "github.com/MarconiProtocol/cli/console/modes/root"
   "github.com/MarconiProtocol/cli/console/util"
@@ -35,6 +36,7 @@ func Init() {
   Simple REPL that loops until the user exits
 */
 func LaunchREPL(sig chan Exit, runConsole bool, readCommandsFromStdin bool) {
+  go watchProcessEvents()
 
   // Grab input commands from stdin if required
   var inputs_from_stdin []string
@@ -101,6 +103,7 @@ func initializeContext() {
   contxt.RegisterMode(credentials.NewCredsMode(contxt), "Credential Mode")
   contxt.RegisterMode(marconi_net.NewMarconiNetMode(contxt), "Marconi Net Mode")
   contxt.RegisterMode(process.NewProcessMode(contxt), "Process Mode")
+  contxt.RegisterMode(package_manager.NewPackageMode(contxt), "Package Mode")
 
   contxt.RegisterMode(root.NewRootMode(contxt), "Home")
 }
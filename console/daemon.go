@@ -35,3 +35,11 @@ func getProcessMode() mode_interface.Mode {
   processMode, _ := contxt.SelectMode("process")
   return processMode
 }
+
+/*
+  Send a "logs" command to the process mode
+*/
+func ShowProcessLogs(processName string, logArgs []string) {
+  processMode := getProcessMode()
+  processMode.HandleSelection(processMode, process_commands.LOGS, append([]string{processName}, logArgs...))
+}
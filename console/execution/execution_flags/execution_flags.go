@@ -4,24 +4,33 @@ const (
   PATH                     = "--path"
   PASSWORD                 = "--password"
   PASSWORD_FILE            = "--password-file"
+  KEYSTORE_PASSWORD        = "--keystore-password"
+  KEYSTORE_PASSWORD_FILE   = "--keystore-password-file"
   NODE_KEY                 = "--node-key"
   SKIP_PROMPT_USE_DEFAULTS = "--skip-prompts"
+  MNEMONIC                 = "--mnemonic"
 )
 
 var execFlagsMap = map[string]string{
   PATH:                     "''",
   PASSWORD:                 "''",
   PASSWORD_FILE:            "''",
+  KEYSTORE_PASSWORD:        "''",
+  KEYSTORE_PASSWORD_FILE:   "''",
   NODE_KEY:                 "0",
   SKIP_PROMPT_USE_DEFAULTS: "''",
+  MNEMONIC:                 "''",
 }
 
 type ExecFlags struct {
-  path         string
-  password     string
-  passwordFile string
-  nodeKey      string
-  skipPrompts  bool
+  path                 string
+  password             string
+  passwordFile         string
+  keystorePassword     string
+  keystorePasswordFile string
+  nodeKey              string
+  skipPrompts          bool
+  mnemonic             bool
 }
 
 func NewExecFlags(args []string) *ExecFlags {
@@ -44,10 +53,16 @@ func (ef *ExecFlags) setFlagValue(flag string, value string) {
     ef.password = value
   case PASSWORD_FILE:
     ef.passwordFile = value
+  case KEYSTORE_PASSWORD:
+    ef.keystorePassword = value
+  case KEYSTORE_PASSWORD_FILE:
+    ef.keystorePasswordFile = value
   case NODE_KEY:
     ef.nodeKey = value
   case SKIP_PROMPT_USE_DEFAULTS:
     ef.skipPrompts = true
+  case MNEMONIC:
+    ef.mnemonic = true
   }
 }
 
@@ -66,6 +81,10 @@ func (ef *ExecFlags) CheckSkipPromptsFlagSet() bool {
   return ef.skipPrompts != false
 }
 
+func (ef *ExecFlags) CheckMnemonicFlagSet() bool {
+  return ef.mnemonic
+}
+
 func (ef *ExecFlags) CheckPathFlagSet() bool {
   return ef.path != ""
 }
@@ -90,6 +109,22 @@ func (ef *ExecFlags) GetPasswordFile() string {
   return ef.passwordFile
 }
 
+func (ef *ExecFlags) CheckKeystorePasswordFlagSet() bool {
+  return ef.keystorePassword != ""
+}
+
+func (ef *ExecFlags) GetKeystorePassword() string {
+  return ef.keystorePassword
+}
+
+func (ef *ExecFlags) CheckKeystorePasswordFileFlagSet() bool {
+  return ef.keystorePasswordFile != ""
+}
+
+func (ef *ExecFlags) GetKeystorePasswordFile() string {
+  return ef.keystorePasswordFile
+}
+
 func (ef *ExecFlags) CheckNodeKeyFlagSet() bool {
   return ef.nodeKey != ""
 }
@@ -30,6 +30,8 @@ const (
   GET_TRANSACTION_RECEIPT = "receipt"
   EXPORT_GMRC_KEY         = "export"
   USE_ACCOUNT             = "use"
+  IMPORT_ACCOUNT          = "import"
+  RECOVER_ACCOUNT         = "recover"
 )
 
 const (
@@ -47,6 +49,8 @@ var ACCOUNT_COMMAND_MAP = map[string]func([]string){
   GET_TRANSACTION_RECEIPT: GetTransactionReceipt,
   EXPORT_GMRC_KEY:         ExportGMrcKey,
   USE_ACCOUNT:             UseUserAddress,
+  IMPORT_ACCOUNT:          ImportAccount,
+  RECOVER_ACCOUNT:         RecoverAccount,
 }
 
 func HandleAccountCommand(args []string) {
@@ -64,34 +68,136 @@ func HandleAccountCommand(args []string) {
 }
 
 func CreateAccount(args []string) {
-  if !modes.ArgsLenCheckWithOptional(args, 0, 2) {
-    fmt.Println("Usage:", CREATE_ACCOUNT, "[Optional:", execution_flags.PASSWORD, "<password> |", execution_flags.PASSWORD_FILE, "<password file> ]")
+  if !modes.ArgsLenCheckWithOptionalRange(args, 0, 1, 4) {
+    fmt.Println("Usage:", CREATE_ACCOUNT, "[Optional:", execution_flags.PASSWORD, "<password> |", execution_flags.PASSWORD_FILE, "<password file> ] [Optional:", execution_flags.MNEMONIC, "]")
     return
   }
 
   executionFlags := execution_flags.NewExecFlags(args)
+  // the recovery phrase has to be confirmed, it is never only printed
+  if executionFlags.CheckMnemonicFlagSet() && executionFlags.CheckSkipPromptsFlagSet() {
+    fmt.Println(execution_flags.MNEMONIC, "can't be combined with", execution_flags.SKIP_PROMPT_USE_DEFAULTS+", the recovery phrase has to be confirmed")
+    return
+  }
 
-  var password string
+  password, ok := getNewAccountPassword(executionFlags)
+  if !ok {
+    return
+  }
+
+  var marconiAccount *mkey.MarconiAccount
   var err error
-  for {
+  if executionFlags.CheckMnemonicFlagSet() {
+    mnemonic, ok := getNewMnemonic(executionFlags)
+    if !ok {
+      return
+    }
+    marconiAccount, err = mkey.CreateAccountFromMnemonic(mnemonic, password)
+  } else {
+    marconiAccount, err = mkey.CreateAccount(password)
+  }
+  if err != nil {
+    fmt.Println("Error creating an account", err)
+    return
+  }
+  key, err := marconiAccount.GetGoMarconiKey(password)
+  if err != nil {
+    fmt.Println("Error fetching Marconi Key from account", err)
+    return
+  }
+  fmt.Printf("Address:\n")
+  fmt.Printf("%s\n", key.Address.String())
+
+  // check if exportKey argument is provided, default is exportKey = true
+  exportKey := true
+  if modes.ArgsLenCheck(args, 1) {
+    value, err := strconv.ParseBool(args[0])
+    if err == nil {
+      exportKey = value
+    }
+  }
+  setUpAccount(key.Address.String(), exportKey)
+}
+
+/*
+  Imports a geth V3 keystore or a hex encoded private key from a file as a new account, encrypted with a new password
+*/
+func ImportAccount(args []string) {
+  if !modes.ArgsLenCheckWithOptionalRange(args, 1, 2, 4) {
+    fmt.Println("Usage:", IMPORT_ACCOUNT, "<key file> [Optional:", execution_flags.PASSWORD, "<password> |", execution_flags.PASSWORD_FILE, "<password file> ] [Optional:", execution_flags.KEYSTORE_PASSWORD, "<keystore password> |", execution_flags.KEYSTORE_PASSWORD_FILE, "<keystore password file> ]")
+    return
+  }
+
+  executionFlags := execution_flags.NewExecFlags(args)
+
+  keyMaterial, err := ioutil.ReadFile(args[0])
+  if err != nil {
+    fmt.Println("Failed to read the key file", err)
+    return
+  }
+  // only a keystore is encrypted, a hex encoded private key is imported as it is
+  keystorePassword := ""
+  if mkey.IsKeystoreJSON(keyMaterial) {
     var cancelled bool
-    password, cancelled, err = getPassword("Please enter a password for this account", executionFlags)
+    keystorePassword, cancelled, err = getKeystorePassword("Please enter the password of the keystore", executionFlags)
     if cancelled || err != nil {
       return
     }
-    passwordConfirm, cancelled, err := getPassword("Please confirm the password", executionFlags)
-    if cancelled || err != nil {
+  }
+
+  password, ok := getNewAccountPassword(executionFlags)
+  if !ok {
+    return
+  }
+
+  marconiAccount, err := mkey.ImportAccount(keyMaterial, keystorePassword, password)
+  if err != nil {
+    fmt.Println("Error importing the account", err)
+    return
+  }
+  key, err := marconiAccount.GetGoMarconiKey(password)
+  if err != nil {
+    fmt.Println("Error fetching Marconi Key from account", err)
+    return
+  }
+  fmt.Printf("Address:\n")
+  fmt.Printf("%s\n", key.Address.String())
+
+  setUpAccount(key.Address.String(), true)
+}
+
+/*
+  Recovers an account from the recovery phrase shown by account create --mnemonic
+*/
+func RecoverAccount(args []string) {
+  if !modes.ArgsLenCheckWithOptional(args, 0, 2) {
+    fmt.Println("Usage:", RECOVER_ACCOUNT, "[Optional:", execution_flags.PASSWORD, "<password> |", execution_flags.PASSWORD_FILE, "<password file> ]")
+    return
+  }
+
+  executionFlags := execution_flags.NewExecFlags(args)
+
+  var mnemonic string
+  for {
+    input, cancelled, _ := promptPassword("Please enter the recovery phrase of the account")
+    if cancelled {
       return
     }
-    if password == passwordConfirm {
+    var err error
+    if mnemonic, err = mkey.NormalizeMnemonic(input); err == nil {
       break
     }
-    fmt.Println("Passwords did not match, please try again")
+    fmt.Println(err, "please try again")
   }
 
-  marconiAccount, err := mkey.CreateAccount(password)
+  password, ok := getNewAccountPassword(executionFlags)
+  if !ok {
+    return
+  }
+
+  marconiAccount, err := mkey.CreateAccountFromMnemonic(mnemonic, password)
   if err != nil {
-    fmt.Println("Error creating an account", err)
+    fmt.Println("Error recovering the account", err)
     return
   }
   key, err := marconiAccount.GetGoMarconiKey(password)
@@ -102,6 +208,60 @@ func CreateAccount(args []string) {
   fmt.Printf("Address:\n")
   fmt.Printf("%s\n", key.Address.String())
 
+  setUpAccount(key.Address.String(), true)
+}
+
+/*
+  Generates the recovery phrase of a new account and shows it once, the account is only created once the phrase is
+  entered again
+*/
+func getNewMnemonic(executionFlags *execution_flags.ExecFlags) (string, bool) {
+  mnemonic, err := mkey.NewMnemonic()
+  if err != nil {
+    fmt.Println("Error generating a recovery phrase", err)
+    return "", false
+  }
+  fmt.Println("\nRecovery phrase:")
+  fmt.Println(mnemonic)
+  fmt.Println("\nWrite down the recovery phrase and keep it safe, it is the only way to recover the account if its key file is lost.")
+  fmt.Println("Anyone with the recovery phrase controls the account, and it won't be shown again.")
+  for {
+    input, cancelled, _ := promptPassword("Please enter the recovery phrase to confirm it was written down")
+    if cancelled {
+      fmt.Println("Cancelled, the account was not created")
+      return "", false
+    }
+    if confirmed, err := mkey.NormalizeMnemonic(input); err == nil && confirmed == mnemonic {
+      return mnemonic, true
+    }
+    fmt.Println("The recovery phrase did not match, please try again")
+  }
+}
+
+/*
+  Asks for the password of a new account until it is confirmed, unless it is given with the password flags
+*/
+func getNewAccountPassword(executionFlags *execution_flags.ExecFlags) (string, bool) {
+  for {
+    password, cancelled, err := getPassword("Please enter a password for this account", executionFlags)
+    if cancelled || err != nil {
+      return "", false
+    }
+    passwordConfirm, cancelled, err := getPassword("Please confirm the password", executionFlags)
+    if cancelled || err != nil {
+      return "", false
+    }
+    if password == passwordConfirm {
+      return password, true
+    }
+    fmt.Println("Passwords did not match, please try again")
+  }
+}
+
+/*
+  Makes a new account the user address of the middleware if it has none yet, and exports its keystore to gmeth
+*/
+func setUpAccount(address string, exportKey bool) {
   // generate default middleware conf if it does not already exist
   confPath := configs.GetFullPath(MIDDLEWARE_CONF_CHILD_PATH)
   _, errConfig := os.Stat(confPath)
@@ -126,7 +286,7 @@ func CreateAccount(args []string) {
     var obj jsonObject
     err := json.Unmarshal(data, &obj)
     if err == nil && strings.Compare(obj["meth"].(jsonObject)["UserAddress"].(string), EMPTY_USER_ADDRESS) == 0 {
-      obj["meth"].(jsonObject)["UserAddress"] = key.Address.String()
+      obj["meth"].(jsonObject)["UserAddress"] = address
       newJson, err := json.Marshal(obj)
       if err == nil {
         var prettyJson bytes.Buffer
@@ -134,7 +294,7 @@ func CreateAccount(args []string) {
         if err == nil {
           err = ioutil.WriteFile(confPath, prettyJson.Bytes(), 0644)
           if err == nil {
-            //fmt.Println("Updated user_conf.json with Account Address", key.Address.String())
+            //fmt.Println("Updated user_conf.json with Account Address", address)
           }
         } else {
           fmt.Println("Failed to write new json to user_conf.json", err)
@@ -147,16 +307,8 @@ func CreateAccount(args []string) {
     fmt.Println("Failed to read user_conf.json", err)
   }
 
-  // check if exportKey argument is provided, default is exportKey = true
-  exportKey := true
-  if modes.ArgsLenCheck(args, 1) {
-    value, err := strconv.ParseBool(args[0])
-    if err == nil {
-      exportKey = value
-    }
-  }
   if exportKey {
-    keystore, err := mkey.GetAccountForAddress(key.Address.String())
+    keystore, err := mkey.GetAccountForAddress(address)
     if err != nil {
       fmt.Println(err)
       return
@@ -61,6 +61,32 @@ func getPassword(outputPrompt string, ef *execution_flags.ExecFlags) (string, bo
   }
 
   // If not continue with usual prompt
+  return promptPassword(outputPrompt)
+}
+
+/*
+  Gets the password of a keystore that is imported, from the keystore password flags or by asking for it
+*/
+func getKeystorePassword(outputPrompt string, ef *execution_flags.ExecFlags) (string, bool, error) {
+  if ef.CheckKeystorePasswordFileFlagSet() {
+    data, err := ioutil.ReadFile(ef.GetKeystorePasswordFile())
+    if err != nil {
+      fmt.Println(err)
+      return "", true, err
+    }
+    return strings.TrimSpace(string(data)), false, nil
+  }
+  if ef.CheckKeystorePasswordFlagSet() {
+    password := ef.GetKeystorePassword()
+    if password == "''" {
+      password = ""
+    }
+    return password, false, nil
+  }
+  return promptPassword(outputPrompt)
+}
+
+func promptPassword(outputPrompt string) (string, bool, error) {
   fmt.Print(outputPrompt, ": ")
 
   earlyExit := make(chan struct{}, 1)
@@ -71,9 +97,9 @@ func getPassword(outputPrompt string, ef *execution_flags.ExecFlags) (string, bo
     earlyExit <- struct{}{}
   }
 
-  password = prompt.Input("", modes.PasswordCompleter,
+  password := prompt.Input("", modes.PasswordCompleter,
     prompt.OptionHiddenInput(),
     prompt.OptionAddKeyBind(prompt.KeyBind{Key: prompt.ControlC, Fn: cancel}),
     prompt.OptionSetEarlyExit(earlyExit))
-  return password, cancelled, err
+  return password, cancelled, nil
 }
@@ -6,6 +6,7 @@ import (
   "github.com/MarconiProtocol/cli/console/modes"
   "github.com/MarconiProtocol/cli/core/mkey"
   "github.com/MarconiProtocol/go-prompt"
+  "io/ioutil"
   "strconv"
 )
 
@@ -15,6 +16,7 @@ const (
   GENERATE_MP_KEY   = "generate"
   EXPORT_MP_KEY     = "export"
   LIST_MPKEY_HASHES = "list"
+  IMPORT_MP_KEY     = "import"
   CANCEL            = "cancel"
 )
 
@@ -23,6 +25,7 @@ var KEY_COMMAND_MAP = map[string]func([]string){
   GENERATE_MP_KEY:   GenerateMPKey,
   EXPORT_MP_KEY:     ExportMPKey,
   LIST_MPKEY_HASHES: ListMPKeyHashes,
+  IMPORT_MP_KEY:     ImportMPKey,
 }
 
 func HandleKeyCommand(args []string) {
@@ -91,6 +94,66 @@ func GenerateMPKey(args []string) {
   }
 }
 
+/*
+  Imports a PEM encoded RSA private key from a file as a nodekey of the account, and uses it
+*/
+func ImportMPKey(args []string) {
+  if !modes.ArgsLenCheckWithOptional(args, 2, 2) {
+    fmt.Println("Usage:", IMPORT_MP_KEY, "<0xACCOUNT_ADDRESS> <key file> [Optional:", execution_flags.PASSWORD, "<password> |", execution_flags.PASSWORD_FILE, "<password file> ]")
+    return
+  }
+  if !modes.ArgAddressCheck(args[0]) {
+    return
+  }
+
+  executionFlags := execution_flags.NewExecFlags(args)
+
+  pemData, err := ioutil.ReadFile(args[1])
+  if err != nil {
+    fmt.Println("Failed to read the key file", err)
+    return
+  }
+
+  password, cancelled, err := getPassword("Please enter your account password", executionFlags)
+  if cancelled || err != nil {
+    return
+  }
+
+  keystore, err := mkey.GetAccountForAddress(args[0])
+  if err != nil {
+    fmt.Println(err)
+    return
+  }
+
+  // validate the password by decrypting the GoMarconi key, the imported key is encrypted with it
+  _, err = keystore.GetGoMarconiKey(password)
+  if err != nil {
+    fmt.Println("Failed to validate password:", err)
+    return
+  }
+
+  marconiKey, err := keystore.ImportMarconiKey(pemData, password)
+  if err != nil {
+    fmt.Println("Failed to import nodekey", err)
+    return
+  }
+  fmt.Println("nodeID:")
+  fmt.Println(mkey.AddPrefixPubKeyHash(marconiKey.PublicKeyHash))
+  err = keystore.ExportMarconiKeys(password)
+  if err != nil {
+    fmt.Println("Failed to export nodekeys", err)
+    return
+  }
+
+  // use the imported key
+  index := len(keystore.MarconiKeys) - 1
+  keyName := mkey.MARCONI_PRIVATE_KEY_FILENAME + strconv.Itoa(index)
+  err = keystore.UseMarconiKey(keyName, password)
+  if err != nil {
+    fmt.Println("Failed to use nodekey", keyName, err)
+  }
+}
+
 func UseMPKey(args []string) {
   if !modes.ArgsLenCheckWithOptionalRange(args, 1, 2, 5) {
     fmt.Println("Usage:", USE_MPKEY, "<0xACCOUNT_ADDRESS> [Optional:", execution_flags.PASSWORD, "<password> |", execution_flags.PASSWORD_FILE, "<password file> |", execution_flags.NODE_KEY, "<node key> (default 0) |", execution_flags.SKIP_PROMPT_USE_DEFAULTS, "]")
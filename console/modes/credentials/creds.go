@@ -52,11 +52,14 @@ func NewCredsMode(c *context.Context) *CredsMode {
   credsMode.RegisterSubCommand(credential_commands.ACCOUNT, credential_commands.GET_TRANSACTION_RECEIPT, credsMode.getGetTransactionReceiptSuggestions, credsMode.handleGetTransactionReceipt)
   credsMode.RegisterSubCommand(credential_commands.ACCOUNT, credential_commands.EXPORT_GMRC_KEY, credsMode.getExportGMrcKeySuggestions, credsMode.handleExportGMrcKey)
   credsMode.RegisterSubCommand(credential_commands.ACCOUNT, credential_commands.USE_ACCOUNT, credsMode.getUseUserAddressSuggestions, credsMode.handleUseUserAddress)
+  credsMode.RegisterSubCommand(credential_commands.ACCOUNT, credential_commands.IMPORT_ACCOUNT, credsMode.getImportAccountSuggestions, credsMode.handleImportAccount)
+  credsMode.RegisterSubCommand(credential_commands.ACCOUNT, credential_commands.RECOVER_ACCOUNT, credsMode.getRecoverAccountSuggestions, credsMode.handleRecoverAccount)
 
   credsMode.RegisterSubCommand(credential_commands.KEY, credential_commands.GENERATE_MP_KEY, credsMode.getGenerateMPKeySuggestions, credsMode.handleGenerateMPKey)
   credsMode.RegisterSubCommand(credential_commands.KEY, credential_commands.USE_MPKEY, credsMode.getUseMpkKeySuggestions, credsMode.handleUseMPKey)
   credsMode.RegisterSubCommand(credential_commands.KEY, credential_commands.EXPORT_MP_KEY, credsMode.getExportMPKeySuggestions, credsMode.handleExportMPKey)
   credsMode.RegisterSubCommand(credential_commands.KEY, credential_commands.LIST_MPKEY_HASHES, credsMode.getListMpkKeyHashesSuggestions, credsMode.handleListMPKeyHashes)
+  credsMode.RegisterSubCommand(credential_commands.KEY, credential_commands.IMPORT_MP_KEY, credsMode.getImportMPKeySuggestions, credsMode.handleImportMPKey)
 
   credsMode.RegisterCommand(modes.RETURN_TO_ROOT, credsMode.GetEmptySuggestions, credsMode.HandleReturnToRoot)
   credsMode.RegisterCommand(modes.EXIT_CMD, credsMode.GetEmptySuggestions, credsMode.HandleExitCommand)
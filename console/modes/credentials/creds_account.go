@@ -16,6 +16,8 @@ var METH_ACCOUNT_SUGGESTIONS = []prompt.Suggest{
   {Text: credential_commands.GET_TRANSACTION_RECEIPT, Description: "Get receipt for a transaction"},
   {Text: credential_commands.EXPORT_GMRC_KEY, Description: "Export Go Marconi Keystore associated with an account"},
   {Text: credential_commands.USE_ACCOUNT, Description: "Use account address"},
+  {Text: credential_commands.IMPORT_ACCOUNT, Description: "Import account from a keystore or a private key"},
+  {Text: credential_commands.RECOVER_ACCOUNT, Description: "Recover account from its recovery phrase"},
 }
 
 /*
@@ -25,6 +27,25 @@ func (mm *CredsMode) getCreateAccountSuggestions(line []string) []prompt.Suggest
   return []prompt.Suggest{}
 }
 
+/*
+  Show prompt suggestions for the import account command
+*/
+func (mm *CredsMode) getImportAccountSuggestions(line []string) []prompt.Suggest {
+  switch {
+  case len(line) == 2:
+    return []prompt.Suggest{{Text: "<key file>", Description: "A geth V3 keystore or a hex encoded private key"}}
+  default:
+    return []prompt.Suggest{}
+  }
+}
+
+/*
+  Show prompt suggestions for the recover account command
+*/
+func (mm *CredsMode) getRecoverAccountSuggestions(line []string) []prompt.Suggest {
+  return []prompt.Suggest{}
+}
+
 /*
   Show prompt suggestions for the unlock account command
 */
@@ -52,6 +73,22 @@ func (mm *CredsMode) handleCreateAccount(args []string) {
   credential_commands.CreateAccount(args)
 }
 
+/*
+  Handle the import account command
+*/
+func (mm *CredsMode) handleImportAccount(args []string) {
+  util.Logger.Info(credential_commands.ACCOUNT+" "+credential_commands.IMPORT_ACCOUNT, util.ArgsToString(args))
+  credential_commands.ImportAccount(args)
+}
+
+/*
+  Handle the recover account command
+*/
+func (mm *CredsMode) handleRecoverAccount(args []string) {
+  util.Logger.Info(credential_commands.ACCOUNT+" "+credential_commands.RECOVER_ACCOUNT, util.ArgsToString(args))
+  credential_commands.RecoverAccount(args)
+}
+
 /*
   Handle the unlock account command
 */
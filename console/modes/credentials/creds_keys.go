@@ -12,6 +12,7 @@ var METH_KEY_SUGGESTIONS = []prompt.Suggest{
   {Text: credential_commands.USE_MPKEY, Description: "Set nodekey to use with other commands"},
   {Text: credential_commands.EXPORT_MP_KEY, Description: "Export nodekey"},
   {Text: credential_commands.LIST_MPKEY_HASHES, Description: "List nodekeys"},
+  {Text: credential_commands.IMPORT_MP_KEY, Description: "Import an RSA private key as a nodekey"},
 }
 
 /*
@@ -26,6 +27,20 @@ func (mm *CredsMode) getGenerateMPKeySuggestions(line []string) []prompt.Suggest
   }
 }
 
+/*
+  Show prompt suggestions for import Marconi Node Private key command
+*/
+func (mm *CredsMode) getImportMPKeySuggestions(line []string) []prompt.Suggest {
+  switch {
+  case len(line) == 2:
+    return []prompt.Suggest{{Text: "<0xACCOUNT_ADDRESS>", Description: "The GoMarconi account you wish to import the nodekey into"}}
+  case len(line) == 3:
+    return []prompt.Suggest{{Text: "<key file>", Description: "A PEM encoded RSA private key"}}
+  default:
+    return []prompt.Suggest{}
+  }
+}
+
 /*
   Show prompt suggestions for export Marconi Node Private key command
 */
@@ -98,6 +113,14 @@ func (mm *CredsMode) handleGenerateMPKey(args []string) {
   credential_commands.GenerateMPKey(args)
 }
 
+/*
+  Handle the import Marconi Node Private key command
+*/
+func (mm *CredsMode) handleImportMPKey(args []string) {
+  util.Logger.Info(credential_commands.KEY+" "+credential_commands.IMPORT_MP_KEY, util.ArgsToString(args))
+  credential_commands.ImportMPKey(args)
+}
+
 /*
   Handle the export Marconi Node Private keys command
 */
@@ -43,7 +43,7 @@ var COMMAND_MAP = map[string]func([]string){
 
 func checkMiddlewareRunning() bool {
   statuses := processes.Instance().GetProcessRunningMap()
-  if !statuses[processes.MIDDLEWARE_ID] {
+  if !statuses[processes.MIDDLEWARE_ID].Running {
     fmt.Println("Middleware is currently not running")
     return false
   }
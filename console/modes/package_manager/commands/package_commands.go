@@ -0,0 +1,306 @@
+package package_manager_commands
+
+import (
+  "flag"
+  "fmt"
+  "github.com/MarconiProtocol/cli/console/modes"
+  "github.com/MarconiProtocol/cli/console/modes/process/commands"
+  "github.com/MarconiProtocol/cli/console/util"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "github.com/MarconiProtocol/cli/core/packages"
+  "github.com/MarconiProtocol/cli/core/processes"
+  "os"
+)
+
+// Commands
+const (
+  LIST        = "list"
+  CHECK       = "check"
+  UPDATE      = "update"
+  ROLLBACK    = "rollback"
+  PIN         = "pin"
+  UNPIN       = "unpin"
+  AUTO_UPDATE = "auto-update"
+  BUNDLE      = "bundle"
+
+  AUTO_UPDATE_ON  = "on"
+  AUTO_UPDATE_OFF = "off"
+)
+
+var COMMAND_MAP = map[string]func([]string){
+  LIST:        ListPackages,
+  CHECK:       CheckPackages,
+  UPDATE:      UpdatePackage,
+  ROLLBACK:    RollbackPackage,
+  PIN:         PinPackage,
+  UNPIN:       UnpinPackage,
+  AUTO_UPDATE: SetAutoUpdate,
+  BUNDLE:      BundlePackages,
+}
+
+/*
+  Returns the config of the package with the id, from packages_conf.json
+*/
+func GetPackageConfig(id string) (configs.PackageConfig, bool) {
+  for _, config := range configs.LoadPackagesConf().Packages {
+    if config.Id == id {
+      return config, true
+    }
+  }
+  return configs.PackageConfig{}, false
+}
+
+/*
+  List the installed, previous and pinned versions of the packages, read from their version files, and their channels
+*/
+func ListPackages(args []string) {
+  packagesConfig := configs.LoadPackagesConf()
+  fmt.Printf("%-15s %-12s %-12s %-12s %s\n", "PACKAGE", "INSTALLED", "PREVIOUS", "PINNED", "CHANNEL")
+  for _, status := range packages.Instance().GetPackageStatuses(configs.GetBaseDir(), packagesConfig) {
+    fmt.Printf("%-15s %-12s %-12s %-12s %s\n", status.Id, orDash(status.InstalledVersion), orDash(status.PreviousVersion), orDash(status.PinnedVersion), status.Channel)
+    if status.Error != nil {
+      fmt.Println("  Error:", status.Error)
+    }
+  }
+  fmt.Println("Auto-update:", getAutoUpdateString(packagesConfig.AutoUpdateEnabled))
+}
+
+/*
+  Check the manifests of all packages, or of the packages given as arguments, for newer versions
+*/
+func CheckPackages(args []string) {
+  for _, id := range args {
+    if _, exists := GetPackageConfig(id); !exists {
+      fmt.Println("Unrecognized package argument:", id)
+      return
+    }
+  }
+  statuses, err := packages.Instance().CheckPackages(configs.GetBaseDir(), configs.LoadPackagesConf(), args)
+  if err != nil {
+    fmt.Println("Error:", err)
+    return
+  }
+  fmt.Printf("%-15s %-12s %-12s %-12s %s\n", "PACKAGE", "INSTALLED", "LATEST", "PINNED", "STATUS")
+  for _, status := range statuses {
+    fmt.Printf("%-15s %-12s %-12s %-12s %s\n", status.Id, orDash(status.InstalledVersion), orDash(status.LatestVersion), orDash(status.PinnedVersion), getStatusString(status))
+    if status.Error != nil {
+      fmt.Println("  Error:", status.Error)
+    }
+  }
+}
+
+/*
+  Update a package to the newest version that meets its requirements, or to its pinned version if it is pinned
+*/
+func UpdatePackage(args []string) {
+  if len(args) == 0 {
+    fmt.Println("USAGE:", UPDATE, "<package_id> [-yes] [-restart]")
+    return
+  }
+  id := args[0]
+  flags := flag.NewFlagSet(UPDATE, flag.ContinueOnError)
+  flags.SetOutput(os.Stdout)
+  yes := flags.Bool("yes", false, "Update without asking for confirmation")
+  restart := flags.Bool("restart", false, "Restart the process of the package after updating")
+  if err := flags.Parse(args[1:]); err != nil {
+    return
+  }
+
+  config, exists := GetPackageConfig(id)
+  if !exists {
+    fmt.Println("Unrecognized package argument:", id)
+    return
+  }
+  packagesConfig := configs.LoadPackagesConf()
+  statuses, err := packages.Instance().CheckPackages(configs.GetBaseDir(), packagesConfig, []string{id})
+  if err != nil {
+    fmt.Println("Error:", err)
+    return
+  }
+  status := statuses[0]
+  if status.UpToDate {
+    fmt.Println("Package", id, "is up to date at version", status.InstalledVersion)
+    return
+  }
+  version := status.TargetVersion
+  if version == "" {
+    fmt.Println("Update failed:", status.Error)
+    return
+  }
+
+  if !*yes {
+    fmt.Printf("Update package %s from version %s to %s?\n", id, orDash(status.InstalledVersion), version)
+    if !modes.GetConfirmationInput() {
+      fmt.Println("Update cancelled")
+      return
+    }
+  }
+  if err := packages.Instance().UpdatePackage(configs.GetBaseDir(), packagesConfig, config, version); err != nil {
+    fmt.Println("Update failed:", err)
+    util.Logger.Error("Error: update " + id + " failed: " + err.Error())
+    return
+  }
+  fmt.Println("Updated", id, "to version", version)
+  restartPackageProcess(id, *restart)
+}
+
+/*
+  Switch a package back to the version installed before the current one, ie. when the new version fails to start
+*/
+func RollbackPackage(args []string) {
+  if len(args) == 0 {
+    fmt.Println("USAGE:", ROLLBACK, "<package_id> [-restart]")
+    return
+  }
+  id := args[0]
+  flags := flag.NewFlagSet(ROLLBACK, flag.ContinueOnError)
+  flags.SetOutput(os.Stdout)
+  restart := flags.Bool("restart", false, "Restart the process of the package after rolling back")
+  if err := flags.Parse(args[1:]); err != nil {
+    return
+  }
+
+  config, exists := GetPackageConfig(id)
+  if !exists {
+    fmt.Println("Unrecognized package argument:", id)
+    return
+  }
+  version, err := packages.Instance().RollbackPackage(configs.GetBaseDir(), config)
+  if err != nil {
+    fmt.Println("Rollback failed:", err)
+    util.Logger.Error("Error: rollback " + id + " failed: " + err.Error())
+    return
+  }
+  fmt.Println("Rolled back", id, "to version", version)
+  restartPackageProcess(id, *restart)
+}
+
+/*
+  Hold a package at a version, its installed version if none is given, instead of updating it to the version of its
+  manifest
+*/
+func PinPackage(args []string) {
+  if len(args) == 0 || len(args) > 2 {
+    fmt.Println("USAGE:", PIN, "<package_id> [version]")
+    return
+  }
+  id := args[0]
+  config, exists := GetPackageConfig(id)
+  if !exists {
+    fmt.Println("Unrecognized package argument:", id)
+    return
+  }
+  packagesConfig := configs.LoadPackagesConf()
+
+  var version string
+  if len(args) == 2 {
+    version = args[1]
+  } else {
+    status := packages.Instance().GetPackageStatus(configs.GetBaseDir(), packagesConfig, config)
+    if status.InstalledVersion == "" {
+      fmt.Println("Package", id, "is not installed, specify the version to pin it at")
+      return
+    }
+    version = status.InstalledVersion
+  }
+  if err := packages.Instance().PinPackage(packagesConfig, id, version); err != nil {
+    fmt.Println("Error:", err)
+    return
+  }
+  fmt.Println("Pinned", id, "at version", version)
+  fmt.Println("Use", UPDATE, id, "to switch to the pinned version if it is not installed")
+}
+
+/*
+  Let a pinned package update to the version of its manifest again
+*/
+func UnpinPackage(args []string) {
+  if len(args) != 1 {
+    fmt.Println("USAGE:", UNPIN, "<package_id>")
+    return
+  }
+  if err := packages.Instance().PinPackage(configs.LoadPackagesConf(), args[0], ""); err != nil {
+    fmt.Println("Error:", err)
+    return
+  }
+  fmt.Println("Unpinned", args[0])
+}
+
+/*
+  Show whether packages are updated at startup without asking, or turn it on or off
+*/
+func SetAutoUpdate(args []string) {
+  packagesConfig := configs.LoadPackagesConf()
+  if len(args) == 0 {
+    fmt.Println("Auto-update:", getAutoUpdateString(packagesConfig.AutoUpdateEnabled))
+    return
+  }
+  switch args[0] {
+  case AUTO_UPDATE_ON:
+    packagesConfig.AutoUpdateEnabled = true
+  case AUTO_UPDATE_OFF:
+    packagesConfig.AutoUpdateEnabled = false
+  default:
+    fmt.Println("USAGE:", AUTO_UPDATE, "["+AUTO_UPDATE_ON+"|"+AUTO_UPDATE_OFF+"]")
+    return
+  }
+  configs.UpdatePackagesConf(packagesConfig)
+  fmt.Println("Auto-update:", getAutoUpdateString(packagesConfig.AutoUpdateEnabled))
+}
+
+/*
+  Packages and the processes running them share their ids
+*/
+func restartPackageProcess(id string, restart bool) {
+  if !processes.Instance().ContainsId(id) {
+    return
+  }
+  if restart {
+    process_commands.RestartProcess([]string{id})
+  } else {
+    fmt.Println("The process keeps running the old version until it is restarted with: process restart", id)
+  }
+}
+
+func getStatusString(status *packages.PackageStatus) string {
+  switch {
+  case status.UpToDate:
+    return "UP TO DATE"
+  case status.InstalledVersion == "":
+    return "NOT INSTALLED"
+  case status.TargetVersion == "":
+    return "UNKNOWN"
+  }
+  return "UPDATE TO " + status.TargetVersion
+}
+
+func getAutoUpdateString(enabled bool) string {
+  if enabled {
+    return AUTO_UPDATE_ON
+  }
+  return AUTO_UPDATE_OFF
+}
+
+func orDash(value string) string {
+  if value == "" {
+    return "-"
+  }
+  return value
+}
+
+/*
+  Download and verify the packages into a bundle, for installing them on nodes without internet
+*/
+func BundlePackages(args []string) {
+  if len(args) != 1 {
+    fmt.Println("USAGE:", BUNDLE, "<bundle_file>")
+    return
+  }
+  if err := packages.Instance().CreateBundle(configs.GetBaseDir(), configs.LoadPackagesConf(), args[0]); err != nil {
+    fmt.Println("Bundle failed:", err)
+    util.Logger.Error("Error: bundle failed: " + err.Error())
+    return
+  }
+  fmt.Println("Created bundle", args[0])
+  fmt.Println("Install it with: mcli -mode upgrade -bundle", args[0])
+}
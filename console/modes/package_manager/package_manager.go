@@ -0,0 +1,144 @@
+package package_manager
+
+import (
+  "fmt"
+  "github.com/MarconiProtocol/cli/console/context"
+  "github.com/MarconiProtocol/cli/console/modes"
+  "github.com/MarconiProtocol/cli/console/modes/package_manager/commands"
+  "github.com/MarconiProtocol/cli/console/util"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "github.com/MarconiProtocol/go-prompt"
+)
+
+// Name of Mode
+const NAME = "package"
+
+// Mode suggestions
+var PACKAGE_SUGGESTIONS = []prompt.Suggest{
+  {Text: package_manager_commands.LIST, Description: "List the installed versions of the packages."},
+  {Text: package_manager_commands.CHECK, Description: "Check the package manifests for newer versions."},
+  {Text: package_manager_commands.UPDATE, Description: "Update a package to its newest or pinned version."},
+  {Text: package_manager_commands.ROLLBACK, Description: "Switch a package back to its previous version."},
+  {Text: package_manager_commands.PIN, Description: "Hold a package at a version."},
+  {Text: package_manager_commands.UNPIN, Description: "Let a pinned package update again."},
+  {Text: package_manager_commands.AUTO_UPDATE, Description: "Show or set whether packages update without asking."},
+  {Text: package_manager_commands.BUNDLE, Description: "Download the packages into a bundle for offline installs."},
+  {Text: modes.RETURN_TO_ROOT, Description: "Return to home menu"},
+  {Text: modes.EXIT_CMD, Description: "Exit mcli"},
+}
+
+/*
+  Menu/Mode for package operations
+*/
+type PackageMode struct {
+  modes.BaseMode
+}
+
+/*
+  Create a new package cmd struct,
+  use this to create a PackageMode otherwise suggestion and handlers wont be properly initialized
+*/
+func NewPackageMode(c *context.Context) *PackageMode {
+  packageMode := PackageMode{}
+  packageMode.Init(c)
+  packageMode.SetBaseSuggestions(PACKAGE_SUGGESTIONS)
+
+  // suggestion and handler registrations
+  packageMode.RegisterCommand(package_manager_commands.LIST, packageMode.GetEmptySuggestions, packageMode.handleList)
+  packageMode.RegisterCommand(package_manager_commands.CHECK, packageMode.getSuggestions, packageMode.handleCheck)
+  packageMode.RegisterCommand(package_manager_commands.UPDATE, packageMode.getSuggestions, packageMode.handleUpdate)
+  packageMode.RegisterCommand(package_manager_commands.ROLLBACK, packageMode.getSuggestions, packageMode.handleRollback)
+  packageMode.RegisterCommand(package_manager_commands.PIN, packageMode.getSuggestions, packageMode.handlePin)
+  packageMode.RegisterCommand(package_manager_commands.UNPIN, packageMode.getSuggestions, packageMode.handleUnpin)
+  packageMode.RegisterCommand(package_manager_commands.AUTO_UPDATE, packageMode.getAutoUpdateSuggestions, packageMode.handleAutoUpdate)
+  packageMode.RegisterCommand(package_manager_commands.BUNDLE, packageMode.GetEmptySuggestions, packageMode.handleBundle)
+
+  packageMode.RegisterCommand(modes.RETURN_TO_ROOT, packageMode.GetEmptySuggestions, packageMode.HandleReturnToRoot)
+  packageMode.RegisterCommand(modes.EXIT_CMD, packageMode.GetEmptySuggestions, packageMode.HandleExitCommand)
+
+  return &packageMode
+}
+
+func (pm *PackageMode) CliPrefix() (string, bool) {
+  return pm.Name(), false
+}
+
+func (pm *PackageMode) Name() string {
+  return NAME
+}
+
+func (pm *PackageMode) HandleCommand(args []string) {
+  if !modes.ArgsMinLenCheck(args, 1) {
+    fmt.Println("USAGE:  <command>")
+    return
+  }
+  commandType := args[0]
+  commandArgs := args[1:]
+  if commandHandlerFunction, present := package_manager_commands.COMMAND_MAP[commandType]; present {
+    commandHandlerFunction(commandArgs)
+  } else {
+    fmt.Println("Invalid command " + commandType)
+  }
+}
+
+/*
+  Show prompt suggestions for the ids of the configured packages
+*/
+func (pm *PackageMode) getSuggestions(line []string) []prompt.Suggest {
+  packageConfigs := configs.LoadPackagesConf().Packages
+  suggestions := make([]prompt.Suggest, len(packageConfigs))
+  for i, packageConfig := range packageConfigs {
+    suggestions[i] = prompt.Suggest{Text: packageConfig.Id, Description: ""}
+  }
+  return util.SimpleSubcommandCompleter(line, 1, suggestions)
+}
+
+/*
+  Show prompt suggestions for turning auto-update on or off
+*/
+func (pm *PackageMode) getAutoUpdateSuggestions(line []string) []prompt.Suggest {
+  return util.SimpleSubcommandCompleter(line, 1, []prompt.Suggest{
+    {Text: package_manager_commands.AUTO_UPDATE_ON, Description: "Update packages at startup without asking"},
+    {Text: package_manager_commands.AUTO_UPDATE_OFF, Description: "Ask before updating packages at startup"},
+  })
+}
+
+func (pm *PackageMode) handleList(args []string) {
+  util.Logger.Info(package_manager_commands.LIST, util.ArgsToString(args))
+  package_manager_commands.ListPackages(args)
+}
+
+func (pm *PackageMode) handleCheck(args []string) {
+  util.Logger.Info(package_manager_commands.CHECK, util.ArgsToString(args))
+  package_manager_commands.CheckPackages(args)
+}
+
+func (pm *PackageMode) handleUpdate(args []string) {
+  util.Logger.Info(package_manager_commands.UPDATE, util.ArgsToString(args))
+  package_manager_commands.UpdatePackage(args)
+}
+
+func (pm *PackageMode) handleRollback(args []string) {
+  util.Logger.Info(package_manager_commands.ROLLBACK, util.ArgsToString(args))
+  package_manager_commands.RollbackPackage(args)
+}
+
+func (pm *PackageMode) handlePin(args []string) {
+  util.Logger.Info(package_manager_commands.PIN, util.ArgsToString(args))
+  package_manager_commands.PinPackage(args)
+}
+
+func (pm *PackageMode) handleUnpin(args []string) {
+  util.Logger.Info(package_manager_commands.UNPIN, util.ArgsToString(args))
+  package_manager_commands.UnpinPackage(args)
+}
+
+func (pm *PackageMode) handleAutoUpdate(args []string) {
+  util.Logger.Info(package_manager_commands.AUTO_UPDATE, util.ArgsToString(args))
+  package_manager_commands.SetAutoUpdate(args)
+}
+
+func (pm *PackageMode) handleBundle(args []string) {
+  util.Logger.Info(package_manager_commands.BUNDLE, util.ArgsToString(args))
+  package_manager_commands.BundlePackages(args)
+}
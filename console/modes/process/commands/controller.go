@@ -0,0 +1,73 @@
+package process_commands
+
+import (
+  "github.com/MarconiProtocol/cli/api/supervisor"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "github.com/MarconiProtocol/cli/core/processes"
+  "io"
+)
+
+/*
+  Controls the managed processes, either through a running supervisor or with the process manager of this instance
+*/
+type processController interface {
+  StartProcesses(ids []string, background bool) error
+  KillProcess(id string) error
+  RestartProcess(id string, background bool) error
+  GetProcessRunningMap() (map[string]processes.ProcessStatus, error)
+  GetProcessUsage() ([]processes.ProcessUsage, error)
+  Logs(id string, options processes.LogOptions, follow bool, out io.Writer, stop <-chan struct{}) error
+}
+
+/*
+  Returns a client of the supervisor if one is running, so that processes are only ever managed by the supervisor
+*/
+func getProcessController() processController {
+  client := supervisor.NewClient(configs.GetBaseDir())
+  if client.IsRunning() {
+    return client
+  }
+  return localController{processes.Instance()}
+}
+
+type localController struct {
+  pm *processes.ProcessManager
+}
+
+func (c localController) StartProcesses(ids []string, background bool) error {
+  return c.pm.StartProcesses(ids, background)
+}
+
+func (c localController) KillProcess(id string) error {
+  return c.pm.KillProcess(id)
+}
+
+/*
+  KillProcess only returns once the process group is gone, so it is safe to start it again right away
+*/
+func (c localController) RestartProcess(id string, background bool) error {
+  if err := c.pm.KillProcess(id); err != nil {
+    return err
+  }
+  return c.pm.StartProcesses([]string{id}, background)
+}
+
+func (c localController) GetProcessRunningMap() (map[string]processes.ProcessStatus, error) {
+  return c.pm.GetProcessRunningMap(), nil
+}
+
+func (c localController) GetProcessUsage() ([]processes.ProcessUsage, error) {
+  return c.pm.GetProcessUsage(), nil
+}
+
+func (c localController) Logs(id string, options processes.LogOptions, follow bool, out io.Writer, stop <-chan struct{}) error {
+  err := c.pm.ShowLogs(id, options, out)
+  if !follow {
+    return err
+  }
+  // the log may not exist yet, keep following until it does
+  if err != nil {
+    io.WriteString(out, "Error: "+err.Error()+"\n")
+  }
+  return c.pm.FollowLogs(id, options, out, stop)
+}
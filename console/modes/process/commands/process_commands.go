@@ -1,12 +1,15 @@
 package process_commands
 
 import (
+  "flag"
   "fmt"
   "github.com/MarconiProtocol/cli/console/util"
   "github.com/MarconiProtocol/cli/core/configs"
   "github.com/MarconiProtocol/cli/core/processes"
   "io/ioutil"
+  "os"
   "path/filepath"
+  "regexp"
   "strconv"
   "strings"
   "time"
@@ -20,6 +23,10 @@ const (
   LIST    = "list"
   VERSION = "version"
   UTIL    = "util"
+  LOGS    = "logs"
+  STATUS  = "status"
+
+  DEFAULT_LOG_LINES = 10
 )
 
 var COMMAND_MAP = map[string]func([]string){
@@ -29,6 +36,8 @@ var COMMAND_MAP = map[string]func([]string){
   LIST:    ListProcesses,
   VERSION: ListProcessVersions,
   UTIL:    handleUtilCommand,
+  LOGS:    ShowProcessLogs,
+  STATUS:  ShowProcessStatus,
 }
 
 func parseArgs(args []string) (string, []string, bool) {
@@ -59,7 +68,10 @@ func StartProcesses(args []string) {
     background, _ = strconv.ParseBool(parsedArgs[0])
   }
 
-  processes.Instance().StartProcesses([]string{program}, background)
+  if err := getProcessController().StartProcesses([]string{program}, background); err != nil {
+    fmt.Println("Failed to start", program+":", err)
+    util.Logger.Error("Error: start " + program + " failed: " + err.Error())
+  }
 }
 
 func StopProcess(args []string) {
@@ -68,45 +80,166 @@ func StopProcess(args []string) {
     return
   }
 
-  processes.Instance().KillProcess(program)
+  if err := getProcessController().KillProcess(program); err != nil {
+    fmt.Println("Error:", err)
+    util.Logger.Error("Error: stop " + program + " failed: " + err.Error())
+  }
 }
 
 func RestartProcess(args []string) {
-  program, _, exists := parseArgs(args)
+  program, parsedArgs, exists := parseArgs(args)
   if !exists {
     return
   }
 
-  StopProcess(args)
-  // use ps aux to check if this program is terminated
-  for attempts := 0; attempts <= 3; attempts++ {
-    if attempts == 3 {
-      fmt.Println("restart " + program + " failed")
-      util.Logger.Error("Error: restart " + program + " failed")
+  background := false
+  if len(parsedArgs) == 1 {
+    background, _ = strconv.ParseBool(parsedArgs[0])
+  }
+
+  if err := getProcessController().RestartProcess(program, background); err != nil {
+    fmt.Println("restart "+program+" failed:", err)
+    util.Logger.Error("Error: restart " + program + " failed: " + err.Error())
+  }
+}
+
+/*
+  Show the log of a process, usage: logs <process> [-n N] [-f] [--grep pattern] [--since duration]
+*/
+func ShowProcessLogs(args []string) {
+  program, parsedArgs, exists := parseArgs(args)
+  if !exists {
+    return
+  }
+
+  flags := flag.NewFlagSet(LOGS, flag.ContinueOnError)
+  flags.SetOutput(os.Stdout)
+  lines := flags.Int("n", DEFAULT_LOG_LINES, "Number of most recent lines to show, 0 shows all of them")
+  follow := flags.Bool("f", false, "Keep showing lines as they are logged, until Ctrl-C is pressed")
+  pattern := flags.String("grep", "", "Only show lines matching the regular expression")
+  since := flags.Duration("since", 0, "Only show lines logged within the duration, ie. 30m or 2h")
+  if err := flags.Parse(parsedArgs); err != nil {
+    return
+  }
+
+  options := processes.LogOptions{Lines: *lines}
+  if *pattern != "" {
+    regex, err := regexp.Compile(*pattern)
+    if err != nil {
+      fmt.Println("Invalid grep pattern:", err)
       return
     }
-    time.Sleep(3 * time.Second)
-    if processes.Instance().CheckProcessExistence(program) {
-      fmt.Println(program + " is still running, retrying...")
-    } else {
-      break
-    }
+    options.Pattern = regex
+  }
+  if *since > 0 {
+    options.Since = time.Now().Add(-*since)
+  }
+
+  var interrupted <-chan struct{}
+  if *follow {
+    var release func()
+    interrupted, release = util.CaptureInterrupt()
+    defer release()
+  }
+  if err := getProcessController().Logs(program, options, *follow, os.Stdout, interrupted); err != nil {
+    fmt.Println("Error:", err)
   }
-  StartProcesses(args)
 }
 
 func ListProcesses(args []string) {
-  statuses := processes.Instance().GetProcessRunningMap()
+  statuses, err := getProcessController().GetProcessRunningMap()
+  if err != nil {
+    fmt.Println("Error:", err)
+    return
+  }
+  fmt.Printf("%-15s %-10s %-10s %-10s %s\n", "PROCESS", "STATUS", "CRASHES", "RESTARTS", "LAST EXIT")
   for _, processConfig := range processes.Instance().GetSortedProcessConfigs() {
+    status := statuses[processConfig.Id]
     var runString string
-    if statuses[processConfig.Id] {
+    if status.Running {
       runString = "RUNNING"
     } else {
       runString = "STOPPED"
     }
 
-    fmt.Printf("%-15s %s\n", processConfig.Id, runString)
+    lastExitStatus := status.LastExitStatus
+    if lastExitStatus == "" {
+      lastExitStatus = "-"
+    }
+
+    fmt.Printf("%-15s %-10s %-10d %-10d %s\n", processConfig.Id, runString, status.Crashes, status.Restarts, lastExitStatus)
+  }
+}
+
+/*
+  Show resource usage read from /proc for all processes, or only the process given as argument
+*/
+func ShowProcessStatus(args []string) {
+  program := ""
+  if len(args) > 0 {
+    var exists bool
+    if program, _, exists = parseArgs(args); !exists {
+      return
+    }
+  }
+
+  usages, err := getProcessController().GetProcessUsage()
+  if err != nil {
+    fmt.Println("Error:", err)
+    return
+  }
+  fmt.Printf("%-12s %-8s %-9s %-7s %-10s %-10s %-6s %-8s %-10s %s\n",
+    "PROCESS", "PID", "STATUS", "CPU%", "CPU TIME", "RSS", "FDS", "THREADS", "UPTIME", "CHILDREN")
+  var staleMessages []string
+  for _, usage := range usages {
+    if program != "" && usage.Id != program {
+      continue
+    }
+
+    if !usage.Running {
+      status := "STOPPED"
+      pid := "-"
+      if usage.StaleReason != "" {
+        status = "STALE"
+        pid = strconv.Itoa(usage.Pid)
+        staleMessages = append(staleMessages, fmt.Sprintf("%s has a stale pid file: %s", usage.Id, usage.StaleReason))
+      }
+      fmt.Printf("%-12s %-8s %-9s %-7s %-10s %-10s %-6s %-8s %-10s %s\n", usage.Id, pid, status, "-", "-", "-", "-", "-", "-", "-")
+      continue
+    }
+
+    fds := "-"
+    if usage.OpenFds >= 0 {
+      fds = strconv.Itoa(usage.OpenFds)
+    }
+    children := "-"
+    if len(usage.Children) > 0 {
+      var pids []string
+      for _, pid := range usage.Children {
+        pids = append(pids, strconv.Itoa(pid))
+      }
+      children = strings.Join(pids, ",")
+    }
+    fmt.Printf("%-12s %-8d %-9s %-7.1f %-10s %-10s %-6s %-8d %-10s %s\n", usage.Id, usage.Pid, "RUNNING", usage.CpuPercent,
+      usage.CpuTime.Truncate(time.Second), formatBytes(usage.Rss), fds, usage.Threads, usage.Uptime, children)
+  }
+
+  for _, message := range staleMessages {
+    fmt.Println(message)
+  }
+}
+
+func formatBytes(bytes uint64) string {
+  const unit = 1024
+  if bytes < unit {
+    return fmt.Sprintf("%dB", bytes)
+  }
+  div, exp := uint64(unit), 0
+  for n := bytes / unit; n >= unit; n /= unit {
+    div *= unit
+    exp++
   }
+  return fmt.Sprintf("%.1f%ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
 
 func ListProcessVersions(args []string) {
@@ -1,22 +1,32 @@
 package process_commands
 
 import (
+  "flag"
   "fmt"
   "github.com/MarconiProtocol/cli/console/modes"
   "github.com/MarconiProtocol/cli/core/configs"
-  "io/ioutil"
+  "github.com/MarconiProtocol/cli/core/processes"
+  "github.com/MarconiProtocol/cli/core/reset"
+  "github.com/MarconiProtocol/cli/core/supervisor"
+  "github.com/MarconiProtocol/cli/core/systemd"
   "os"
   "path"
-  "time"
+  "strings"
 )
 
 // Commands
 const (
-  RESET = "reset"
+  RESET   = "reset"
+  RESTORE = "restore"
+  SYSTEMD = "systemd"
+
+  SUPERVISOR_UNITS_FLAG = "--supervisor"
 )
 
 var UTIL_COMMAND_MAP = map[string]func([]string){
-  RESET: Reset,
+  RESET:   Reset,
+  RESTORE: Restore,
+  SYSTEMD: GenerateSystemdUnits,
 }
 
 func handleUtilCommand(args []string) {
@@ -33,78 +43,195 @@ func handleUtilCommand(args []string) {
   }
 }
 
+/*
+  Stop the managed processes, back up the user's credentials and configs, and remove all the downloaded binaries and
+  other data, to get everything back to when mcli was just extracted from the tarball
+*/
 func Reset(args []string) {
-  // stop all marconi processes
-  StopProcess([]string{"gmeth"})
-  StopProcess([]string{"marconid"})
-  StopProcess([]string{"middleware"})
+  flags := flag.NewFlagSet(RESET, flag.ContinueOnError)
+  flags.SetOutput(os.Stdout)
+  dryRun := flags.Bool("dry-run", false, "Only list what would be backed up and removed")
+  keep := flags.String("keep", "", "Comma separated data to keep: "+strings.Join(reset.GetKeepSelections(), ", "))
+  skipConfirmation := flags.Bool("yes", false, "Don't ask for confirmation")
+  if err := flags.Parse(args); err != nil {
+    return
+  }
+  var keepSelections []string
+  if *keep != "" {
+    keepSelections = strings.Split(*keep, ",")
+  }
 
-  // create the backup folder in baseDir if it does not exist
-  baseDir := configs.GetBaseDir()
-  backUpDir := path.Join(baseDir, "backup")
-  if _, err := os.Stat(backUpDir); os.IsNotExist(err) {
-    if err1 := os.Mkdir(backUpDir, os.ModePerm); err1 != nil {
-      fmt.Printf("Reset failed: could not create folder %s, err: %s", backUpDir, err1.Error())
+  plan, err := reset.PlanReset(configs.GetBaseDir(), keepSelections)
+  if err != nil {
+    fmt.Println("Reset failed:", err)
+    return
+  }
+  // stopped in reverse dependency order
+  processConfigs := processes.Instance().GetSortedProcessConfigs()
+  var processIds []string
+  for i := len(processConfigs) - 1; i >= 0; i-- {
+    processIds = append(processIds, processConfigs[i].Id)
+  }
+
+  printResetPlan(plan, processIds)
+  if *dryRun {
+    return
+  }
+  if len(plan.Removals) == 0 && len(plan.Backups) == 0 {
+    fmt.Println("Nothing to reset.")
+    return
+  }
+  if !*skipConfirmation {
+    fmt.Println("Reset the files listed above?")
+    if !modes.GetConfirmationInput() {
+      fmt.Println("Reset was cancelled")
       return
     }
   }
 
-  // back up the user's credentials
-  accountsDir := path.Join(baseDir, "accounts")
-  if _, err := os.Stat(accountsDir); !os.IsNotExist(err) {
-    // create a folder in the backup folder using the current timestamp
-    t := time.Now()
-    formattedTimestamp := fmt.Sprintf("%d-%02d-%02dT%02d:%02d:%02d", t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second())
-    backUpTSDir := path.Join(backUpDir, formattedTimestamp)
-
-    if err1 := os.Mkdir(backUpTSDir, os.ModePerm); err1 != nil {
-      fmt.Printf("Reset failed: could not create folder %s, err: %s", backUpTSDir, err1.Error())
+  controller := getProcessController()
+  for _, id := range processIds {
+    if err := controller.KillProcess(id); err != nil {
+      fmt.Println("Reset failed: could not stop", id+", nothing was removed:", err)
       return
     }
+  }
 
-    // back up the credentials
-    if err1 := os.Rename(accountsDir, path.Join(backUpTSDir, "accounts")); err1 != nil {
-      fmt.Println("Reset failed: err:", err1)
+  if err := plan.Execute(); err != nil {
+    fmt.Println("Reset failed:", err)
+    return
+  }
+  if len(plan.Backups) > 0 {
+    fmt.Println("User's credentials and configs are backed up to", plan.GetBackupDir())
+    fmt.Println("They can be put back with:", UTIL, RESTORE, plan.Timestamp)
+  }
+  fmt.Println("Reset successfully. Please exit and restart MCLI.")
+}
+
+func printResetPlan(plan *reset.Plan, processIds []string) {
+  if len(processIds) > 0 {
+    fmt.Println("Processes to stop:", strings.Join(processIds, ", "))
+  }
+  if len(plan.Backups) > 0 {
+    fmt.Println("To back up to", plan.GetBackupDir()+":")
+    for _, item := range plan.Backups {
+      action := "copied"
+      if item.Move {
+        action = "moved"
+      }
+      fmt.Printf("  %s (%s)\n", item.Path, action)
+    }
+  }
+  if len(plan.Removals) > 0 {
+    fmt.Println("To remove:")
+    for _, path := range plan.Removals {
+      fmt.Println(" ", path)
+    }
+  }
+  if len(plan.Kept) > 0 {
+    fmt.Println("To keep:")
+    for _, path := range plan.Kept {
+      fmt.Println(" ", path)
+    }
+  }
+}
+
+/*
+  Put the accounts and configs of a backup made by reset back, lists the backups if no timestamp is given
+*/
+func Restore(args []string) {
+  baseDir := configs.GetBaseDir()
+  if len(args) == 0 {
+    timestamps, err := reset.ListBackups(baseDir)
+    if err != nil {
+      fmt.Println("Failed to list backups:", err)
+      return
+    }
+    if len(timestamps) == 0 {
+      fmt.Println("No backups found in", path.Join(baseDir, reset.BACKUP_DIR))
       return
-    } else {
-      fmt.Println("User's credentials are backed up to", backUpTSDir)
     }
+    fmt.Println("USAGE:", RESTORE, "<backup-timestamp> [-yes]")
+    fmt.Println("Backups:")
+    for _, timestamp := range timestamps {
+      fmt.Println(" ", timestamp)
+    }
+    return
   }
 
-  // remove all the downloaded binaries and other data, get everything back to when MCLI was just extracted from the tarball
-  files, err := ioutil.ReadDir(baseDir)
+  timestamp := args[0]
+  flags := flag.NewFlagSet(RESTORE, flag.ContinueOnError)
+  flags.SetOutput(os.Stdout)
+  skipConfirmation := flags.Bool("yes", false, "Don't ask for confirmation")
+  if err := flags.Parse(args[1:]); err != nil {
+    return
+  }
+
+  if !*skipConfirmation {
+    fmt.Println("Replace the current accounts and configs with the ones backed up at", timestamp+"?")
+    if !modes.GetConfirmationInput() {
+      fmt.Println("Restore was cancelled")
+      return
+    }
+  }
+  current, err := reset.Restore(baseDir, timestamp)
+  if current != "" {
+    fmt.Println("The previous accounts and configs are backed up to", path.Join(baseDir, reset.BACKUP_DIR, current))
+  }
   if err != nil {
-    fmt.Printf("Reset failed: could not read from path %s, err: %s", baseDir, err.Error())
+    fmt.Println("Restore failed:", err)
     return
   }
+  fmt.Println("Restored the backup", timestamp+". Please exit and restart MCLI.")
+}
 
-  for _, file := range files {
-    switch file.Name() {
-    case "bin":
-      binDir := path.Join(baseDir, "bin")
-      bins, err1 := ioutil.ReadDir(binDir)
-      if err1 != nil {
-        fmt.Printf("Reset failed: could not read from path %s, err: %s", binDir, err1.Error())
-        return
-      }
+/*
+  Render systemd units for the managed processes, or for running mcli as supervisor if --supervisor is passed
+  The units are written to the output dir if one is given, otherwise they are printed
+*/
+func GenerateSystemdUnits(args []string) {
+  outputDir := ""
+  supervisorUnits := false
+  for _, arg := range args {
+    if arg == SUPERVISOR_UNITS_FLAG {
+      supervisorUnits = true
+    } else if outputDir == "" {
+      outputDir = arg
+    } else {
+      fmt.Println("USAGE: systemd [output_dir] [--supervisor]")
+      return
+    }
+  }
 
-      for _, bin := range bins {
-        if bin.Name() != "mcli" {
-          if err1 := os.RemoveAll(path.Join(baseDir, "bin", bin.Name())); err1 != nil {
-            fmt.Println("Reset failed: err:", err1)
-            return
-          }
-        }
-      }
-    case "configs",
-      "EULA.txt",
-      "backup":
-    default:
-      if err1 := os.RemoveAll(path.Join(baseDir, file.Name())); err1 != nil {
-        fmt.Println("Reset failed: err:", err1)
-        return
-      }
+  baseDir := configs.GetBaseDir()
+  var units []systemd.Unit
+  if supervisorUnits {
+    mcliPath, err := os.Executable()
+    if err != nil {
+      fmt.Println("Could not determine the path of mcli:", err)
+      return
+    }
+    units = systemd.RenderSupervisorUnits(baseDir, mcliPath, supervisor.GetSocketPath(baseDir))
+  } else {
+    var err error
+    units, err = systemd.RenderProcessUnits(baseDir, processes.Instance().GetSortedProcessConfigs())
+    if err != nil {
+      fmt.Println("Failed to render systemd units:", err)
+      return
     }
   }
-  fmt.Println("Reset successfully. Please exit and restart MCLI.")
+
+  if outputDir == "" {
+    for _, unit := range units {
+      fmt.Printf("# %s\n%s\n", unit.Name, unit.Content)
+    }
+    return
+  }
+  if err := systemd.WriteUnits(outputDir, units); err != nil {
+    fmt.Println("Failed to write systemd units:", err)
+    return
+  }
+  for _, unit := range units {
+    fmt.Println("Wrote", path.Join(outputDir, unit.Name))
+  }
 }
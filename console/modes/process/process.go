@@ -20,6 +20,8 @@ var PROCESS_SUGGESTIONS = []prompt.Suggest{
   {Text: process_commands.RESTART, Description: "Restart a managed process."},
   {Text: process_commands.LIST, Description: "List running processes."},
   {Text: process_commands.VERSION, Description: "Show version of each component."},
+  {Text: process_commands.LOGS, Description: "Show the log of a process."},
+  {Text: process_commands.STATUS, Description: "Show resource usage of running processes."},
   {Text: process_commands.UTIL, Description: "Utility commands"},
   {Text: modes.RETURN_TO_ROOT, Description: "Return to home menu"},
   {Text: modes.EXIT_CMD, Description: "Exit mcli"},
@@ -47,8 +49,12 @@ func NewProcessMode(c *context.Context) *ProcessMode {
   processMode.RegisterCommand(process_commands.RESTART, processMode.getSuggestions, processMode.handleRestart)
   processMode.RegisterCommand(process_commands.LIST, processMode.GetEmptySuggestions, processMode.handleList)
   processMode.RegisterCommand(process_commands.VERSION, processMode.GetEmptySuggestions, processMode.handleVersion)
+  processMode.RegisterCommand(process_commands.LOGS, processMode.getSuggestions, processMode.handleLogs)
+  processMode.RegisterCommand(process_commands.STATUS, processMode.getSuggestions, processMode.handleStatus)
   processMode.RegisterCommand(process_commands.UTIL, processMode.getUtilSuggestions, processMode.handleUtil)
   processMode.RegisterSubCommand(process_commands.UTIL, process_commands.RESET, processMode.getRestSuggestions, processMode.handleReset)
+  processMode.RegisterSubCommand(process_commands.UTIL, process_commands.RESTORE, processMode.getRestoreSuggestions, processMode.handleRestore)
+  processMode.RegisterSubCommand(process_commands.UTIL, process_commands.SYSTEMD, processMode.getRestSuggestions, processMode.handleSystemd)
 
   processMode.RegisterCommand(modes.RETURN_TO_ROOT, processMode.GetEmptySuggestions, processMode.HandleReturnToRoot)
   processMode.RegisterCommand(modes.EXIT_CMD, processMode.GetEmptySuggestions, processMode.HandleExitCommand)
@@ -121,6 +127,16 @@ func (pm *ProcessMode) handleVersion(args []string) {
   process_commands.ListProcessVersions(args)
 }
 
+func (pm *ProcessMode) handleLogs(args []string) {
+  util.Logger.Info(process_commands.LOGS, util.ArgsToString(args))
+  process_commands.ShowProcessLogs(args)
+}
+
+func (pm *ProcessMode) handleStatus(args []string) {
+  util.Logger.Info(process_commands.STATUS, util.ArgsToString(args))
+  process_commands.ShowProcessStatus(args)
+}
+
 func (pm *ProcessMode) handleUtil(args []string) {
   util.HandleFurtherCommands(process_commands.UTIL, PROCESS_UTIL_SUGGESTIONS)
 }
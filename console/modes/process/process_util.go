@@ -3,18 +3,34 @@ package process
 import (
   "github.com/MarconiProtocol/cli/console/modes/process/commands"
   "github.com/MarconiProtocol/cli/console/util"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "github.com/MarconiProtocol/cli/core/reset"
   "github.com/MarconiProtocol/go-prompt"
 )
 
 // Mode suggestions
 var PROCESS_UTIL_SUGGESTIONS = []prompt.Suggest{
-  {Text: process_commands.RESET, Description: "Back up user credentials and clean up all the files of gmeth, marconid and middleware."},
+  {Text: process_commands.RESET, Description: "Back up user credentials and clean up all the files of the processes, see -dry-run and -keep."},
+  {Text: process_commands.RESTORE, Description: "Restore the credentials and configs backed up by reset."},
+  {Text: process_commands.SYSTEMD, Description: "Generate systemd units for the processes, or for the mcli supervisor with --supervisor."},
 }
 
 func (mnm *ProcessMode) getRestSuggestions(line []string) []prompt.Suggest {
   return []prompt.Suggest{}
 }
 
+/*
+  Show prompt suggestions for the timestamps of the backups to restore
+*/
+func (pm *ProcessMode) getRestoreSuggestions(line []string) []prompt.Suggest {
+  timestamps, _ := reset.ListBackups(configs.GetBaseDir())
+  suggestions := make([]prompt.Suggest, len(timestamps))
+  for i, timestamp := range timestamps {
+    suggestions[i] = prompt.Suggest{Text: timestamp, Description: ""}
+  }
+  return util.SimpleSubcommandCompleter(line, 1, suggestions)
+}
+
 /*
   Handle the reset command
 */
@@ -22,3 +38,19 @@ func (pm *ProcessMode) handleReset(args []string) {
   util.Logger.Info(process_commands.UTIL+" "+process_commands.RESET, util.ArgsToString(args))
   process_commands.Reset(args)
 }
+
+/*
+  Handle the restore command
+*/
+func (pm *ProcessMode) handleRestore(args []string) {
+  util.Logger.Info(process_commands.UTIL+" "+process_commands.RESTORE, util.ArgsToString(args))
+  process_commands.Restore(args)
+}
+
+/*
+  Handle the systemd command
+*/
+func (pm *ProcessMode) handleSystemd(args []string) {
+  util.Logger.Info(process_commands.UTIL+" "+process_commands.SYSTEMD, util.ArgsToString(args))
+  process_commands.GenerateSystemdUnits(args)
+}
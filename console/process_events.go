@@ -0,0 +1,20 @@
+package console
+
+import (
+  "github.com/MarconiProtocol/cli/console/util"
+  "github.com/MarconiProtocol/cli/core/processes"
+)
+
+/*
+  Log the lifecycle events of the managed processes while the console is running
+*/
+func watchProcessEvents() {
+  events, _ := processes.Instance().Subscribe()
+  for event := range events {
+    if event.Type == processes.EVENT_EXITED && !event.StopRequested && event.ExitCode != 0 {
+      util.Logger.Error("process", event.String())
+    } else {
+      util.Logger.Info("process", event.String())
+    }
+  }
+}
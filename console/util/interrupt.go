@@ -0,0 +1,45 @@
+package util
+
+import (
+  "sync"
+)
+
+var (
+  interruptMutex   sync.Mutex
+  interruptChannel chan struct{}
+)
+
+/*
+  Delivers the next Ctrl-C to the returned channel instead of exiting mcli, used by long running
+  commands that should return to the prompt when interrupted, release has to be called once the command is done
+*/
+func CaptureInterrupt() (<-chan struct{}, func()) {
+  interruptMutex.Lock()
+  defer interruptMutex.Unlock()
+
+  interrupted := make(chan struct{})
+  interruptChannel = interrupted
+  release := func() {
+    interruptMutex.Lock()
+    defer interruptMutex.Unlock()
+    if interruptChannel == interrupted {
+      interruptChannel = nil
+    }
+  }
+  return interrupted, release
+}
+
+/*
+  Called when SIGINT is received, returns true if a running command captured it
+*/
+func HandleInterrupt() bool {
+  interruptMutex.Lock()
+  defer interruptMutex.Unlock()
+
+  if interruptChannel == nil {
+    return false
+  }
+  close(interruptChannel)
+  interruptChannel = nil
+  return true
+}
@@ -5,6 +5,8 @@ import (
   "github.com/MarconiProtocol/cli/core/configs"
   "github.com/MarconiProtocol/cli/core/packages"
   "github.com/MarconiProtocol/cli/core/processes"
+  "github.com/MarconiProtocol/cli/core/supervisor"
+  "github.com/MarconiProtocol/cli/core/systemd"
 )
 
 func Bootstrap(baseDir string) {
@@ -17,11 +19,73 @@ func Bootstrap(baseDir string) {
   packages.Instance().UpdatePackages(baseDir, packages_config)
 }
 
-func StartProcessManager(baseDir string) {
-  processes_config := configs.LoadProcessesConf(baseDir)
+/*
+  Bootstraps from a bundle made with package bundle, for nodes without internet
+*/
+func BootstrapFromBundle(baseDir string, bundle string) {
+  fmt.Println("Bootstrapping Marconi Client from bundle", bundle+"...")
+
+  packages_config := configs.LoadPackagesConf()
+  packages.Instance().UpdatePackagesFromBundle(baseDir, packages_config, bundle)
+}
+
+func StartProcessManager(baseDir string) error {
+  processes_config, err := configs.LoadProcessesConf(baseDir)
+  if err != nil {
+    return err
+  }
   processes.Instance().InitProcessManager(baseDir, *processes_config)
+  return nil
+}
+
+/*
+  Checks the processes config without starting anything
+*/
+func ValidateProcessesConf(baseDir string) error {
+  _, err := configs.LoadProcessesConf(baseDir)
+  return err
+}
+
+/*
+  Serve the supervisor control socket until the supervisor is closed, starting all processes first if autostart is set
+*/
+func RunSupervisor(baseDir string, autostart bool) error {
+  if err := supervisor.Instance().Listen(baseDir); err != nil {
+    return err
+  }
+  served := make(chan error, 1)
+  go func() {
+    served <- supervisor.Instance().Serve()
+  }()
+
+  stopWatchdog := make(chan struct{})
+  defer close(stopWatchdog)
+  go systemd.RunWatchdog(stopWatchdog)
+
+  status := "Supervising processes"
+  if autostart {
+    var ids []string
+    for _, config := range processes.Instance().GetSortedProcessConfigs() {
+      ids = append(ids, config.Id)
+    }
+    if err := processes.Instance().StartProcesses(ids, false); err != nil {
+      fmt.Println("Failed to start processes:", err)
+      status = "Some processes failed to start: " + err.Error()
+    }
+  }
+
+  // when run by systemd with Type=notify, the supervisor is considered started once the processes are ready
+  systemd.NotifyStatus(status)
+  if _, err := systemd.Notify(systemd.NOTIFY_READY); err != nil {
+    fmt.Println("Failed to notify systemd:", err)
+  }
+  return <-served
 }
 
 func Cleanup() {
-  processes.Instance().StopProcesses()
+  systemd.Notify(systemd.NOTIFY_STOPPING)
+  supervisor.Instance().Close()
+  if err := processes.Instance().StopProcesses(); err != nil {
+    fmt.Println("Failed to stop all processes:", err)
+  }
 }
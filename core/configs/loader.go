@@ -46,14 +46,20 @@ func UpdatePackagesConf(newPackagesConfig *PackagesConfig) {
   writeFileBytes(bytes, PACKAGES_CONFIG_FILE)
 }
 
-func LoadProcessesConf(baseDir string) *ProcessesConfig {
+/*
+  Loads the processes config and validates its dependency graph, see ValidateProcessesConf
+*/
+func LoadProcessesConf(baseDir string) (*ProcessesConfig, error) {
   fileBytes := loadFileBytes(PROCESSES_CONFIG_FILE)
   var processesConfig ProcessesConfig
   err := json.Unmarshal(fileBytes, &processesConfig)
   if err != nil {
-    panic(fmt.Sprintf("Failed to parse processes config: %v", err))
+    return nil, fmt.Errorf("Failed to parse processes config: %v", err)
   }
-  return &processesConfig
+  if err := ValidateProcessesConf(&processesConfig); err != nil {
+    return nil, err
+  }
+  return &processesConfig, nil
 }
 
 func loadFileBytes(filenames []string) []byte {
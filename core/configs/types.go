@@ -5,27 +5,50 @@ type BaseConfig struct {
   MarconiNodeHost string
   MarconiNodePort string
   MarconidRPCPort string
+  // base64 or hex encoded ed25519 public keys, downloaded packages have to be signed by one of them
+  PackageSigningKeys []string
+  // packages are installed without a signature if no signing keys are configured, instead of being refused
+  AllowUnsignedPackages bool `json:",omitempty"`
 }
 
 // Config for packages to be downloaded
 type PackagesConfig struct {
   Version           string
   AutoUpdateEnabled bool
+  Channel           string `json:",omitempty"` // release channel of the packages, stable (default) or beta
+  Proxy             string `json:",omitempty"` // url of the http proxy to download packages through, ie. http://proxy:3128
   Packages          []PackageConfig
 }
 
 type PackageConfig struct {
-  Id          string
-  Dir         string
-  VersionFile string
-  IsEncrypted bool
-  Manifest    string
+  Id                string
+  Dir               string
+  VersionFile       string
+  IsEncrypted       bool
+  EncryptionDigest  string            `json:",omitempty"` // digest openssl derived the key of an encrypted package with, sha256 (default) or md5
+  Manifest          string
+  Channel           string            `json:",omitempty"` // overrides the Channel of the packages config for this package
+  VersionConstraint string            `json:",omitempty"` // semantic version range the package is kept in, ie. >=0.1.700 <0.2.0
+  Requires          map[string]string `json:",omitempty"` // version ranges of other packages this package works with, by package id
+  PinnedVersion     string            `json:",omitempty"` // version the package is held at instead of updating to the version of its manifest
+  Mirrors           []string          `json:",omitempty"` // base urls to download the package from when its source fails, ie. https://mirror.example.com
+  AllowedPaths      []string          `json:",omitempty"` // paths under Dir the package may install files to, ie. bin/marconid, any path under Dir if empty
+  MaxExtractedSize  int64             `json:",omitempty"` // bytes the files of the package may take up once extracted, 2 GB if not set
 }
 
+type PackageRelease struct {
+  Version         string
+  Source          string
+  Checksum        string            // hex encoded SHA-256 of the package, optionally prefixed with sha256:
+  SignatureSource string            // url of the detached ed25519 signature of the checksum, defaults to Source + ".sig"
+  Channel         string            `json:",omitempty"` // stable if empty
+  Requires        map[string]string `json:",omitempty"` // version ranges of other packages this release works with, by package id
+}
+
+// The newest stable release of a package, followed by any other releases, ie. of the beta channel
 type PackageManifest struct {
-  Version  string
-  Source   string
-  Checksum string
+  PackageRelease
+  Releases []PackageRelease `json:",omitempty"`
 }
 
 // Config for an individual process to be started with the process manager
@@ -44,4 +67,53 @@ type ProcessConfig struct {
   WaitForCompletion bool
   WaitTime          int
   PidFilename       string
+  RestartPolicy     string // one of never, on-failure or always, defaults to never
+  MaxRestarts       int    // maximum number of consecutive restarts, 0 means unlimited
+  RestartDelay      int    // seconds to wait before the first restart, doubled on every consecutive restart
+  RestartDelayMax   int    // upper bound in seconds for the restart delay
+  RestartWindow     int    // seconds a process has to stay up before its consecutive restarts are reset
+  Readiness         *ReadinessConfig
+  StopTimeout       int // seconds to wait for the process to exit after SIGTERM before sending SIGKILL
+  LogRotation       *LogRotationConfig
+  Env               map[string]string // environment variables added to the environment of mcli, overriding EnvFile
+  EnvFile           string            // file of KEY=VALUE lines, relative to the base dir
+  User              string            // user name or uid to run the process as, requires mcli to run as root
+  Group             string            // group name or gid to run the process as, defaults to the group of User
+  Umask             string            // octal file mode creation mask, ie. "027"
+  Limits            *LimitsConfig
+  Cgroup            *CgroupConfig
+}
+
+// Check used to decide when a started process is ready, so that processes depending on it can be started
+type ReadinessConfig struct {
+  Type     string // one of tcp, http, jsonrpc, log or file
+  Address  string // host:port to connect to for tcp checks
+  Url      string // url to request for http and jsonrpc checks
+  Method   string // method to call for jsonrpc checks
+  Pattern  string // regular expression matched against lines the process logs after it is started, for log checks
+  Path     string // file to wait for, relative to the base dir, for file checks
+  Timeout  int    // seconds to wait for the process to become ready
+  Interval int    // milliseconds between checks
+}
+
+// Resource limits of a process, a limit that is not set is inherited from mcli
+type LimitsConfig struct {
+  OpenFiles *int64 // RLIMIT_NOFILE, -1 for unlimited
+  CoreSize  *int64 // RLIMIT_CORE in bytes, -1 for unlimited
+}
+
+// Caps enforced through a cgroup v2 created for the process, requires mcli to run as root
+type CgroupConfig struct {
+  CpuPercent int // percentage of a single cpu the process can use, ie. 150 for one and a half cpus
+  CpuWeight  int // relative share of cpu time when cpus are contended, 1 to 10000 (default 100)
+  MemoryMax  int // megabytes of memory the process can use before it is killed
+  MemoryHigh int // megabytes of memory after which the process is throttled
+}
+
+// Rotation of the log file a process writes to, rotated logs are kept next to it with a timestamp suffix
+type LogRotationConfig struct {
+  MaxSize    int  // megabytes the log can grow to before it is rotated
+  MaxAge     int  // hours after which the log is rotated
+  MaxBackups int  // number of rotated logs to keep, 0 keeps all of them
+  Compress   bool // gzip rotated logs
 }
@@ -0,0 +1,126 @@
+package configs
+
+import (
+  "fmt"
+  "strings"
+)
+
+/*
+  A dependency on a process id that is not defined in the processes config
+*/
+type DanglingDependency struct {
+  Id         string
+  Dependency string
+}
+
+/*
+  Returned when the processes config does not describe a valid dependency graph
+*/
+type ProcessesConfigError struct {
+  EmptyIds             int
+  DuplicateIds         []string
+  DanglingDependencies []DanglingDependency
+  Cycles               [][]string
+}
+
+func (e *ProcessesConfigError) Error() string {
+  var problems []string
+  if e.EmptyIds > 0 {
+    problems = append(problems, fmt.Sprintf("%d process(es) without an Id", e.EmptyIds))
+  }
+  for _, id := range e.DuplicateIds {
+    problems = append(problems, fmt.Sprintf("process %s is defined more than once", id))
+  }
+  for _, dangling := range e.DanglingDependencies {
+    problems = append(problems, fmt.Sprintf("process %s depends on unknown process %s", dangling.Id, dangling.Dependency))
+  }
+  for _, cycle := range e.Cycles {
+    problems = append(problems, fmt.Sprintf("dependency cycle: %s", strings.Join(cycle, " -> ")))
+  }
+  return "Invalid processes config:\n  " + strings.Join(problems, "\n  ")
+}
+
+/*
+  Checks that every process has a unique id, that every dependency refers to a defined process
+  and that there are no dependency cycles, returns a *ProcessesConfigError describing every problem found
+*/
+func ValidateProcessesConf(processesConfig *ProcessesConfig) error {
+  configError := ProcessesConfigError{}
+
+  processMap := make(map[string]ProcessConfig)
+  for _, config := range processesConfig.Processes {
+    if config.Id == "" {
+      configError.EmptyIds++
+      continue
+    }
+    if _, exists := processMap[config.Id]; exists {
+      configError.DuplicateIds = append(configError.DuplicateIds, config.Id)
+      continue
+    }
+    processMap[config.Id] = config
+  }
+
+  for _, config := range processesConfig.Processes {
+    for _, dependency := range config.Dependencies {
+      if _, exists := processMap[dependency]; !exists {
+        configError.DanglingDependencies = append(configError.DanglingDependencies, DanglingDependency{config.Id, dependency})
+      }
+    }
+  }
+
+  configError.Cycles = findDependencyCycles(processesConfig.Processes, processMap)
+
+  if configError.EmptyIds > 0 || len(configError.DuplicateIds) > 0 || len(configError.DanglingDependencies) > 0 || len(configError.Cycles) > 0 {
+    return &configError
+  }
+  return nil
+}
+
+/*
+  DFS over the dependency graph, in config order, returning the path of every cycle found
+*/
+func findDependencyCycles(processes []ProcessConfig, processMap map[string]ProcessConfig) [][]string {
+  const (
+    unvisited = iota
+    visiting
+    done
+  )
+  var cycles [][]string
+  state := make(map[string]int)
+  var path []string
+
+  var visit func(id string)
+  visit = func(id string) {
+    switch state[id] {
+    case done:
+      return
+    case visiting:
+      // the cycle is the part of the current path starting at the first occurrence of id
+      for i, pathId := range path {
+        if pathId == id {
+          cycle := append([]string{}, path[i:]...)
+          cycles = append(cycles, append(cycle, id))
+          break
+        }
+      }
+      return
+    }
+
+    state[id] = visiting
+    path = append(path, id)
+    for _, dependency := range processMap[id].Dependencies {
+      if _, exists := processMap[dependency]; exists {
+        visit(dependency)
+      }
+    }
+    path = path[:len(path)-1]
+    state[id] = done
+  }
+
+  for _, config := range processes {
+    if _, exists := processMap[config.Id]; exists && state[config.Id] == unvisited {
+      visit(config.Id)
+    }
+  }
+  return cycles
+}
@@ -0,0 +1,130 @@
+package mkey
+
+import (
+  "bytes"
+  "crypto/rsa"
+  "crypto/x509"
+  "encoding/pem"
+  "fmt"
+  "github.com/MarconiProtocol/go-methereum-lite/accounts/keystore"
+  "github.com/MarconiProtocol/go-methereum-lite/crypto"
+  "github.com/pkg/errors"
+  "strings"
+)
+
+/*
+  Checks if the key material is a keystore JSON file, which is encrypted with its own password
+*/
+func IsKeystoreJSON(keyMaterial []byte) bool {
+  return bytes.HasPrefix(bytes.TrimSpace(keyMaterial), []byte("{"))
+}
+
+/*
+  Imports a GoMarconi key into a new account encrypted with password, the key is either a geth V3 keystore JSON that
+  is decrypted with keystorePassword, or a hex encoded secp256k1 private key
+*/
+func ImportAccount(keyMaterial []byte, keystorePassword string, password string) (*MarconiAccount, error) {
+  var key *keystore.Key
+  var err error
+  if IsKeystoreJSON(keyMaterial) {
+    key, err = keystore.DecryptKey(bytes.TrimSpace(keyMaterial), keystorePassword)
+    if err != nil {
+      return nil, errors.Wrap(err, "Failed to decrypt the keystore")
+    }
+  } else {
+    hexKey := strings.TrimPrefix(strings.TrimSpace(string(keyMaterial)), "0x")
+    privateKey, err := crypto.HexToECDSA(hexKey)
+    if err != nil {
+      return nil, errors.Wrap(err, "Failed to parse the key, expected a keystore JSON or a hex encoded secp256k1 private key")
+    }
+    key = keystore.NewKeyFromECDSA(privateKey)
+  }
+
+  return saveNewAccount(key, password)
+}
+
+/*
+  Imports a PEM encoded RSA private key, as written by savePrivateKey, as a MarconiKey of the account
+*/
+func (m *MarconiAccount) ImportMarconiKey(pemData []byte, password string) (*EncryptedMarconiKeyJSON, error) {
+  if len(m.MarconiKeys) >= MAX_MARCONI_PRIVATE_KEYS {
+    return nil, errors.New("Max number of Marconi Private Keys that can be stored in one account has been reached")
+  }
+
+  mpkey, err := parseMarconiKey(pemData)
+  if err != nil {
+    return nil, err
+  }
+  pubKeyHash, err := getInfohashByPubKey(&mpkey.PublicKey)
+  if err != nil {
+    return nil, err
+  }
+  for _, marconiKey := range m.MarconiKeys {
+    if marconiKey.PublicKeyHash == pubKeyHash {
+      return nil, errors.New(fmt.Sprintf("The nodekey %s is already in the account", AddPrefixPubKeyHash(pubKeyHash)))
+    }
+  }
+  encryptedMPKeyJson, err := encryptMarconiKey(mpkey, password)
+  if err != nil {
+    return nil, err
+  }
+
+  m.MarconiKeys = append(m.MarconiKeys, *encryptedMPKeyJson)
+  if err := m.saveAccount(); err != nil {
+    return nil, err
+  }
+  return encryptedMPKeyJson, nil
+}
+
+/*
+  Saves the GoMarconi key as a new account encrypted with password, unless there already is an account for its address
+*/
+func saveNewAccount(key *keystore.Key, password string) (*MarconiAccount, error) {
+  address := key.Address.Hex()
+  if _, err := GetAccountForAddress(address); err == nil {
+    return nil, errors.New(fmt.Sprintf("An account with address %s already exists", address))
+  }
+  // Encrypt the key into an encrypted JSON format, with the password of the account
+  keyJSON, err := encryptGoMarconiKey(key, password)
+  if err != nil {
+    return nil, err
+  }
+
+  mAccount := &MarconiAccount{}
+  mAccount.filename = generateMarconiAccountFilename(keyJSON.Address)
+  mAccount.GMrcKeystore = *keyJSON
+  mAccount.MarconiKeys = []EncryptedMarconiKeyJSON{}
+  if err := mAccount.saveAccount(); err != nil {
+    return nil, err
+  }
+  return mAccount, nil
+}
+
+/*
+  Parses a PEM encoded RSA private key, in PKCS #1 form as written by savePrivateKey or in PKCS #8 form
+*/
+func parseMarconiKey(pemData []byte) (*rsa.PrivateKey, error) {
+  block, _ := pem.Decode(pemData)
+  if block == nil {
+    return nil, errors.New("Failed to parse the key, expected a PEM encoded RSA private key")
+  }
+  switch block.Type {
+  case "RSA PRIVATE KEY":
+    mpkey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+    if err != nil {
+      return nil, errors.Wrap(err, "Failed to parse the RSA private key")
+    }
+    return mpkey, nil
+  case "PRIVATE KEY":
+    key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+    if err != nil {
+      return nil, errors.Wrap(err, "Failed to parse the private key")
+    }
+    mpkey, ok := key.(*rsa.PrivateKey)
+    if !ok {
+      return nil, errors.New("The private key is not an RSA key")
+    }
+    return mpkey, nil
+  }
+  return nil, errors.New(fmt.Sprintf("Expected an RSA private key, not a PEM block of type %s", block.Type))
+}
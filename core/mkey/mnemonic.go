@@ -0,0 +1,150 @@
+package mkey
+
+import (
+  "crypto/ecdsa"
+  "crypto/hmac"
+  "crypto/sha512"
+  "encoding/binary"
+  "fmt"
+  "github.com/MarconiProtocol/go-methereum-lite/accounts/keystore"
+  "github.com/MarconiProtocol/go-methereum-lite/crypto"
+  "github.com/pkg/errors"
+  "github.com/tyler-smith/go-bip39"
+  "math/big"
+  "strconv"
+  "strings"
+)
+
+const (
+  MNEMONIC_ENTROPY_BITS = 256                // 24 words
+  GMRC_DERIVATION_PATH  = "m/44'/60'/0'/0/0" // the first account of the standard Ethereum path, see BIP-44
+  HARDENED_KEY_OFFSET   = 0x80000000
+  BIP32_MASTER_KEY_SALT = "Bitcoin seed"
+)
+
+/*
+  Generates a new BIP-39 mnemonic, the recovery phrase the GoMarconi key of an account is derived from
+*/
+func NewMnemonic() (string, error) {
+  entropy, err := bip39.NewEntropy(MNEMONIC_ENTROPY_BITS)
+  if err != nil {
+    return "", err
+  }
+  return bip39.NewMnemonic(entropy)
+}
+
+/*
+  Normalizes the whitespace and case of a mnemonic that was typed in, and checks its words and checksum
+*/
+func NormalizeMnemonic(mnemonic string) (string, error) {
+  normalized := strings.Join(strings.Fields(strings.ToLower(mnemonic)), " ")
+  if !bip39.IsMnemonicValid(normalized) {
+    return "", errors.New("Invalid recovery phrase, a word is misspelled or missing")
+  }
+  return normalized, nil
+}
+
+/*
+  Creates an account with the GoMarconi key derived from the mnemonic, the same mnemonic always gives the same
+  account, which is how an account is recovered
+*/
+func CreateAccountFromMnemonic(mnemonic string, password string) (*MarconiAccount, error) {
+  normalized, err := NormalizeMnemonic(mnemonic)
+  if err != nil {
+    return nil, err
+  }
+  privateKey, err := deriveGoMarconiKey(normalized, "", GMRC_DERIVATION_PATH)
+  if err != nil {
+    return nil, err
+  }
+  return saveNewAccount(keystore.NewKeyFromECDSA(privateKey), password)
+}
+
+/*
+  Derives a secp256k1 key from the seed of the mnemonic along the BIP-32 path
+*/
+func deriveGoMarconiKey(mnemonic string, passphrase string, path string) (*ecdsa.PrivateKey, error) {
+  seed, err := bip39.NewSeedWithErrorChecking(mnemonic, passphrase)
+  if err != nil {
+    return nil, err
+  }
+  indexes, err := parseDerivationPath(path)
+  if err != nil {
+    return nil, err
+  }
+  key, chainCode := newMasterKey(seed)
+  for _, index := range indexes {
+    if key, chainCode, err = deriveChildKey(key, chainCode, index); err != nil {
+      return nil, err
+    }
+  }
+  return crypto.ToECDSA(key)
+}
+
+/*
+  Parses a BIP-32 path, ie. m/44'/60'/0'/0/0, where ' marks a hardened index
+*/
+func parseDerivationPath(path string) ([]uint32, error) {
+  components := strings.Split(path, "/")
+  if components[0] != "m" {
+    return nil, errors.New(fmt.Sprintf("Invalid derivation path %s, expected it to start with m", path))
+  }
+  var indexes []uint32
+  for _, component := range components[1:] {
+    offset := uint32(0)
+    if strings.HasSuffix(component, "'") {
+      offset = HARDENED_KEY_OFFSET
+      component = strings.TrimSuffix(component, "'")
+    }
+    index, err := strconv.ParseUint(component, 10, 32)
+    if err != nil || index >= HARDENED_KEY_OFFSET {
+      return nil, errors.New(fmt.Sprintf("Invalid derivation path %s", path))
+    }
+    indexes = append(indexes, uint32(index)+offset)
+  }
+  return indexes, nil
+}
+
+func newMasterKey(seed []byte) ([]byte, []byte) {
+  mac := hmac.New(sha512.New, []byte(BIP32_MASTER_KEY_SALT))
+  mac.Write(seed)
+  sum := mac.Sum(nil)
+  return sum[:32], sum[32:]
+}
+
+/*
+  Derives the private child key at the index from the private parent key, see BIP-32
+*/
+func deriveChildKey(key []byte, chainCode []byte, index uint32) ([]byte, []byte, error) {
+  var data []byte
+  if index >= HARDENED_KEY_OFFSET {
+    data = append([]byte{0}, key...)
+  } else {
+    parent, err := crypto.ToECDSA(key)
+    if err != nil {
+      return nil, nil, err
+    }
+    data = crypto.CompressPubkey(&parent.PublicKey)
+  }
+  data = append(data, make([]byte, 4)...)
+  binary.BigEndian.PutUint32(data[len(data)-4:], index)
+
+  mac := hmac.New(sha512.New, chainCode)
+  mac.Write(data)
+  sum := mac.Sum(nil)
+
+  // the child key is the parent key plus the left half of the hmac, which is invalid with a chance of about 1 in 2^127
+  n := crypto.S256().Params().N
+  tweak := new(big.Int).SetBytes(sum[:32])
+  if tweak.Cmp(n) >= 0 {
+    return nil, nil, errors.New(fmt.Sprintf("Invalid child key at index %d", index))
+  }
+  child := tweak.Add(tweak, new(big.Int).SetBytes(key))
+  child.Mod(child, n)
+  if child.Sign() == 0 {
+    return nil, nil, errors.New(fmt.Sprintf("Invalid child key at index %d", index))
+  }
+  childKey := make([]byte, 32)
+  child.FillBytes(childKey)
+  return childKey, sum[32:], nil
+}
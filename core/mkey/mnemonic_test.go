@@ -0,0 +1,144 @@
+package mkey
+
+import (
+  "encoding/hex"
+  "github.com/MarconiProtocol/go-methereum-lite/crypto"
+  "github.com/tyler-smith/go-bip39"
+  "strings"
+  "testing"
+)
+
+// entropy, mnemonic and seed with the passphrase TREZOR, from the BIP-39 test vectors
+var bip39Vectors = [][3]string{
+  {
+    "00000000000000000000000000000000",
+    "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+    "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+  },
+  {
+    "7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+    "legal winner thank year wave sausage worth useful legal winner thank yellow",
+    "2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+  },
+  {
+    "80808080808080808080808080808080",
+    "letter advice cage absurd amount doctor acoustic avoid letter advice cage above",
+    "d71de856f81a8acc65e6fc851a38d4d7ec216fd0796d0a6827a3ad6ed5511a30fa280f12eb2e47ed2ac03b5c462a0358d18d69fe4f985ec81778c1b370b652a8",
+  },
+  {
+    "ffffffffffffffffffffffffffffffff",
+    "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+    "ac27495480225222079d7be181583751e86f571027b0497b5b5d11218e0a8a13332572917f0f8e5a589620c6f15b11c61dee327651a14c34e18231052e48c069",
+  },
+  {
+    "9e885d952ad362caeb4efe34a8e91bd2",
+    "ozone drill grab fiber curtain grace pudding thank cruise elder eight picnic",
+    "274ddc525802f7c828d8ef7ddbcdc5304e87ac3535913611fbbfa986d0c9e5476c91689f9c8a54fd55bd38606aa6a8595ad213d4c9c9f9aca3fb217069a41028",
+  },
+  {
+    "0000000000000000000000000000000000000000000000000000000000000000",
+    "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art",
+    "bda85446c68413707090a52022edd26a1c9462295029f2e60cd7c4f2bbd3097170af7a4d73245cafa9c3cca8d561a7c3de6f5d4a10be8ed2a5e608d68f92fcc8",
+  },
+}
+
+func TestBip39Vectors(t *testing.T) {
+  for _, vector := range bip39Vectors {
+    entropy, _ := hex.DecodeString(vector[0])
+    mnemonic, err := bip39.NewMnemonic(entropy)
+    if err != nil || mnemonic != vector[1] {
+      t.Errorf("entropy %s gave the mnemonic %q, %v", vector[0], mnemonic, err)
+      continue
+    }
+    normalized, err := NormalizeMnemonic(strings.ToUpper(mnemonic) + "\n")
+    if err != nil || normalized != mnemonic {
+      t.Errorf("%q was normalized to %q, %v", mnemonic, normalized, err)
+    }
+    seed, err := bip39.NewSeedWithErrorChecking(mnemonic, "TREZOR")
+    if err != nil || hex.EncodeToString(seed) != vector[2] {
+      t.Errorf("%q gave the seed %x, %v", mnemonic, seed, err)
+    }
+  }
+}
+
+// path, chain code and private key of the derivations of BIP-32 test vector 1
+var bip32Vector1 = [][3]string{
+  {"m", "873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508", "e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35"},
+  {"m/0'", "47fdacbd0f1097043b78c63c20c34ef4ed9a111d980047ad16282c7ae6236141", "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea"},
+  {"m/0'/1", "2a7857631386ba23dacac34180dd1983734e444fdbf774041578e9b6adb37c19", "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368"},
+  {"m/0'/1/2'", "04466b9cc8e161e966409ca52986c584f07e9dc81f735db683c3ff6ec7b1503f", "cbce0d719ecf7431d88e6a89fa1483e02e35092af60c042b1df2ff59fa424dca"},
+  {"m/0'/1/2'/2", "cfb71883f01676f587d023cc53a35bc7f88f724b1f8c2892ac1275ac822a3edd", "0f479245fb19a38a1954c5c7c0ebab2f9bdfd96a17563ef28a6a4b1a2a764ef4"},
+  {"m/0'/1/2'/2/1000000000", "c783e67b921d2beb8f6b389cc646d7263b4145701dadd2161548a8b078e65e9e", "471b76e389e528d6de6d816857e012c5455051cad6660850e58372a6c3e6e7c8"},
+}
+
+func TestBip32Vector1(t *testing.T) {
+  seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+  for _, vector := range bip32Vector1 {
+    indexes, err := parseDerivationPath(vector[0])
+    if err != nil {
+      t.Fatal(err)
+    }
+    key, chainCode := newMasterKey(seed)
+    for _, index := range indexes {
+      if key, chainCode, err = deriveChildKey(key, chainCode, index); err != nil {
+        t.Fatal(err)
+      }
+    }
+    if hex.EncodeToString(chainCode) != vector[1] || hex.EncodeToString(key) != vector[2] {
+      t.Errorf("%s derived the chain code %x and key %x", vector[0], chainCode, key)
+    }
+  }
+}
+
+func TestDeriveEthereumAddress(t *testing.T) {
+  mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+  key, err := deriveGoMarconiKey(mnemonic, "", GMRC_DERIVATION_PATH)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if privateKey := hex.EncodeToString(crypto.FromECDSA(key)); privateKey != "1ab42cc412b618bdea3a599e3c9bae199ebf030895b039e9db1e30dafb12b727" {
+    t.Errorf("derived the private key %s", privateKey)
+  }
+  if address := crypto.PubkeyToAddress(key.PublicKey).Hex(); !strings.EqualFold(address, "0x9858EfFD232B4033E47d90003D41EC34EcaEda94") {
+    t.Errorf("derived the address %s", address)
+  }
+}
+
+func TestInvalidMnemonics(t *testing.T) {
+  for _, mnemonic := range []string{
+    // the checksum of the last word doesn't match
+    "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+    // not a word of the list
+    "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon marconi",
+    // a word is missing
+    "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+    "",
+  } {
+    if _, err := NormalizeMnemonic(mnemonic); err == nil {
+      t.Errorf("expected %q to be invalid", mnemonic)
+    }
+    if _, err := deriveGoMarconiKey(mnemonic, "", GMRC_DERIVATION_PATH); err == nil {
+      t.Errorf("expected no key to be derived from %q", mnemonic)
+    }
+  }
+}
+
+func TestInvalidDerivationPaths(t *testing.T) {
+  for _, path := range []string{
+    "44'/60'/0'/0/0",
+    "m/44'/x/0'",
+    "m/44'/60'/'",
+    "m//0",
+    "m/2147483648",
+    "m/2147483648'",
+    "m/-1",
+  } {
+    if _, err := parseDerivationPath(path); err == nil {
+      t.Errorf("expected %s to be invalid", path)
+    }
+  }
+  indexes, err := parseDerivationPath("m/2147483647'/0")
+  if err != nil || len(indexes) != 2 || indexes[0] != 0xffffffff || indexes[1] != 0 {
+    t.Errorf("m/2147483647'/0 was parsed to %v, %v", indexes, err)
+  }
+}
@@ -0,0 +1,354 @@
+package packages
+
+import (
+  "archive/tar"
+  "encoding/json"
+  "fmt"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "io"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+  "time"
+)
+
+const (
+  BUNDLE_INDEX_FILE    = "bundle.json"
+  BUNDLE_MANIFESTS_DIR = "manifests"
+  BUNDLE_PACKAGES_DIR  = "packages"
+)
+
+/*
+  The index of a bundle, the files in the bundle are found by the url they were downloaded from
+*/
+type bundleIndex struct {
+  Created  time.Time
+  Packages map[string]string // the version of each package in the bundle, by id
+  Files    map[string]string // the paths of the manifests, packages and signatures in the bundle, by url
+}
+
+/*
+  A tarball of packages and their manifests that packages are installed from instead of downloading them, so that
+  nodes without internet can be installed and upgraded, see CreateBundle
+*/
+type packageBundle struct {
+  filename string
+  index    bundleIndex
+}
+
+/*
+  A file that is written into a bundle
+*/
+type bundleFile struct {
+  path      string // in the bundle
+  localPath string
+}
+
+/*
+  Downloads and verifies the versions the packages would be updated to, with all packages at those versions, and
+  writes them into a bundle with their manifests and signatures
+  The manifests in the bundle only have the bundled releases, so that nodes installed from the bundle can't resolve
+  to versions that are not in it
+*/
+func (pm *PackageManager) CreateBundle(baseDir string, packagesConfig *configs.PackagesConfig, filename string) error {
+  d, err := newDownloader(packagesConfig)
+  if err != nil {
+    return err
+  }
+  var packages []*packageCandidates
+  for _, config := range packagesConfig.Packages {
+    manifest, err := getPackageManifest(d, baseDir, config)
+    if err != nil {
+      return fmt.Errorf("failed to get the manifest of package %s: %v", config.Id, err)
+    }
+    candidates, err := getCandidates(baseDir, packagesConfig, config, manifest)
+    if err != nil {
+      return err
+    }
+    // versions that are only kept locally can't be bundled
+    var releases []configs.PackageRelease
+    for _, release := range candidates.releases {
+      if release.Source != "" {
+        releases = append(releases, release)
+      }
+    }
+    candidates.releases = releases
+    packages = append(packages, candidates)
+  }
+  resolved, err := resolveVersions(packages)
+  if err != nil {
+    return err
+  }
+
+  // downloaded next to the bundle, not into the packages of this node
+  tempDir, err := ioutil.TempDir(filepath.Dir(filename), ".mcli-bundle-")
+  if err != nil {
+    return err
+  }
+  defer removeDir(tempDir)
+  var downloads []packageUpdate
+  for _, p := range packages {
+    downloads = append(downloads, packageUpdate{p.config, resolved[p.config.Id]})
+  }
+  downloaded, errs := downloadReleases(d, tempDir, downloads)
+  for _, download := range downloads {
+    if err := errs[download.config.Id]; err != nil {
+      return err
+    }
+  }
+
+  index := bundleIndex{Created: time.Now().UTC(), Packages: make(map[string]string), Files: make(map[string]string)}
+  var files []bundleFile
+  baseConfig := configs.LoadBaseConf()
+  for _, download := range downloads {
+    config, release := download.config, download.release
+    packageFile := downloaded[config.Id]
+    packagePath := filepath.Join(BUNDLE_PACKAGES_DIR, config.Id, filepath.Base(packageFile))
+    index.Packages[config.Id] = release.Version
+    index.Files[release.Source] = packagePath
+    files = append(files, bundleFile{packagePath, packageFile})
+
+    // nodes that don't allow unsigned packages need the signature, even if this one does
+    signatureSource := getSignatureSource(&release)
+    signatureFile := packageFile + SIGNATURE_FILE_EXT
+    if err := d.downloadFile(signatureFile, getDownloadSources(signatureSource, config.Mirrors), nil); err == nil {
+      index.Files[signatureSource] = packagePath + SIGNATURE_FILE_EXT
+      files = append(files, bundleFile{packagePath + SIGNATURE_FILE_EXT, signatureFile})
+    } else if len(baseConfig.PackageSigningKeys) > 0 || !baseConfig.AllowUnsignedPackages {
+      return err
+    } else {
+      fmt.Println("Warning: package", config.Id, "has no signature, the bundle can only be installed where AllowUnsignedPackages is set")
+    }
+
+    manifestFile := filepath.Join(tempDir, config.Id+".json")
+    content, err := json.MarshalIndent(configs.PackageManifest{PackageRelease: release}, "", " ")
+    if err != nil {
+      return err
+    }
+    if err := ioutil.WriteFile(manifestFile, content, 0644); err != nil {
+      return err
+    }
+    manifestPath := filepath.Join(BUNDLE_MANIFESTS_DIR, config.Id+".json")
+    index.Files[config.Manifest] = manifestPath
+    files = append(files, bundleFile{manifestPath, manifestFile})
+  }
+
+  // written under another name first, so that an existing bundle is only replaced by a complete one
+  partFilename := filename + PART_FILE_EXT
+  if err := writeBundle(partFilename, &index, files); err != nil {
+    removeFile(partFilename)
+    return err
+  }
+  if err := os.Rename(partFilename, filename); err != nil {
+    return err
+  }
+
+  ids := make([]string, 0, len(index.Packages))
+  for id := range index.Packages {
+    ids = append(ids, id)
+  }
+  sort.Strings(ids)
+  for _, id := range ids {
+    fmt.Println("Bundled package", id, "version", index.Packages[id])
+  }
+  return nil
+}
+
+/*
+  Installs and updates the packages from the bundle instead of downloading them, see updatePackages
+*/
+func (pm *PackageManager) UpdatePackagesFromBundle(baseDir string, packagesConfig *configs.PackagesConfig, filename string) {
+  d, err := newDownloader(packagesConfig)
+  if err != nil {
+    handleErr(err)
+  }
+  if d.bundle, err = openBundle(filename); err != nil {
+    handleErr(err)
+  }
+  fmt.Printf("Installing packages from the bundle created at %s: %v\n", d.bundle.index.Created.Format(time.RFC3339), d.bundle)
+  updatePackages(d, baseDir, packagesConfig)
+}
+
+/*
+  Writes the index and the files into a bundle, the index comes first so that it is found quickly
+*/
+func writeBundle(filename string, index *bundleIndex, files []bundleFile) error {
+  file, err := os.Create(filename)
+  if err != nil {
+    return err
+  }
+  defer file.Close()
+  tarWriter := tar.NewWriter(file)
+
+  content, err := json.MarshalIndent(index, "", " ")
+  if err != nil {
+    return err
+  }
+  header := &tar.Header{Name: BUNDLE_INDEX_FILE, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content)), ModTime: index.Created}
+  if err := tarWriter.WriteHeader(header); err != nil {
+    return err
+  }
+  if _, err := tarWriter.Write(content); err != nil {
+    return err
+  }
+  for _, bundled := range files {
+    if err := writeBundleFile(tarWriter, bundled, index.Created); err != nil {
+      return err
+    }
+  }
+  if err := tarWriter.Close(); err != nil {
+    return err
+  }
+  return file.Close()
+}
+
+func writeBundleFile(tarWriter *tar.Writer, bundled bundleFile, modTime time.Time) error {
+  file, err := os.Open(bundled.localPath)
+  if err != nil {
+    return err
+  }
+  defer file.Close()
+  info, err := file.Stat()
+  if err != nil {
+    return err
+  }
+  header := &tar.Header{Name: filepath.ToSlash(bundled.path), Typeflag: tar.TypeReg, Mode: 0644, Size: info.Size(), ModTime: modTime}
+  if err := tarWriter.WriteHeader(header); err != nil {
+    return err
+  }
+  _, err = io.Copy(tarWriter, file)
+  return err
+}
+
+func openBundle(filename string) (*packageBundle, error) {
+  bundle := &packageBundle{filename: filename}
+  reader, _, err := bundle.open(BUNDLE_INDEX_FILE)
+  if err != nil {
+    return nil, fmt.Errorf("%s is not a package bundle: %v", filename, err)
+  }
+  defer reader.Close()
+  content, err := ioutil.ReadAll(io.LimitReader(reader, MAX_MANIFEST_SIZE))
+  if err != nil {
+    return nil, err
+  }
+  if err := json.Unmarshal(content, &bundle.index); err != nil {
+    return nil, fmt.Errorf("%s is not a package bundle: %v", filename, err)
+  }
+  return bundle, nil
+}
+
+/*
+  Opens a file in the bundle, it is found by reading through the headers of the bundle, which skips over the content
+  of the files before it
+*/
+func (b *packageBundle) open(path string) (io.ReadCloser, int64, error) {
+  file, err := os.Open(b.filename)
+  if err != nil {
+    return nil, 0, err
+  }
+  tarReader := tar.NewReader(file)
+  for {
+    header, err := tarReader.Next()
+    if err == io.EOF {
+      file.Close()
+      return nil, 0, fmt.Errorf("%s is missing from the bundle", path)
+    }
+    if err != nil {
+      file.Close()
+      return nil, 0, err
+    }
+    if header.Typeflag == tar.TypeReg && header.Name == path {
+      return struct {
+        io.Reader
+        io.Closer
+      }{tarReader, file}, header.Size, nil
+    }
+  }
+}
+
+/*
+  Returns the path in the bundle of the first of the sources that is in it
+*/
+func (b *packageBundle) find(sources []string) (string, error) {
+  for _, source := range sources {
+    if path, exists := b.index.Files[source]; exists {
+      return path, nil
+    }
+  }
+  return "", fmt.Errorf("%s is not in the bundle %s", sources[0], b.filename)
+}
+
+func (b *packageBundle) readManifest(sources []string) (*configs.PackageManifest, error) {
+  path, err := b.find(sources)
+  if err != nil {
+    return nil, err
+  }
+  reader, _, err := b.open(path)
+  if err != nil {
+    return nil, err
+  }
+  defer reader.Close()
+  content, err := ioutil.ReadAll(io.LimitReader(reader, MAX_MANIFEST_SIZE))
+  if err != nil {
+    return nil, err
+  }
+  manifest := configs.PackageManifest{}
+  if err := json.Unmarshal(content, &manifest); err != nil {
+    return nil, fmt.Errorf("Failed to parse manifest file: %s - Err: %v", path, err)
+  }
+  return &manifest, nil
+}
+
+/*
+  Copies a file out of the bundle, into a .part file that is renamed to filename once it is complete
+*/
+func (b *packageBundle) copyFile(filename string, sources []string, bar *progressBar) error {
+  path, err := b.find(sources)
+  if err == nil {
+    err = b.copyPart(filename+PART_FILE_EXT, path, bar)
+  }
+  if bar != nil {
+    bar.finish(err)
+  }
+  if err != nil {
+    return fmt.Errorf("Failed to copy file: %s from the bundle: %v", filename, err)
+  }
+  return os.Rename(filename+PART_FILE_EXT, filename)
+}
+
+func (b *packageBundle) copyPart(partFilename string, path string, bar *progressBar) error {
+  reader, size, err := b.open(path)
+  if err != nil {
+    return err
+  }
+  defer reader.Close()
+  file, err := os.Create(partFilename)
+  if err != nil {
+    return err
+  }
+  defer file.Close()
+
+  var writer io.Writer = file
+  if bar != nil {
+    bar.begin(0, size)
+    writer = io.MultiWriter(file, bar)
+  }
+  if _, err := io.Copy(writer, reader); err != nil {
+    return err
+  }
+  return file.Close()
+}
+
+/*
+  Lists the packages in the bundle, ie. package_id 0.1.2
+*/
+func (b *packageBundle) String() string {
+  var packages []string
+  for id, version := range b.index.Packages {
+    packages = append(packages, id+" "+version)
+  }
+  sort.Strings(packages)
+  return strings.Join(packages, ", ")
+}
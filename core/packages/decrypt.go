@@ -0,0 +1,174 @@
+package packages
+
+import (
+  "bytes"
+  "crypto/aes"
+  "crypto/cipher"
+  "crypto/md5"
+  "crypto/sha256"
+  "errors"
+  "fmt"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "hash"
+  "io"
+  "os"
+)
+
+const (
+  // TODO: the packages are encrypted with a shared passphrase until they are served over an authenticated channel
+  PACKAGE_PASSPHRASE = "FKteu_rPb}95Mr,%"
+
+  DIGEST_SHA256 = "sha256"
+  DIGEST_MD5    = "md5"
+
+  OPENSSL_SALT_HEADER = "Salted__"
+  OPENSSL_SALT_LENGTH = 8
+  AES_256_KEY_LENGTH  = 32
+  DECRYPT_CHUNK_SIZE  = 32 * 1024
+)
+
+/*
+  Opens a downloaded package for reading, decrypting it while it is read if the package is encrypted
+*/
+func openPackage(filename string, config configs.PackageConfig) (io.ReadCloser, error) {
+  file, err := os.Open(filename)
+  if err != nil {
+    return nil, err
+  }
+  if !config.IsEncrypted {
+    return file, nil
+  }
+
+  digest, err := getEncryptionDigest(config.EncryptionDigest)
+  if err != nil {
+    file.Close()
+    return nil, err
+  }
+  reader, err := newDecryptReader(file, PACKAGE_PASSPHRASE, digest)
+  if err != nil {
+    file.Close()
+    return nil, fmt.Errorf("failed to decrypt %s: %v", filename, err)
+  }
+  return struct {
+    io.Reader
+    io.Closer
+  }{reader, file}, nil
+}
+
+func getEncryptionDigest(name string) (func() hash.Hash, error) {
+  switch name {
+  case "", DIGEST_SHA256:
+    return sha256.New, nil
+  case DIGEST_MD5:
+    return md5.New, nil
+  }
+  return nil, fmt.Errorf("unsupported EncryptionDigest %s, it should be %s or %s", name, DIGEST_SHA256, DIGEST_MD5)
+}
+
+/*
+  Decrypts the output of `openssl enc -aes-256-cbc` as it is read, the key and iv are derived from the passphrase
+  and the salt in the header with EVP_BytesToKey, the digest is md5 before openssl 1.1.0 and sha256 since
+*/
+type decryptReader struct {
+  source    io.Reader
+  mode      cipher.BlockMode
+  chunk     []byte
+  plaintext []byte // decrypted bytes that haven't been read yet
+  lastBlock []byte // the last decrypted block is held back until it is known whether it is padded
+  done      bool
+}
+
+func newDecryptReader(source io.Reader, passphrase string, digest func() hash.Hash) (io.Reader, error) {
+  header := make([]byte, len(OPENSSL_SALT_HEADER)+OPENSSL_SALT_LENGTH)
+  if _, err := io.ReadFull(source, header); err != nil {
+    return nil, errors.New("the file is too short to be encrypted")
+  }
+  if string(header[:len(OPENSSL_SALT_HEADER)]) != OPENSSL_SALT_HEADER {
+    return nil, errors.New("the file is not encrypted with a salted openssl passphrase")
+  }
+  key, iv := evpBytesToKey(digest, []byte(passphrase), header[len(OPENSSL_SALT_HEADER):], AES_256_KEY_LENGTH, aes.BlockSize)
+
+  block, err := aes.NewCipher(key)
+  if err != nil {
+    return nil, err
+  }
+  return &decryptReader{
+    source: source,
+    mode:   cipher.NewCBCDecrypter(block, iv),
+    chunk:  make([]byte, DECRYPT_CHUNK_SIZE),
+  }, nil
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+  for len(r.plaintext) == 0 {
+    if r.done {
+      return 0, io.EOF
+    }
+    if err := r.decryptChunk(); err != nil {
+      return 0, err
+    }
+  }
+  n := copy(p, r.plaintext)
+  r.plaintext = r.plaintext[n:]
+  return n, nil
+}
+
+func (r *decryptReader) decryptChunk() error {
+  n, err := io.ReadFull(r.source, r.chunk)
+  last := err == io.EOF || err == io.ErrUnexpectedEOF
+  if err != nil && !last {
+    return err
+  }
+  if n%aes.BlockSize != 0 {
+    return errors.New("the encrypted data is truncated")
+  }
+
+  decrypted := r.chunk[:n]
+  r.mode.CryptBlocks(decrypted, decrypted)
+  plaintext := append(r.lastBlock, decrypted...)
+  if last {
+    r.done = true
+    r.lastBlock = nil
+    unpadded, err := removePkcs7Padding(plaintext)
+    if err != nil {
+      return err
+    }
+    r.plaintext = unpadded
+    return nil
+  }
+  // the chunk is reused by the next read, so the held back block is copied
+  r.lastBlock = append([]byte(nil), plaintext[len(plaintext)-aes.BlockSize:]...)
+  r.plaintext = append([]byte(nil), plaintext[:len(plaintext)-aes.BlockSize]...)
+  return nil
+}
+
+/*
+  An invalid padding almost always means that the passphrase or the digest is wrong
+*/
+func removePkcs7Padding(plaintext []byte) ([]byte, error) {
+  if len(plaintext) == 0 {
+    return nil, errors.New("the encrypted data is empty")
+  }
+  padding := int(plaintext[len(plaintext)-1])
+  if padding == 0 || padding > aes.BlockSize || padding > len(plaintext) ||
+    !bytes.Equal(plaintext[len(plaintext)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+    return nil, errors.New("bad decrypt, the passphrase or the EncryptionDigest of the package is wrong")
+  }
+  return plaintext[:len(plaintext)-padding], nil
+}
+
+/*
+  EVP_BytesToKey of openssl with an iteration count of 1
+*/
+func evpBytesToKey(digest func() hash.Hash, passphrase []byte, salt []byte, keyLength int, ivLength int) ([]byte, []byte) {
+  var derived, previous []byte
+  for len(derived) < keyLength+ivLength {
+    h := digest()
+    h.Write(previous)
+    h.Write(passphrase)
+    h.Write(salt)
+    previous = h.Sum(nil)
+    derived = append(derived, previous...)
+  }
+  return derived[:keyLength], derived[keyLength : keyLength+ivLength]
+}
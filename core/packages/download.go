@@ -0,0 +1,333 @@
+package packages
+
+import (
+  "encoding/json"
+  "errors"
+  "fmt"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "io"
+  "io/ioutil"
+  "net/http"
+  "net/url"
+  "os"
+  "strconv"
+  "strings"
+  "time"
+)
+
+const (
+  PART_FILE_EXT = ".part"
+
+  DOWNLOAD_ATTEMPTS        = 5
+  DOWNLOAD_BACKOFF         = 1 * time.Second
+  DOWNLOAD_BACKOFF_MAX     = 30 * time.Second
+  DOWNLOAD_CONNECT_TIMEOUT = 30 * time.Second
+  MAX_CONCURRENT_DOWNLOADS = 3
+  MAX_MANIFEST_SIZE        = 1024 * 1024
+)
+
+/*
+  Downloads files over http, resuming interrupted downloads and falling back to mirrors
+*/
+type downloader struct {
+  client     *http.Client
+  attempts   int           // attempts per source
+  backoff    time.Duration // delay before the second attempt, doubled for every attempt after that
+  backoffMax time.Duration
+  display    *progressDisplay // set while downloads are in progress, messages are printed through it
+  bundle     *packageBundle   // files are copied out of the bundle instead of downloaded if set
+}
+
+/*
+  An error that retrying the same source won't fix, ie. a 404
+*/
+type permanentDownloadError struct {
+  err error
+}
+
+func (e permanentDownloadError) Error() string {
+  return e.err.Error()
+}
+
+/*
+  Creates a downloader using the proxy of the packages config, or the proxy of the environment (HTTPS_PROXY,
+  HTTP_PROXY and NO_PROXY) if none is configured
+*/
+func newDownloader(packagesConfig *configs.PackagesConfig) (*downloader, error) {
+  proxy := http.ProxyFromEnvironment
+  if packagesConfig != nil && packagesConfig.Proxy != "" {
+    proxyUrl, err := url.Parse(packagesConfig.Proxy)
+    if err != nil || proxyUrl.Host == "" {
+      return nil, fmt.Errorf("invalid Proxy %s in the packages config", packagesConfig.Proxy)
+    }
+    proxy = http.ProxyURL(proxyUrl)
+  }
+  transport := http.DefaultTransport.(*http.Transport).Clone()
+  transport.Proxy = proxy
+  transport.ResponseHeaderTimeout = DOWNLOAD_CONNECT_TIMEOUT
+
+  return &downloader{
+    client:     &http.Client{Transport: transport},
+    attempts:   DOWNLOAD_ATTEMPTS,
+    backoff:    DOWNLOAD_BACKOFF,
+    backoffMax: DOWNLOAD_BACKOFF_MAX,
+  }, nil
+}
+
+/*
+  Returns the source followed by the same path on each of the mirrors
+  A mirror is a base url that replaces the scheme and host of the source, ie. https://mirror.example.com/marconi
+*/
+func getDownloadSources(source string, mirrors []string) []string {
+  sources := []string{source}
+  sourceUrl, err := url.Parse(source)
+  if err != nil {
+    return sources
+  }
+  for _, mirror := range mirrors {
+    mirrorUrl, err := url.Parse(mirror)
+    if err != nil || mirrorUrl.Host == "" {
+      fmt.Println("Ignoring invalid mirror:", mirror)
+      continue
+    }
+    mirrorUrl.Path = strings.TrimSuffix(mirrorUrl.Path, "/") + sourceUrl.Path
+    mirrorUrl.RawPath = ""
+    mirrorUrl.RawQuery = sourceUrl.RawQuery
+    sources = append(sources, mirrorUrl.String())
+  }
+  return sources
+}
+
+/*
+  Download manifest file from the first of the sources that works
+*/
+func (d *downloader) downloadManifest(sources []string) (*configs.PackageManifest, error) {
+  if d.bundle != nil {
+    return d.bundle.readManifest(sources)
+  }
+  source := sources[0]
+  var content []byte
+  var errs []string
+  for _, source := range sources {
+    err := d.retry(source, func() error {
+      response, err := d.get(source, 0)
+      if err != nil {
+        return err
+      }
+      defer response.Body.Close()
+      content, err = ioutil.ReadAll(io.LimitReader(response.Body, MAX_MANIFEST_SIZE))
+      return err
+    })
+    if err == nil {
+      break
+    }
+    errs = append(errs, fmt.Sprintf("%s: %v", source, err))
+  }
+  if len(errs) == len(sources) {
+    return nil, fmt.Errorf("Failed to download manifest file: %s - Err: %s", source, strings.Join(errs, "; "))
+  }
+
+  manifest := configs.PackageManifest{}
+  if err := json.Unmarshal(content, &manifest); err != nil {
+    return nil, fmt.Errorf("Failed to parse manifest file: %s - Err: %v", source, err)
+  }
+  return &manifest, nil
+}
+
+/*
+  Downloads a file from the first of the sources that works, into a .part file that is renamed to filename once it
+  is complete, an interrupted download is resumed from where it stopped
+  The progress is shown on the bar, if one is given
+*/
+func (d *downloader) downloadFile(filename string, sources []string, bar *progressBar) error {
+  if d.bundle != nil {
+    return d.bundle.copyFile(filename, sources, bar)
+  }
+  partFilename := filename + PART_FILE_EXT
+  var errs []string
+  for _, source := range sources {
+    err := d.retry(source, func() error {
+      if bar != nil {
+        d.println("Downloading file from:", source)
+      }
+      return d.downloadPart(partFilename, source, bar)
+    })
+    if err == nil {
+      if bar != nil {
+        bar.finish(nil)
+      }
+      return os.Rename(partFilename, filename)
+    }
+    d.println("Failed to download from", source+":", err)
+    errs = append(errs, fmt.Sprintf("%s: %v", source, err))
+  }
+  if bar != nil {
+    bar.finish(errors.New("failed"))
+  }
+  return fmt.Errorf("Failed to download file: %s from any source (%s)", filename, strings.Join(errs, "; "))
+}
+
+/*
+  Calls download until it succeeds, with exponential backoff between the attempts
+*/
+func (d *downloader) retry(source string, download func() error) error {
+  backoff := d.backoff
+  var err error
+  for attempt := 1; attempt <= d.attempts; attempt++ {
+    if err = download(); err == nil {
+      return nil
+    }
+    if _, permanent := err.(permanentDownloadError); permanent || attempt == d.attempts {
+      break
+    }
+    d.println(fmt.Sprintf("Error downloading %s (attempt %d of %d): %v, retrying in %v...", source, attempt, d.attempts, err, backoff))
+    time.Sleep(backoff)
+    if backoff *= 2; backoff > d.backoffMax {
+      backoff = d.backoffMax
+    }
+  }
+  return err
+}
+
+/*
+  Prints a message, above the progress bars while there are downloads in progress
+*/
+func (d *downloader) println(a ...interface{}) {
+  if d.display != nil {
+    d.display.println(a...)
+  } else {
+    fmt.Println(a...)
+  }
+}
+
+/*
+  Appends the rest of the file to the part file, or downloads it from the start if the server doesn't support ranges
+*/
+func (d *downloader) downloadPart(partFilename string, source string, bar *progressBar) error {
+  file, err := os.OpenFile(partFilename, os.O_CREATE|os.O_WRONLY, 0644)
+  if err != nil {
+    return permanentDownloadError{err}
+  }
+  defer file.Close()
+  offset, err := file.Seek(0, io.SeekEnd)
+  if err != nil {
+    return permanentDownloadError{err}
+  }
+
+  response, err := d.get(source, offset)
+  if err != nil {
+    return err
+  }
+  defer response.Body.Close()
+
+  size := response.ContentLength
+  switch response.StatusCode {
+  case http.StatusPartialContent:
+    start, total, err := parseContentRange(response.Header.Get("Content-Range"))
+    if err != nil || start != offset {
+      // start over rather than risk a corrupted file
+      file.Truncate(0)
+      return fmt.Errorf("unexpected Content-Range %q", response.Header.Get("Content-Range"))
+    }
+    if total >= 0 {
+      size = total
+    } else if size >= 0 {
+      size += offset
+    }
+  case http.StatusRequestedRangeNotSatisfiable:
+    // the part file is already complete, or is not part of this file
+    if _, total, err := parseContentRange(response.Header.Get("Content-Range")); err == nil && total == offset {
+      if bar != nil {
+        bar.begin(offset, total)
+      }
+      return nil
+    }
+    file.Truncate(0)
+    return errors.New("the partial download doesn't match the file, starting over")
+  default:
+    // the whole file is sent
+    offset = 0
+    if err := file.Truncate(0); err != nil {
+      return permanentDownloadError{err}
+    }
+    if _, err := file.Seek(0, io.SeekStart); err != nil {
+      return permanentDownloadError{err}
+    }
+  }
+
+  var body io.Reader = response.Body
+  if bar != nil {
+    bar.begin(offset, size)
+    body = io.TeeReader(response.Body, bar)
+  }
+  written, err := io.Copy(file, body)
+  if err != nil {
+    return err
+  }
+  if size >= 0 && offset+written != size {
+    return fmt.Errorf("download ended after %d of %d bytes", offset+written, size)
+  }
+  return nil
+}
+
+/*
+  Sends a GET request, starting at offset if it is not 0, and checks the status of the response
+*/
+func (d *downloader) get(source string, offset int64) (*http.Response, error) {
+  request, err := http.NewRequest("GET", source, nil)
+  if err != nil {
+    return nil, permanentDownloadError{err}
+  }
+  if offset > 0 {
+    request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+  }
+
+  response, err := d.client.Do(request)
+  if err != nil {
+    return nil, err
+  }
+  switch {
+  case response.StatusCode == http.StatusOK, response.StatusCode == http.StatusPartialContent:
+    return response, nil
+  case response.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+    return response, nil
+  }
+  response.Body.Close()
+  err = fmt.Errorf("http response status: %s", response.Status)
+  // client errors other than timeouts and rate limiting won't go away by retrying
+  if response.StatusCode >= 400 && response.StatusCode < 500 &&
+    response.StatusCode != http.StatusRequestTimeout && response.StatusCode != http.StatusTooManyRequests {
+    return nil, permanentDownloadError{err}
+  }
+  return nil, err
+}
+
+/*
+  Parses the Content-Range header of a 206 or 416 response, see RFC 7233, start is -1 for an unsatisfied range
+  and total is -1 if it is unknown
+*/
+func parseContentRange(contentRange string) (int64, int64, error) {
+  if !strings.HasPrefix(contentRange, "bytes ") {
+    return 0, 0, fmt.Errorf("invalid Content-Range %q", contentRange)
+  }
+  parts := strings.SplitN(strings.TrimPrefix(contentRange, "bytes "), "/", 2)
+  if len(parts) != 2 {
+    return 0, 0, fmt.Errorf("invalid Content-Range %q", contentRange)
+  }
+
+  total := int64(-1)
+  if parts[1] != "*" {
+    var err error
+    if total, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+      return 0, 0, fmt.Errorf("invalid Content-Range %q", contentRange)
+    }
+  }
+  if parts[0] == "*" {
+    return -1, total, nil
+  }
+  start, err := strconv.ParseInt(strings.SplitN(parts[0], "-", 2)[0], 10, 64)
+  if err != nil {
+    return 0, 0, fmt.Errorf("invalid Content-Range %q", contentRange)
+  }
+  return start, total, nil
+}
@@ -0,0 +1,236 @@
+package packages
+
+import (
+  "bytes"
+  "io/ioutil"
+  "net/http"
+  "net/http/httptest"
+  "path/filepath"
+  "strings"
+  "sync"
+  "sync/atomic"
+  "testing"
+  "time"
+)
+
+var testPackageContent = []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+
+func newTestDownloader(t *testing.T) *downloader {
+  d, err := newDownloader(nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+  d.backoff = time.Millisecond
+  d.backoffMax = time.Millisecond
+  return d
+}
+
+/*
+  Serves the content with support for ranges, counting the requests
+*/
+func newRangeServer(requests *int32, ranges *[]string) *httptest.Server {
+  var mutex sync.Mutex
+  return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    atomic.AddInt32(requests, 1)
+    mutex.Lock()
+    *ranges = append(*ranges, r.Header.Get("Range"))
+    mutex.Unlock()
+    http.ServeContent(w, r, "package.tgz", time.Time{}, bytes.NewReader(testPackageContent))
+  }))
+}
+
+func writePartFile(t *testing.T, filename string, content []byte) {
+  if err := ioutil.WriteFile(filename+PART_FILE_EXT, content, 0644); err != nil {
+    t.Fatal(err)
+  }
+}
+
+func checkDownloadedFile(t *testing.T, filename string) {
+  content, err := ioutil.ReadFile(filename)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !bytes.Equal(content, testPackageContent) {
+    t.Fatalf("downloaded %q, expected %q", content, testPackageContent)
+  }
+}
+
+func TestDownloadResumesPartFile(t *testing.T) {
+  var requests int32
+  var ranges []string
+  server := newRangeServer(&requests, &ranges)
+  defer server.Close()
+  filename := filepath.Join(t.TempDir(), "package.tgz")
+  writePartFile(t, filename, testPackageContent[:10])
+
+  if err := newTestDownloader(t).downloadFile(filename, []string{server.URL}, nil); err != nil {
+    t.Fatal(err)
+  }
+  checkDownloadedFile(t, filename)
+  if len(ranges) != 1 || ranges[0] != "bytes=10-" {
+    t.Fatalf("expected a single request for bytes=10-, got %q", ranges)
+  }
+}
+
+func TestDownloadRestartsWhenRangeIsIgnored(t *testing.T) {
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    w.Write(testPackageContent)
+  }))
+  defer server.Close()
+  filename := filepath.Join(t.TempDir(), "package.tgz")
+  writePartFile(t, filename, []byte("not the start of the package"))
+
+  if err := newTestDownloader(t).downloadFile(filename, []string{server.URL}, nil); err != nil {
+    t.Fatal(err)
+  }
+  checkDownloadedFile(t, filename)
+}
+
+func TestDownloadCompletePartFile(t *testing.T) {
+  var requests int32
+  var ranges []string
+  server := newRangeServer(&requests, &ranges)
+  defer server.Close()
+  filename := filepath.Join(t.TempDir(), "package.tgz")
+  writePartFile(t, filename, testPackageContent)
+
+  if err := newTestDownloader(t).downloadFile(filename, []string{server.URL}, nil); err != nil {
+    t.Fatal(err)
+  }
+  checkDownloadedFile(t, filename)
+  if atomic.LoadInt32(&requests) != 1 || ranges[0] != "bytes=36-" {
+    t.Fatalf("expected the 416 for bytes=36- to complete the download, got %q", ranges)
+  }
+}
+
+func TestDownloadWrongContentRangeStartsOver(t *testing.T) {
+  var requests int32
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    atomic.AddInt32(&requests, 1)
+    if r.Header.Get("Range") != "" {
+      // the range of a different offset than requested
+      w.Header().Set("Content-Range", "bytes 0-9/36")
+      w.WriteHeader(http.StatusPartialContent)
+      w.Write(testPackageContent[:10])
+      return
+    }
+    w.Write(testPackageContent)
+  }))
+  defer server.Close()
+  filename := filepath.Join(t.TempDir(), "package.tgz")
+  writePartFile(t, filename, testPackageContent[:5])
+
+  if err := newTestDownloader(t).downloadFile(filename, []string{server.URL}, nil); err != nil {
+    t.Fatal(err)
+  }
+  checkDownloadedFile(t, filename)
+  if atomic.LoadInt32(&requests) != 2 {
+    t.Fatalf("expected the part file to be discarded and downloaded again, got %d requests", requests)
+  }
+}
+
+func TestDownloadNotFoundIsNotRetried(t *testing.T) {
+  var requests int32
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    atomic.AddInt32(&requests, 1)
+    http.NotFound(w, r)
+  }))
+  defer server.Close()
+  filename := filepath.Join(t.TempDir(), "package.tgz")
+
+  if err := newTestDownloader(t).downloadFile(filename, []string{server.URL}, nil); err == nil {
+    t.Fatal("expected the download to fail")
+  }
+  if atomic.LoadInt32(&requests) != 1 {
+    t.Fatalf("expected a 404 not to be retried, got %d requests", requests)
+  }
+}
+
+func TestDownloadRetriesServerErrors(t *testing.T) {
+  var requests int32
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if atomic.AddInt32(&requests, 1) <= 2 {
+      http.Error(w, "unavailable", http.StatusServiceUnavailable)
+      return
+    }
+    w.Write(testPackageContent)
+  }))
+  defer server.Close()
+  filename := filepath.Join(t.TempDir(), "package.tgz")
+
+  if err := newTestDownloader(t).downloadFile(filename, []string{server.URL}, nil); err != nil {
+    t.Fatal(err)
+  }
+  checkDownloadedFile(t, filename)
+  if atomic.LoadInt32(&requests) != 3 {
+    t.Fatalf("expected two retries, got %d requests", requests)
+  }
+}
+
+func TestDownloadGivesUpAfterAttempts(t *testing.T) {
+  var requests int32
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    atomic.AddInt32(&requests, 1)
+    http.Error(w, "unavailable", http.StatusServiceUnavailable)
+  }))
+  defer server.Close()
+  filename := filepath.Join(t.TempDir(), "package.tgz")
+
+  d := newTestDownloader(t)
+  d.attempts = 3
+  if err := d.downloadFile(filename, []string{server.URL}, nil); err == nil {
+    t.Fatal("expected the download to fail")
+  }
+  if atomic.LoadInt32(&requests) != 3 {
+    t.Fatalf("expected 3 attempts, got %d", requests)
+  }
+}
+
+func TestDownloadFallsBackToMirror(t *testing.T) {
+  source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    http.NotFound(w, r)
+  }))
+  defer source.Close()
+  var mirrorUrl string
+  mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    mirrorUrl = r.URL.String()
+    w.Write(testPackageContent)
+  }))
+  defer mirror.Close()
+
+  sources := getDownloadSources(source.URL+"/packages/package.tgz?version=0.1.2", []string{mirror.URL + "/marconi/", "not a mirror"})
+  if len(sources) != 2 || sources[1] != mirror.URL+"/marconi/packages/package.tgz?version=0.1.2" {
+    t.Fatalf("unexpected sources %q", sources)
+  }
+  filename := filepath.Join(t.TempDir(), "package.tgz")
+  if err := newTestDownloader(t).downloadFile(filename, sources, nil); err != nil {
+    t.Fatal(err)
+  }
+  checkDownloadedFile(t, filename)
+  if mirrorUrl != "/marconi/packages/package.tgz?version=0.1.2" {
+    t.Fatalf("the mirror was asked for %s", mirrorUrl)
+  }
+}
+
+func TestParseContentRange(t *testing.T) {
+  tests := []struct {
+    header string
+    start  int64
+    total  int64
+  }{
+    {"bytes 10-35/36", 10, 36},
+    {"bytes 10-35/*", 10, -1},
+    {"bytes */36", -1, 36},
+  }
+  for _, test := range tests {
+    start, total, err := parseContentRange(test.header)
+    if err != nil || start != test.start || total != test.total {
+      t.Errorf("parseContentRange(%q) = %d, %d, %v", test.header, start, total, err)
+    }
+  }
+  for _, header := range []string{"", "items 0-1/2", "bytes 0-1", "bytes x-1/2"} {
+    if _, _, err := parseContentRange(header); err == nil || !strings.Contains(err.Error(), "Content-Range") {
+      t.Errorf("expected %q to be invalid", header)
+    }
+  }
+}
@@ -0,0 +1,124 @@
+package packages
+
+import (
+  "crypto/sha256"
+  "encoding/hex"
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "time"
+)
+
+const (
+  // comma separated SHA-256 digests of the EULAs that are accepted without asking, the same as -accept-eula
+  ACCEPT_EULA_ENV = "MCLI_ACCEPT_EULA"
+
+  EULA_ACKNOWLEDGEMENTS_FILE = "etc/mcli/eula_acknowledgements.json"
+  MCLI_EULA_ID               = "mcli" // the EULA of mcli itself, next to the EULAs of the packages
+
+  ACCEPTED_BY_PROMPT = "prompt"
+  ACCEPTED_BY_DIGEST = "digest" // passed with -accept-eula or MCLI_ACCEPT_EULA
+)
+
+/*
+  The EULA that was accepted for mcli or a package, it is asked for again once the text of the EULA changes
+*/
+type eulaAcknowledgement struct {
+  Sha256     string
+  AcceptedAt time.Time
+  AcceptedBy string
+}
+
+/*
+  Accepts the EULAs with the SHA-256 digests without asking, the digests are hex encoded and separated by commas
+  Once digests are given, EULAs with other digests are declined instead of asked for, since nobody is there to answer
+*/
+func (pm *PackageManager) AcceptEulas(digests string) error {
+  accepted := make(map[string]bool)
+  for _, digest := range strings.Split(digests, ",") {
+    digest = strings.ToLower(strings.TrimSpace(digest))
+    if digest == "" {
+      continue
+    }
+    if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != sha256.Size {
+      return fmt.Errorf("invalid EULA digest %s, expected the hex encoded SHA-256 of the EULA text", digest)
+    }
+    accepted[digest] = true
+  }
+  if len(accepted) > 0 {
+    pm.acceptedEulas = accepted
+  }
+  return nil
+}
+
+func getEulaDigest(eulaText string) string {
+  digest := sha256.Sum256([]byte(eulaText))
+  return hex.EncodeToString(digest[:])
+}
+
+/*
+  Checks if the EULA with the digest was accepted for mcli or the package before
+*/
+func isEulaAcknowledged(baseDir string, id string, digest string) bool {
+  acknowledgement, exists := readEulaAcknowledgements(baseDir)[id]
+  return exists && acknowledgement.Sha256 == digest
+}
+
+/*
+  Accepts the EULA if its digest was passed, asks for it otherwise unless other digests were passed
+  Returns whether the EULA was accepted and how
+*/
+func acceptEula(id string, eulaText string, eulaPath string) (bool, string) {
+  digest := getEulaDigest(eulaText)
+  acceptedEulas := Instance().acceptedEulas
+  if acceptedEulas[digest] {
+    fmt.Printf("\nAccepting the EULA of %s with the SHA-256 %s\n", id, digest)
+    return true, ACCEPTED_BY_DIGEST
+  }
+  if len(acceptedEulas) > 0 {
+    fmt.Printf("\nThe EULA of %s at %s was not accepted, its SHA-256 %s is not one of the digests passed with -accept-eula or %s\n", id, eulaPath, digest, ACCEPT_EULA_ENV)
+    return false, ""
+  }
+  return displayEulaAndAskForAcknowledgement(eulaText, eulaPath, digest), ACCEPTED_BY_PROMPT
+}
+
+/*
+  Records that the EULA with the digest was accepted for mcli or the package
+*/
+func recordEulaAcknowledgement(baseDir string, id string, digest string, acceptedBy string) error {
+  acknowledgements := readEulaAcknowledgements(baseDir)
+  acknowledgements[id] = eulaAcknowledgement{Sha256: digest, AcceptedAt: time.Now().UTC(), AcceptedBy: acceptedBy}
+  content, err := json.MarshalIndent(acknowledgements, "", " ")
+  if err != nil {
+    return err
+  }
+  path := filepath.Join(baseDir, EULA_ACKNOWLEDGEMENTS_FILE)
+  if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+    return err
+  }
+  // written to a temporary file first, so that the acknowledgements of the other packages can't be lost
+  tempPath := path + ".tmp"
+  if err := ioutil.WriteFile(tempPath, content, 0644); err != nil {
+    return err
+  }
+  return os.Rename(tempPath, path)
+}
+
+/*
+  Returns the acknowledgements by the id of mcli or the package, none if they can't be read
+*/
+func readEulaAcknowledgements(baseDir string) map[string]eulaAcknowledgement {
+  acknowledgements := make(map[string]eulaAcknowledgement)
+  content, err := ioutil.ReadFile(filepath.Join(baseDir, EULA_ACKNOWLEDGEMENTS_FILE))
+  if err != nil {
+    return acknowledgements
+  }
+  if err := json.Unmarshal(content, &acknowledgements); err != nil {
+    fmt.Println("Failed to read the EULA acknowledgements, the EULAs will be asked for again:", err)
+    return make(map[string]eulaAcknowledgement)
+  }
+  return acknowledgements
+}
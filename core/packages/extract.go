@@ -0,0 +1,313 @@
+package packages
+
+import (
+  "archive/tar"
+  "compress/gzip"
+  "fmt"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "io"
+  "os"
+  "path/filepath"
+  "strings"
+)
+
+const (
+  MAX_EXTRACTED_SIZE = 2 * 1024 * 1024 * 1024 // total size of the files of a package, unless its MaxExtractedSize is set
+  MAX_EULA_SIZE      = 1024 * 1024
+)
+
+/*
+  What a package may extract: entries stay under the root they are extracted into, and only under the allowed paths
+  of the package if it has any. Links may only point into the root, or for absolute symlinks into the Dir the
+  package is installed to, since the files of the package end up there, see activateVersion
+*/
+type extractPolicy struct {
+  root          string
+  installDir    string
+  allowedPaths  []string // cleaned paths relative to the root, any path if empty
+  maxSize       int64
+  preserveOwner bool // files are owned by the uid and gid of the tarball, only when running as root
+}
+
+func newExtractPolicy(root string, installDir string, config configs.PackageConfig) (*extractPolicy, error) {
+  policy := &extractPolicy{
+    root:          filepath.Clean(root),
+    installDir:    filepath.Clean(installDir),
+    maxSize:       MAX_EXTRACTED_SIZE,
+    preserveOwner: os.Geteuid() == 0,
+  }
+  if config.MaxExtractedSize > 0 {
+    policy.maxSize = config.MaxExtractedSize
+  }
+  for _, allowedPath := range config.AllowedPaths {
+    cleaned, err := cleanEntryName(allowedPath)
+    if err != nil || cleaned == "." {
+      return nil, fmt.Errorf("invalid AllowedPaths entry %q of package %s, expected a path under its Dir", allowedPath, config.Id)
+    }
+    policy.allowedPaths = append(policy.allowedPaths, cleaned)
+  }
+  return policy, nil
+}
+
+/*
+  Returns the name of a tarball entry relative to the root, absolute names and names that leave the root are rejected
+*/
+func cleanEntryName(name string) (string, error) {
+  if filepath.IsAbs(name) || strings.HasPrefix(name, "/") {
+    return "", fmt.Errorf("%q is an absolute path", name)
+  }
+  cleaned := filepath.Clean(name)
+  if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+    return "", fmt.Errorf("%q is outside of the package", name)
+  }
+  return cleaned, nil
+}
+
+/*
+  Checks if the entry is under one of the allowed paths, directories that lead to an allowed path are allowed as well
+*/
+func (p *extractPolicy) isAllowed(name string, isDir bool) bool {
+  if len(p.allowedPaths) == 0 {
+    return true
+  }
+  for _, allowedPath := range p.allowedPaths {
+    if name == allowedPath || strings.HasPrefix(name, allowedPath+"/") {
+      return true
+    }
+    if isDir && strings.HasPrefix(allowedPath, name+"/") {
+      return true
+    }
+  }
+  return false
+}
+
+/*
+  Makes sure nothing is written through a symlink extracted earlier, which could point outside of the root
+*/
+func (p *extractPolicy) checkParents(name string) error {
+  parent := p.root
+  for _, component := range strings.Split(filepath.Dir(name), "/") {
+    if component == "." {
+      break
+    }
+    parent = filepath.Join(parent, component)
+    info, err := os.Lstat(parent)
+    if os.IsNotExist(err) {
+      return nil
+    }
+    if err != nil {
+      return err
+    }
+    if info.Mode()&os.ModeSymlink != 0 {
+      return fmt.Errorf("%q is inside the symlink %s", name, strings.TrimPrefix(parent, p.root+"/"))
+    }
+    if !info.IsDir() {
+      return fmt.Errorf("%q is inside the file %s", name, strings.TrimPrefix(parent, p.root+"/"))
+    }
+  }
+  return nil
+}
+
+/*
+  Checks that a symlink entry points into the root, or into the install dir and its allowed paths if it is absolute
+  A relative target may only go up with leading .. components, which walk the directories of the entry itself and can't
+  be symlinks, see checkParents. Once a target descends it can't go up anymore, as it may have passed through a symlink
+  of the package, extracted before or after this one, which would take a later .. somewhere else than it reads
+*/
+func (p *extractPolicy) checkSymlink(name string, target string) error {
+  descended := false
+  for _, component := range strings.Split(target, "/") {
+    if component == ".." && descended {
+      return fmt.Errorf("symlink %q goes back up through a path it descended into, %s", name, target)
+    }
+    if component != ".." && component != "." && component != "" {
+      descended = true
+    }
+  }
+  if filepath.IsAbs(target) {
+    rel, err := filepath.Rel(p.installDir, filepath.Clean(target))
+    if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+      return fmt.Errorf("symlink %q points outside of %s to %s", name, p.installDir, target)
+    }
+    if rel != "." && !p.isAllowed(rel, true) {
+      return fmt.Errorf("symlink %q points outside of the allowed paths to %s", name, target)
+    }
+    return nil
+  }
+  resolved := filepath.Join(filepath.Dir(name), target)
+  if resolved == ".." || strings.HasPrefix(resolved, "../") {
+    return fmt.Errorf("symlink %q points outside of the package to %s", name, target)
+  }
+  return nil
+}
+
+/*
+  Extracts a package into targetDir, enforcing the extract policy of the package on every entry, see extractPolicy
+  installDir is the Dir the files of the package are linked into once it is installed
+*/
+func extractTarball(tarballName string, targetDir string, installDir string, config configs.PackageConfig) error {
+  fmt.Println("\nUntaring file: ", tarballName)
+
+  policy, err := newExtractPolicy(targetDir, installDir, config)
+  if err != nil {
+    return err
+  }
+  file, err := openPackage(tarballName, config)
+  if err != nil {
+    return err
+  }
+  defer file.Close()
+
+  // file is tar'ed then gzipped, we need to do the reverse
+  // gzip reader
+  gzReader, err := gzip.NewReader(file)
+  if err != nil {
+    return err
+  }
+  defer gzReader.Close()
+  // tar reader
+  tarReader := tar.NewReader(gzReader)
+
+  var size int64
+  var dirs []*tar.Header
+  for {
+    // tar's reader returns next entry in tar, or EOF if done
+    header, err := tarReader.Next()
+    if err == io.EOF {
+      break
+    }
+    if err != nil {
+      return err
+    }
+    if header.Typeflag == tar.TypeXGlobalHeader {
+      continue
+    }
+    if header.Typeflag == tar.TypeReg {
+      size += header.Size
+      if size > policy.maxSize {
+        return fmt.Errorf("package %s is larger than %s once extracted", config.Id, formatBytes(policy.maxSize))
+      }
+    }
+    if err := policy.extractEntry(header, tarReader); err != nil {
+      return fmt.Errorf("refusing to extract package %s: %v", config.Id, err)
+    }
+    if header.Typeflag == tar.TypeDir {
+      dirs = append(dirs, header)
+    }
+  }
+
+  // the modification times of directories change while their files are extracted, so they are set last
+  for i := len(dirs) - 1; i >= 0; i-- {
+    name, _ := cleanEntryName(dirs[i].Name)
+    os.Chtimes(filepath.Join(policy.root, name), dirs[i].ModTime, dirs[i].ModTime)
+  }
+  return nil
+}
+
+func (p *extractPolicy) extractEntry(header *tar.Header, reader io.Reader) error {
+  name, err := cleanEntryName(header.Name)
+  if err != nil {
+    return err
+  }
+  if name == "." {
+    return nil
+  }
+  // the type of the entry is checked with its Typeflag, since hard links are regular files to FileInfo
+  isDir := header.Typeflag == tar.TypeDir
+  if !p.isAllowed(name, isDir) {
+    return fmt.Errorf("%q is outside of the allowed paths %s", name, strings.Join(p.allowedPaths, ", "))
+  }
+  if err := p.checkParents(name); err != nil {
+    return err
+  }
+  path := filepath.Join(p.root, name)
+  if err := createDir(filepath.Dir(path)); err != nil {
+    return err
+  }
+
+  // setuid, setgid and sticky bits are dropped
+  mode := os.FileMode(header.Mode).Perm()
+  switch header.Typeflag {
+  case tar.TypeDir:
+    if info, err := os.Lstat(path); err == nil && !info.IsDir() {
+      return fmt.Errorf("directory %q replaces a file", name)
+    }
+    if err := os.MkdirAll(path, mode|0700); err != nil {
+      return err
+    }
+  case tar.TypeReg:
+    if err := removeExisting(path); err != nil {
+      return err
+    }
+    if err := createFile(path, mode, io.LimitReader(reader, header.Size)); err != nil {
+      return err
+    }
+  case tar.TypeSymlink:
+    if err := p.checkSymlink(name, header.Linkname); err != nil {
+      return err
+    }
+    if err := removeExisting(path); err != nil {
+      return err
+    }
+    if err := os.Symlink(header.Linkname, path); err != nil {
+      return err
+    }
+  case tar.TypeLink:
+    // a hard link names an earlier entry of the tarball, which has to be a regular file under the allowed paths
+    linkName, err := cleanEntryName(header.Linkname)
+    if err != nil {
+      return fmt.Errorf("hard link %q: %v", name, err)
+    }
+    if !p.isAllowed(linkName, false) {
+      return fmt.Errorf("hard link %q points outside of the allowed paths to %s", name, header.Linkname)
+    }
+    if err := p.checkParents(linkName); err != nil {
+      return err
+    }
+    info, err := os.Lstat(filepath.Join(p.root, linkName))
+    if err != nil || !info.Mode().IsRegular() {
+      return fmt.Errorf("hard link %q doesn't point to a file of the package", name)
+    }
+    if err := removeExisting(path); err != nil {
+      return err
+    }
+    if err := os.Link(filepath.Join(p.root, linkName), path); err != nil {
+      return err
+    }
+    return nil
+  default:
+    return fmt.Errorf("%q is a device, fifo or other unsupported type of file", name)
+  }
+  p.applyMetadata(path, header)
+  return nil
+}
+
+/*
+  Sets the owner and modification time of the tarball on an extracted entry, the modification time of symlinks is
+  left alone since it can't be set without following them
+*/
+func (p *extractPolicy) applyMetadata(path string, header *tar.Header) {
+  if p.preserveOwner {
+    os.Lchown(path, header.Uid, header.Gid)
+  }
+  if header.Typeflag != tar.TypeSymlink {
+    os.Chtimes(path, header.ModTime, header.ModTime)
+  }
+}
+
+/*
+  Removes a file or symlink extracted earlier at the path, so that it is replaced instead of written through
+*/
+func removeExisting(path string) error {
+  info, err := os.Lstat(path)
+  if os.IsNotExist(err) {
+    return nil
+  }
+  if err != nil {
+    return err
+  }
+  if info.IsDir() {
+    return fmt.Errorf("%s is a directory", path)
+  }
+  return os.Remove(path)
+}
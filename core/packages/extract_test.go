@@ -0,0 +1,232 @@
+package packages
+
+import (
+  "archive/tar"
+  "bytes"
+  "compress/gzip"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+  "time"
+)
+
+var testModTime = time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+
+/*
+  Builds a gzipped tarball of the entries in memory, and writes it next to where it is extracted to
+*/
+func writeTestTarball(t *testing.T, dir string, headers []*tar.Header, contents map[string]string) string {
+  var buffer bytes.Buffer
+  gzWriter := gzip.NewWriter(&buffer)
+  tarWriter := tar.NewWriter(gzWriter)
+  for _, header := range headers {
+    if header.Typeflag == tar.TypeReg {
+      header.Size = int64(len(contents[header.Name]))
+    }
+    if header.ModTime.IsZero() {
+      header.ModTime = testModTime
+    }
+    if err := tarWriter.WriteHeader(header); err != nil {
+      t.Fatal(err)
+    }
+    if header.Typeflag == tar.TypeReg {
+      if _, err := tarWriter.Write([]byte(contents[header.Name])); err != nil {
+        t.Fatal(err)
+      }
+    }
+  }
+  if err := tarWriter.Close(); err != nil {
+    t.Fatal(err)
+  }
+  if err := gzWriter.Close(); err != nil {
+    t.Fatal(err)
+  }
+  tarballName := filepath.Join(dir, "package.tgz")
+  if err := ioutil.WriteFile(tarballName, buffer.Bytes(), 0644); err != nil {
+    t.Fatal(err)
+  }
+  return tarballName
+}
+
+func fileEntry(name string) *tar.Header {
+  return &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644}
+}
+
+func symlinkEntry(name string, target string) *tar.Header {
+  return &tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: target, Mode: 0777}
+}
+
+func hardLinkEntry(name string, target string) *tar.Header {
+  return &tar.Header{Name: name, Typeflag: tar.TypeLink, Linkname: target, Mode: 0644}
+}
+
+func TestExtractRejectsCraftedTarballs(t *testing.T) {
+  tests := []struct {
+    name     string
+    headers  []*tar.Header
+    contents map[string]string
+    allowed  []string
+    maxSize  int64
+    expected string
+  }{
+    {
+      name:     "parent directory",
+      headers:  []*tar.Header{fileEntry("bin/../../evil")},
+      expected: "outside of the package",
+    },
+    {
+      name:     "absolute path",
+      headers:  []*tar.Header{fileEntry("/etc/evil")},
+      expected: "absolute path",
+    },
+    {
+      name:     "absolute symlink outside of the install dir",
+      headers:  []*tar.Header{symlinkEntry("bin/passwd", "/etc/passwd")},
+      expected: "points outside of",
+    },
+    {
+      name:     "relative symlink outside of the package",
+      headers:  []*tar.Header{symlinkEntry("bin/passwd", "../../../etc/passwd")},
+      expected: "points outside of the package",
+    },
+    {
+      name:     "absolute symlink outside of the allowed paths",
+      headers:  []*tar.Header{symlinkEntry("bin/config", "{install}/etc/config")},
+      allowed:  []string{"bin"},
+      expected: "points outside of the allowed paths",
+    },
+    {
+      name:     "chained symlinks",
+      headers:  []*tar.Header{symlinkEntry("bin/up", ".."), symlinkEntry("bin/passwd", "up/../etc/passwd")},
+      expected: "goes back up",
+    },
+    {
+      name:     "chained symlinks extracted in reverse",
+      headers:  []*tar.Header{symlinkEntry("passwd", "bin/up/../../etc/passwd"), symlinkEntry("bin/up", "..")},
+      expected: "goes back up",
+    },
+    {
+      name:     "absolute symlink through a symlink",
+      headers:  []*tar.Header{symlinkEntry("bin/up", ".."), symlinkEntry("bin/passwd", "{install}/bin/up/../../etc/passwd")},
+      expected: "goes back up",
+    },
+    {
+      name:     "hard link outside of the package",
+      headers:  []*tar.Header{hardLinkEntry("bin/passwd", "../../etc/passwd")},
+      expected: "outside of the package",
+    },
+    {
+      name:     "hard link outside of the allowed paths",
+      headers:  []*tar.Header{hardLinkEntry("bin/passwd", "etc/passwd")},
+      allowed:  []string{"bin"},
+      expected: "points outside of the allowed paths",
+    },
+    {
+      name:     "write through a symlink",
+      headers:  []*tar.Header{symlinkEntry("lib", "bin"), fileEntry("lib/evil")},
+      expected: "inside the symlink lib",
+    },
+    {
+      name:     "write through an absolute symlink",
+      headers:  []*tar.Header{symlinkEntry("bin/dir", "{install}/bin"), fileEntry("bin/dir/evil")},
+      expected: "inside the symlink bin/dir",
+    },
+    {
+      name:     "outside of the allowed paths",
+      headers:  []*tar.Header{fileEntry("bin/marconid"), fileEntry("etc/cron.d/evil")},
+      allowed:  []string{"bin/marconid"},
+      expected: "outside of the allowed paths",
+    },
+    {
+      name:     "device",
+      headers:  []*tar.Header{{Name: "bin/null", Typeflag: tar.TypeChar, Mode: 0666}},
+      expected: "unsupported type",
+    },
+    {
+      name:     "larger than the size cap",
+      headers:  []*tar.Header{fileEntry("bin/a"), fileEntry("bin/b")},
+      contents: map[string]string{"bin/a": "0123456789", "bin/b": "0123456789"},
+      maxSize:  15,
+      expected: "is larger than",
+    },
+  }
+
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      dir := t.TempDir()
+      root := filepath.Join(dir, "root")
+      installDir := filepath.Join(dir, "install")
+      for _, header := range test.headers {
+        header.Linkname = strings.Replace(header.Linkname, "{install}", installDir, 1)
+      }
+      tarballName := writeTestTarball(t, dir, test.headers, test.contents)
+      config := configs.PackageConfig{Id: "test", AllowedPaths: test.allowed, MaxExtractedSize: test.maxSize}
+
+      err := extractTarball(tarballName, root, installDir, config)
+      if err == nil || !strings.Contains(err.Error(), test.expected) {
+        t.Fatalf("expected an error containing %q, got %v", test.expected, err)
+      }
+      if _, err := os.Lstat(filepath.Join(dir, "evil")); err == nil {
+        t.Fatal("a file was written outside of the root")
+      }
+    })
+  }
+}
+
+func TestExtractWellFormedTarball(t *testing.T) {
+  dir := t.TempDir()
+  root := filepath.Join(dir, "root")
+  dirModTime := testModTime.Add(-time.Hour)
+  headers := []*tar.Header{
+    {Name: "bin/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: dirModTime},
+    {Name: "bin/tool", Typeflag: tar.TypeReg, Mode: 04755},
+    symlinkEntry("bin/alias", "tool"),
+    symlinkEntry("etc/pkg/tool", "./../../bin/tool"),
+    hardLinkEntry("bin/tool2", "bin/tool"),
+    fileEntry("etc/pkg/version.txt"),
+  }
+  contents := map[string]string{"bin/tool": "#!/bin/sh\n", "etc/pkg/version.txt": "0.1.2\n"}
+  tarballName := writeTestTarball(t, dir, headers, contents)
+  config := configs.PackageConfig{Id: "test", AllowedPaths: []string{"bin", "etc/pkg"}}
+
+  if err := extractTarball(tarballName, root, filepath.Join(dir, "install"), config); err != nil {
+    t.Fatal(err)
+  }
+
+  for name, content := range contents {
+    extracted, err := ioutil.ReadFile(filepath.Join(root, name))
+    if err != nil || string(extracted) != content {
+      t.Fatalf("%s was extracted as %q, %v", name, extracted, err)
+    }
+  }
+  info, err := os.Stat(filepath.Join(root, "bin/tool"))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if info.Mode() != 0755 {
+    t.Errorf("expected the setuid bit to be dropped, got %v", info.Mode())
+  }
+  if !info.ModTime().Equal(testModTime) {
+    t.Errorf("expected the mtime of the file to be %v, got %v", testModTime, info.ModTime())
+  }
+  dirInfo, err := os.Stat(filepath.Join(root, "bin"))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !dirInfo.ModTime().Equal(dirModTime) {
+    t.Errorf("expected the mtime of the directory to be %v, got %v", dirModTime, dirInfo.ModTime())
+  }
+  if target, err := os.Readlink(filepath.Join(root, "bin/alias")); err != nil || target != "tool" {
+    t.Errorf("expected bin/alias to link to tool, got %q, %v", target, err)
+  }
+  if linked, err := ioutil.ReadFile(filepath.Join(root, "etc/pkg/tool")); err != nil || string(linked) != contents["bin/tool"] {
+    t.Errorf("expected etc/pkg/tool to link to bin/tool, got %q, %v", linked, err)
+  }
+  linkInfo, err := os.Stat(filepath.Join(root, "bin/tool2"))
+  if err != nil || !os.SameFile(info, linkInfo) {
+    t.Errorf("expected bin/tool2 to be a hard link of bin/tool, %v", err)
+  }
+}
@@ -0,0 +1,299 @@
+package packages
+
+import (
+  "bufio"
+  "errors"
+  "fmt"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "time"
+)
+
+const (
+  // every installed version of a package is kept in its own directory under PACKAGES_DIR/<id>/<version>
+  PACKAGES_DIR       = "var/lib/marconi/packages"
+  CURRENT_LINK       = "current"
+  PREVIOUS_LINK      = "previous"
+  STAGING_PREFIX     = ".staging-"
+  FILES_MANIFEST_EXT = ".files"
+)
+
+/*
+  Extracts the package into a staging directory for its version, and only once that succeeded switches the
+  installed files of the package to the new version, see activateVersion
+*/
+func installPackage(baseDir string, tarballName string, targetDir string, config configs.PackageConfig, version string) error {
+  if err := validateVersion(version); err != nil {
+    return fmt.Errorf("%v of package %s", err, config.Id)
+  }
+  packageDir := getPackageDir(baseDir, config.Id)
+  stagingDir := filepath.Join(packageDir, STAGING_PREFIX+version)
+  // left over by an install that was interrupted
+  if err := removeDir(stagingDir); err != nil {
+    return err
+  }
+  if err := os.MkdirAll(stagingDir, 0755); err != nil {
+    return err
+  }
+
+  if err := extractTarball(tarballName, stagingDir, targetDir, config); err != nil {
+    removeDir(stagingDir)
+    return err
+  }
+  files, err := listInstalledFiles(stagingDir)
+  if err != nil {
+    removeDir(stagingDir)
+    return err
+  }
+  if err := writeFilesManifest(filepath.Join(packageDir, version+FILES_MANIFEST_EXT), files); err != nil {
+    removeDir(stagingDir)
+    return err
+  }
+
+  versionDir := filepath.Join(packageDir, version)
+  if _, err := os.Lstat(versionDir); err == nil {
+    // the same version is reinstalled, the old copy is only removed once the new one is in place
+    oldDir := filepath.Join(packageDir, fmt.Sprintf("%s%s-%d", STAGING_PREFIX, version, time.Now().UnixNano()))
+    if err := os.Rename(versionDir, oldDir); err != nil {
+      return err
+    }
+    defer removeDir(oldDir)
+  }
+  if err := os.Rename(stagingDir, versionDir); err != nil {
+    return err
+  }
+  return activateVersion(baseDir, targetDir, config, version)
+}
+
+/*
+  Makes the version the current version of the package, and the current version the previous one
+  Every file of the package is a symlink in the target dir to the same file under the current link of the package,
+  so flipping the current link switches all the files that the versions have in common at once
+*/
+func activateVersion(baseDir string, targetDir string, config configs.PackageConfig, version string) error {
+  packageDir := getPackageDir(baseDir, config.Id)
+  files, err := readFilesManifest(filepath.Join(packageDir, version+FILES_MANIFEST_EXT))
+  if err != nil {
+    return fmt.Errorf("version %s of package %s is not installed: %v", version, config.Id, err)
+  }
+  currentVersion, _ := getLinkedVersion(packageDir, CURRENT_LINK)
+  var currentFiles []string
+  if currentVersion != "" {
+    currentFiles, _ = readFilesManifest(filepath.Join(packageDir, currentVersion+FILES_MANIFEST_EXT))
+  }
+
+  if err := replaceWithSymlink(filepath.Join(packageDir, CURRENT_LINK), version); err != nil {
+    return err
+  }
+  currentDir := filepath.Join(packageDir, CURRENT_LINK)
+  for _, file := range files {
+    if err := linkInstalledFile(filepath.Join(currentDir, file), filepath.Join(targetDir, file)); err != nil {
+      return fmt.Errorf("failed to install %s of package %s: %v", file, config.Id, err)
+    }
+  }
+
+  // files of the previous version that are not part of this one
+  installed := make(map[string]bool, len(files))
+  for _, file := range files {
+    installed[file] = true
+  }
+  for _, file := range currentFiles {
+    if !installed[file] {
+      unlinkInstalledFile(filepath.Join(currentDir, file), filepath.Join(targetDir, file))
+    }
+  }
+
+  if currentVersion != "" && currentVersion != version {
+    if err := replaceWithSymlink(filepath.Join(packageDir, PREVIOUS_LINK), currentVersion); err != nil {
+      return err
+    }
+  }
+  pruneVersions(packageDir)
+  return nil
+}
+
+/*
+  Switches a package back to the version that was installed before the current one, returns that version
+*/
+func (pm *PackageManager) RollbackPackage(baseDir string, config configs.PackageConfig) (string, error) {
+  packageDir := getPackageDir(baseDir, config.Id)
+  previousVersion, err := getLinkedVersion(packageDir, PREVIOUS_LINK)
+  if err != nil {
+    return "", fmt.Errorf("package %s has no previous version to roll back to", config.Id)
+  }
+  if err := activateVersion(baseDir, filepath.Join(baseDir, config.Dir), config, previousVersion); err != nil {
+    return "", err
+  }
+  return previousVersion, nil
+}
+
+/*
+  Returns the current and previous version of a package installed through a staging directory, empty if there are none
+*/
+func (pm *PackageManager) GetInstalledVersions(baseDir string, id string) (string, string) {
+  packageDir := getPackageDir(baseDir, id)
+  current, _ := getLinkedVersion(packageDir, CURRENT_LINK)
+  previous, _ := getLinkedVersion(packageDir, PREVIOUS_LINK)
+  return current, previous
+}
+
+/*
+  A version is the name of a directory under the package dir, so it can't be a path
+*/
+func validateVersion(version string) error {
+  if version == "" || strings.ContainsAny(version, "/\\") || strings.HasPrefix(version, ".") {
+    return fmt.Errorf("invalid version %q", version)
+  }
+  return nil
+}
+
+/*
+  Checks if the version is still kept under the package dir, so that it can be switched to without downloading it
+*/
+func isVersionInstalled(baseDir string, id string, version string) bool {
+  packageDir := getPackageDir(baseDir, id)
+  if _, err := os.Stat(filepath.Join(packageDir, version+FILES_MANIFEST_EXT)); err != nil {
+    return false
+  }
+  info, err := os.Stat(filepath.Join(packageDir, version))
+  return err == nil && info.IsDir()
+}
+
+func getPackageDir(baseDir string, id string) string {
+  return filepath.Join(baseDir, PACKAGES_DIR, id)
+}
+
+func getLinkedVersion(packageDir string, link string) (string, error) {
+  version, err := os.Readlink(filepath.Join(packageDir, link))
+  if err != nil {
+    return "", err
+  }
+  if _, err := os.Stat(filepath.Join(packageDir, version)); err != nil {
+    return "", err
+  }
+  return version, nil
+}
+
+/*
+  Atomically points the symlink at path to target, replacing whatever is at path
+*/
+func replaceWithSymlink(path string, target string) error {
+  tempPath := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+  os.Remove(tempPath)
+  if err := os.Symlink(target, tempPath); err != nil {
+    return err
+  }
+  if err := os.Rename(tempPath, path); err != nil {
+    os.Remove(tempPath)
+    return err
+  }
+  return nil
+}
+
+/*
+  Links the file of the package into the target dir, a file installed by an earlier version of mcli is replaced
+*/
+func linkInstalledFile(source string, path string) error {
+  if info, err := os.Lstat(path); err == nil && info.IsDir() {
+    return errors.New("a directory is in the way")
+  }
+  if err := createDir(filepath.Dir(path)); err != nil {
+    return err
+  }
+  // relative, so that the base dir can be moved
+  target, err := filepath.Rel(filepath.Dir(path), source)
+  if err != nil {
+    target = source
+  }
+  return replaceWithSymlink(path, target)
+}
+
+/*
+  Removes a link to a file of the package, files not installed by the package are left alone
+*/
+func unlinkInstalledFile(source string, path string) {
+  target, err := os.Readlink(path)
+  if err != nil {
+    return
+  }
+  if !filepath.IsAbs(target) {
+    target = filepath.Join(filepath.Dir(path), target)
+  }
+  if filepath.Clean(target) == filepath.Clean(source) {
+    os.Remove(path)
+  }
+}
+
+/*
+  Keeps the current and previous versions, and removes the others and any left over staging directories
+*/
+func pruneVersions(packageDir string) {
+  current, _ := getLinkedVersion(packageDir, CURRENT_LINK)
+  previous, _ := getLinkedVersion(packageDir, PREVIOUS_LINK)
+  entries, err := ioutil.ReadDir(packageDir)
+  if err != nil {
+    return
+  }
+  for _, entry := range entries {
+    name := entry.Name()
+    version := strings.TrimSuffix(strings.TrimSuffix(name, FILES_MANIFEST_EXT), RELEASE_FILE_EXT)
+    if name == CURRENT_LINK || name == PREVIOUS_LINK || version == current || version == previous {
+      continue
+    }
+    // such as a package that is being downloaded
+    if !entry.IsDir() && version == name {
+      continue
+    }
+    // a staging directory of a concurrent install is only removed by that install
+    if strings.HasPrefix(name, STAGING_PREFIX) && time.Since(entry.ModTime()) < time.Hour {
+      continue
+    }
+    removeDir(filepath.Join(packageDir, name))
+  }
+}
+
+/*
+  Lists the files and symlinks under dir, relative to dir
+*/
+func listInstalledFiles(dir string) ([]string, error) {
+  var files []string
+  err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+    if err != nil {
+      return err
+    }
+    if info.IsDir() {
+      return nil
+    }
+    rel, err := filepath.Rel(dir, path)
+    if err != nil {
+      return err
+    }
+    files = append(files, rel)
+    return nil
+  })
+  return files, err
+}
+
+func writeFilesManifest(path string, files []string) error {
+  return ioutil.WriteFile(path, []byte(strings.Join(files, "\n")+"\n"), 0644)
+}
+
+func readFilesManifest(path string) ([]string, error) {
+  file, err := os.Open(path)
+  if err != nil {
+    return nil, err
+  }
+  defer file.Close()
+
+  var files []string
+  scanner := bufio.NewScanner(file)
+  for scanner.Scan() {
+    if line := strings.TrimSpace(scanner.Text()); line != "" {
+      files = append(files, line)
+    }
+  }
+  return files, scanner.Err()
+}
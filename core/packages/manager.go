@@ -1,11 +1,28 @@
 package packages
 
 import (
+  "fmt"
   "github.com/MarconiProtocol/cli/core/configs"
   "sync"
 )
 
 type PackageManager struct {
+  acceptedEulas map[string]bool // SHA-256 digests of the EULAs that are accepted without asking, see AcceptEulas
+}
+
+/*
+  The installed and available versions of a package
+*/
+type PackageStatus struct {
+  Id               string
+  Channel          string
+  InstalledVersion string // from the VersionFile of the package, empty if it is not installed
+  PreviousVersion  string // the version a rollback switches to
+  PinnedVersion    string
+  LatestVersion    string // the newest release of the manifest in the channel of the package, only set by CheckPackages
+  TargetVersion    string // the newest version that meets the requirements of the package, only set by CheckPackages
+  UpToDate         bool
+  Error            error
 }
 
 var instance *PackageManager
@@ -22,15 +39,112 @@ func Instance() *PackageManager {
   Downloads or updates the packages as defined in config
 */
 func (pm *PackageManager) UpdatePackages(baseDir string, packagesConfig *configs.PackagesConfig) {
-  autoUpdateEnabled := packagesConfig.AutoUpdateEnabled
+  d, err := newDownloader(packagesConfig)
+  if err != nil {
+    handleErr(err)
+  }
+  updatePackages(d, baseDir, packagesConfig)
+}
+
+/*
+  Returns the installed versions of the packages in config, without downloading their manifests
+*/
+func (pm *PackageManager) GetPackageStatuses(baseDir string, packagesConfig *configs.PackagesConfig) []*PackageStatus {
+  statuses := make([]*PackageStatus, len(packagesConfig.Packages))
+  for i, config := range packagesConfig.Packages {
+    statuses[i] = getPackageStatus(baseDir, packagesConfig, config)
+  }
+  return statuses
+}
+
+/*
+  Returns the installed versions of the package, without downloading its manifest
+*/
+func (pm *PackageManager) GetPackageStatus(baseDir string, packagesConfig *configs.PackagesConfig, config configs.PackageConfig) *PackageStatus {
+  return getPackageStatus(baseDir, packagesConfig, config)
+}
+
+/*
+  Downloads the manifests of the packages in config to check which versions they can be updated to, with the other
+  packages at their installed versions, only the packages with the ids are checked if any are given
+*/
+func (pm *PackageManager) CheckPackages(baseDir string, packagesConfig *configs.PackagesConfig, ids []string) ([]*PackageStatus, error) {
+  d, err := newDownloader(packagesConfig)
+  if err != nil {
+    return nil, err
+  }
+  configsById := make(map[string]configs.PackageConfig, len(packagesConfig.Packages))
   for _, config := range packagesConfig.Packages {
-    // Check if the package's version file exist as a proxy for whether the package itself exists
-    packageExists := doesPackageVersionFileExist(baseDir, config)
-    // If the package does not exist, just download
-    if !packageExists {
-      downloadPackage(baseDir, config)
-    } else {
-      updatePackage(baseDir, config, autoUpdateEnabled)
+    configsById[config.Id] = config
+  }
+  if len(ids) == 0 {
+    for _, config := range packagesConfig.Packages {
+      ids = append(ids, config.Id)
+    }
+  }
+
+  var statuses []*PackageStatus
+  for _, id := range ids {
+    config, exists := configsById[id]
+    if !exists {
+      return nil, fmt.Errorf("unknown package %s", id)
+    }
+    status := checkPackage(d, baseDir, packagesConfig, config)
+    statuses = append(statuses, status)
+  }
+  return statuses, nil
+}
+
+/*
+  Installs the version of the package without asking for permission, the version has to be in the channel and
+  version range of the package and meet the requirements between it and the installed versions of the other packages
+*/
+func (pm *PackageManager) UpdatePackage(baseDir string, packagesConfig *configs.PackagesConfig, config configs.PackageConfig, version string) error {
+  d, err := newDownloader(packagesConfig)
+  if err != nil {
+    return err
+  }
+  manifest, err := getPackageManifest(d, baseDir, config)
+  if err != nil && !isVersionInstalled(baseDir, config.Id, version) {
+    return err
+  }
+  candidates, err := getCandidates(baseDir, packagesConfig, config, manifest)
+  if err != nil {
+    return err
+  }
+  var releases []configs.PackageRelease
+  for _, release := range candidates.releases {
+    if release.Version == version {
+      releases = append(releases, release)
+    }
+  }
+  if len(releases) == 0 {
+    return fmt.Errorf("version %s of package %s is not available in its channel and version range", version, config.Id)
+  }
+  candidates.releases = releases
+
+  release, err := resolveWithInstalledPackages(baseDir, packagesConfig, candidates)
+  if err != nil {
+    return err
+  }
+  return switchToRelease(d, baseDir, config, release)
+}
+
+/*
+  Holds the package at the version, or lets it update to the version of its manifest again if the version is empty
+*/
+func (pm *PackageManager) PinPackage(packagesConfig *configs.PackagesConfig, id string, version string) error {
+  if version != "" {
+    if _, err := parseSemanticVersion(version); err != nil {
+      return err
+    }
+  }
+  for i := range packagesConfig.Packages {
+    if packagesConfig.Packages[i].Id == id {
+      packagesConfig.Packages[i].PinnedVersion = version
+      configs.UpdatePackagesConf(packagesConfig)
+      return nil
     }
   }
+  return fmt.Errorf("unknown package %s", id)
 }
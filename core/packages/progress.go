@@ -0,0 +1,266 @@
+package packages
+
+import (
+  "fmt"
+  "io"
+  "os"
+  "strings"
+  "sync"
+  "sync/atomic"
+  "time"
+)
+
+const (
+  PROGRESS_REFRESH_INTERVAL = 200 * time.Millisecond
+  PROGRESS_LOG_INTERVAL     = 10 * time.Second // how often progress is logged when stdout is not a terminal
+  PROGRESS_BAR_WIDTH        = 30
+  PROGRESS_NAME_WIDTH       = 12
+
+  // states of a download
+  PROGRESS_WAITING     = "waiting"
+  PROGRESS_DOWNLOADING = "downloading"
+  PROGRESS_DONE        = "done"
+  PROGRESS_FAILED      = "failed"
+)
+
+/*
+  Shows the progress of concurrent downloads, as a bar per download that is redrawn in place when stdout is a
+  terminal, or as plain log lines every PROGRESS_LOG_INTERVAL otherwise
+*/
+type progressDisplay struct {
+  mutex    sync.Mutex
+  out      io.Writer
+  terminal bool
+  bars     []*progressBar
+  lines    int // the number of lines drawn, that the cursor is moved back up over to redraw them
+  stop     chan struct{}
+  stopped  chan struct{}
+}
+
+/*
+  The progress of a single download, it counts the bytes written to it
+*/
+type progressBar struct {
+  display *progressDisplay
+  name    string
+  current int64 // bytes downloaded, updated atomically
+  total   int64 // -1 if the size is unknown
+  resumed int64 // bytes downloaded before this attempt, which don't count for the rate
+  started time.Time
+  logged  time.Time
+  state   string
+}
+
+func newProgressDisplay(out *os.File) *progressDisplay {
+  return &progressDisplay{
+    out:      out,
+    terminal: isTerminal(out),
+    stop:     make(chan struct{}),
+    stopped:  make(chan struct{}),
+  }
+}
+
+/*
+  A terminal that understands the escape sequences used to redraw the bars
+*/
+func isTerminal(file *os.File) bool {
+  info, err := file.Stat()
+  if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+    return false
+  }
+  return os.Getenv("TERM") != "dumb"
+}
+
+/*
+  Adds a bar for a download, bars are shown in the order they are added
+*/
+func (p *progressDisplay) addBar(name string) *progressBar {
+  p.mutex.Lock()
+  defer p.mutex.Unlock()
+  bar := &progressBar{display: p, name: name, total: -1, state: PROGRESS_WAITING}
+  p.bars = append(p.bars, bar)
+  return bar
+}
+
+/*
+  Starts redrawing the bars until close is called
+*/
+func (p *progressDisplay) start() {
+  go func() {
+    defer close(p.stopped)
+    ticker := time.NewTicker(PROGRESS_REFRESH_INTERVAL)
+    defer ticker.Stop()
+    for {
+      select {
+      case <-p.stop:
+        return
+      case <-ticker.C:
+        p.mutex.Lock()
+        p.refresh()
+        p.mutex.Unlock()
+      }
+    }
+  }()
+}
+
+/*
+  Stops redrawing, leaving the final state of the bars on the terminal
+*/
+func (p *progressDisplay) close() {
+  close(p.stop)
+  <-p.stopped
+  p.mutex.Lock()
+  defer p.mutex.Unlock()
+  p.refresh()
+}
+
+/*
+  Prints a message above the bars, so that it doesn't garble them
+*/
+func (p *progressDisplay) println(a ...interface{}) {
+  p.mutex.Lock()
+  defer p.mutex.Unlock()
+  p.clear()
+  fmt.Fprintln(p.out, a...)
+  p.refresh()
+}
+
+func (p *progressDisplay) refresh() {
+  if !p.terminal {
+    for _, bar := range p.bars {
+      if bar.state == PROGRESS_DOWNLOADING && time.Since(bar.logged) >= PROGRESS_LOG_INTERVAL {
+        bar.logged = time.Now()
+        fmt.Fprintf(p.out, "%s: %s\n", bar.name, bar.describe())
+      }
+    }
+    return
+  }
+  p.clear()
+  for _, bar := range p.bars {
+    fmt.Fprintln(p.out, bar.render())
+  }
+  p.lines = len(p.bars)
+}
+
+/*
+  Moves the cursor back up over the bars and clears them
+*/
+func (p *progressDisplay) clear() {
+  if p.terminal && p.lines > 0 {
+    fmt.Fprintf(p.out, "\033[%dA\033[J", p.lines)
+    p.lines = 0
+  }
+}
+
+/*
+  Called at the start of every attempt, with the bytes already downloaded and the size of the file
+*/
+func (b *progressBar) begin(offset int64, total int64) {
+  b.display.mutex.Lock()
+  defer b.display.mutex.Unlock()
+  atomic.StoreInt64(&b.current, offset)
+  b.total = total
+  b.resumed = offset
+  b.started = time.Now()
+  if b.state != PROGRESS_DOWNLOADING {
+    b.state = PROGRESS_DOWNLOADING
+    if !b.display.terminal {
+      b.logged = b.started
+      fmt.Fprintf(b.display.out, "%s: downloading %s\n", b.name, b.describe())
+    }
+  }
+}
+
+func (b *progressBar) Write(p []byte) (int, error) {
+  atomic.AddInt64(&b.current, int64(len(p)))
+  return len(p), nil
+}
+
+/*
+  Marks the download as finished, failed if err is set
+*/
+func (b *progressBar) finish(err error) {
+  b.display.mutex.Lock()
+  defer b.display.mutex.Unlock()
+  if err != nil {
+    b.state = PROGRESS_FAILED
+  } else {
+    b.state = PROGRESS_DONE
+  }
+  if !b.display.terminal {
+    fmt.Fprintf(b.display.out, "%s: %s %s\n", b.name, b.state, formatBytes(atomic.LoadInt64(&b.current)))
+  }
+}
+
+/*
+  Renders the bar as a line, ie. marconid     [#########             ]  30%  1.5 MB / 5.0 MB  1.2 MB/s  ETA 3s
+*/
+func (b *progressBar) render() string {
+  name := b.name
+  if len(name) > PROGRESS_NAME_WIDTH {
+    name = name[:PROGRESS_NAME_WIDTH]
+  }
+  current := atomic.LoadInt64(&b.current)
+  filled := 0
+  switch {
+  case b.state == PROGRESS_DONE:
+    filled = PROGRESS_BAR_WIDTH
+  case b.total > 0:
+    filled = int(current * PROGRESS_BAR_WIDTH / b.total)
+  }
+  if filled > PROGRESS_BAR_WIDTH {
+    filled = PROGRESS_BAR_WIDTH
+  }
+  bar := strings.Repeat("#", filled) + strings.Repeat(" ", PROGRESS_BAR_WIDTH-filled)
+  return fmt.Sprintf("%-*s [%s] %s", PROGRESS_NAME_WIDTH, name, bar, b.describe())
+}
+
+/*
+  Describes the progress, ie. 30%  1.5 MB / 5.0 MB  1.2 MB/s  ETA 3s
+*/
+func (b *progressBar) describe() string {
+  current := atomic.LoadInt64(&b.current)
+  switch b.state {
+  case PROGRESS_WAITING:
+    return PROGRESS_WAITING
+  case PROGRESS_DONE, PROGRESS_FAILED:
+    return fmt.Sprintf("%s  %s", formatBytes(current), b.state)
+  }
+
+  if b.total <= 0 {
+    return fmt.Sprintf("%s  %s", formatBytes(current), b.formatRate(current))
+  }
+  description := fmt.Sprintf("%3d%%  %s / %s  %s", current*100/b.total, formatBytes(current), formatBytes(b.total), b.formatRate(current))
+  elapsed := time.Since(b.started).Seconds()
+  if rate := float64(current-b.resumed) / elapsed; elapsed > 0 && rate > 0 {
+    eta := time.Duration(float64(b.total-current) / rate * float64(time.Second))
+    description += "  ETA " + eta.Round(time.Second).String()
+  }
+  return description
+}
+
+func (b *progressBar) formatRate(current int64) string {
+  elapsed := time.Since(b.started).Seconds()
+  if elapsed <= 0 {
+    return "-"
+  }
+  return formatBytes(int64(float64(current-b.resumed)/elapsed)) + "/s"
+}
+
+/*
+  Formats a number of bytes with a binary unit, ie. 1.5 MB
+*/
+func formatBytes(n int64) string {
+  const unit = 1024
+  if n < unit {
+    return fmt.Sprintf("%d B", n)
+  }
+  value := float64(n) / unit
+  for _, suffix := range []string{"KB", "MB", "GB"} {
+    if value < unit {
+      return fmt.Sprintf("%.1f %s", value, suffix)
+    }
+    value /= unit
+  }
+  return fmt.Sprintf("%.1f TB", value)
+}
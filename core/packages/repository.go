@@ -8,33 +8,93 @@ import (
   "os"
   "path/filepath"
   "strings"
+  "sync"
+  "sync/atomic"
 )
 
 /*
-  Download the package
+  Downloads the packages that are not installed and updates the packages that are out of date, asking for permission
+  to update unless auto-update is enabled
+  The versions are resolved for all packages at once, so that packages that require each other's new versions are
+  updated together, a package the user doesn't update is kept at its installed version and the others are resolved
+  again around it. Once it is known which packages are updated, they are downloaded concurrently, see installReleases
 */
-func downloadPackage(baseDir string, config configs.PackageConfig) {
-  if valid, err := checkConfigValid(baseDir, config); !valid && err != nil {
-    handleErr(err)
+func updatePackages(d *downloader, baseDir string, packagesConfig *configs.PackagesConfig) {
+  autoUpdateEnabled := packagesConfig.AutoUpdateEnabled
+  var packages []*packageCandidates
+  for _, config := range packagesConfig.Packages {
+    if valid, err := checkConfigValid(baseDir, config); !valid && err != nil {
+      handleErr(err)
+    }
+    manifest, err := getPackageManifest(d, baseDir, config)
+    if err != nil {
+      // a package held at its pinned version doesn't need its manifest
+      if version, _ := getPackageVersion(baseDir, config); config.PinnedVersion == "" || version != config.PinnedVersion {
+        handleErr(err)
+      }
+    }
+    candidates, err := getCandidates(baseDir, packagesConfig, config, manifest)
+    if err != nil {
+      handleErr(err)
+    }
+    packages = append(packages, candidates)
   }
-  packageManifest, err := getPackageManifest(baseDir, config)
-  if err != nil {
-    handleErr(err)
+
+  done := make(map[string]bool)
+  var updates []packageUpdate
+  for {
+    resolving := make([]*packageCandidates, len(packages))
+    for i, p := range packages {
+      if done[p.config.Id] {
+        resolving[i] = getFixedCandidates(p)
+      } else {
+        resolving[i] = p
+      }
+    }
+    resolved, err := resolveVersions(resolving)
+    if err != nil {
+      fmt.Println("Failed to update the packages:", err)
+      break
+    }
+
+    // the next package that is not at its resolved version
+    var next *packageCandidates
+    for _, p := range packages {
+      if !done[p.config.Id] && (p.installed == nil || p.installed.Version != resolved[p.config.Id].Version) {
+        next = p
+        break
+      }
+    }
+    if next == nil {
+      break
+    }
+    done[next.config.Id] = true
+    release := resolved[next.config.Id]
+
+    if next.installed != nil {
+      // if autoUpdate is not enabled, prompt the user for permission to update
+      if !autoUpdateEnabled {
+        update, optIn := askForPackageUpdateAcknowledgement(next.config.Id, next.installed.Version, release.Version)
+        if !update {
+          continue
+        }
+        // If the user has decided to opt in, update the packages config
+        if optIn {
+          autoUpdateEnabled = true
+          packages_config := configs.LoadPackagesConf()
+          packages_config.AutoUpdateEnabled = true
+          configs.UpdatePackagesConf(packages_config)
+        }
+      }
+      fmt.Printf("Package %s out of date, updating to %s\n", next.config.Id, release.Version)
+    }
+    updates = append(updates, packageUpdate{next.config, release})
+    next.installed = &release
   }
-  fetchPackage(baseDir, config, packageManifest.Source)
-}
 
-/*
-  Updates the package defined in the provided PackageConfig if necessary
-*/
-func updatePackage(baseDir string, config configs.PackageConfig, autoUpdateEnabled bool) {
-  if valid, err := checkConfigValid(baseDir, config); !valid && err != nil {
+  if err := installReleases(d, baseDir, updates); err != nil && err != errEulaNotAccepted {
     handleErr(err)
   }
-  if isUpToDate, packageLocation := checkPackageIsUpToDate(baseDir, config, autoUpdateEnabled); !isUpToDate {
-    fmt.Printf("Package %s out of date, updating:\n", config.Id)
-    fetchPackage(baseDir, config, packageLocation)
-  }
 }
 
 func checkConfigValid(baseDir string, config configs.PackageConfig) (bool, error) {
@@ -57,9 +117,9 @@ func checkConfigValid(baseDir string, config configs.PackageConfig) (bool, error
 /*
   Get the manifest data for a specific package
 */
-func getPackageManifest(baseDir string, config configs.PackageConfig) (*configs.PackageManifest, error) {
+func getPackageManifest(d *downloader, baseDir string, config configs.PackageConfig) (*configs.PackageManifest, error) {
   // Attempt to grab the manifest file
-  manifest, err := downloadManifestWithHttp(config.Manifest)
+  manifest, err := d.downloadManifest(getDownloadSources(config.Manifest, config.Mirrors))
   if err != nil {
     return nil, err
   }
@@ -102,7 +162,10 @@ func getPackageVersion(baseDir string, config configs.PackageConfig) (string, er
     }
   }
   versionStrArr := strings.Split(line, "=")
-  version := versionStrArr[1]
+  if len(versionStrArr) < 2 {
+    return "", fmt.Errorf("Failed to parse version file for package: %s at %s", config.Id, versionFilePath)
+  }
+  version := strings.TrimSpace(versionStrArr[1])
 
   return version, nil
 }
@@ -120,97 +183,248 @@ func doesPackageVersionFileExist(baseDir string, config configs.PackageConfig) b
 }
 
 /*
-  Check if the package defined in the provided PackageConfig exists and if it is up to date
+  Checks which version the package can be updated to, with the other packages at their installed versions, the error
+  of the status is set if the manifest can't be downloaded or no version meets the requirements of the package
 */
-func checkPackageIsUpToDate(baseDir string, config configs.PackageConfig, autoUpdateEnabled bool) (bool, string) {
-  manifest, err := getPackageManifest(baseDir, config)
+func checkPackage(d *downloader, baseDir string, packagesConfig *configs.PackagesConfig, config configs.PackageConfig) *PackageStatus {
+  status := getPackageStatus(baseDir, packagesConfig, config)
+  manifest, err := getPackageManifest(d, baseDir, config)
   if err != nil {
-    handleErr(err)
+    status.Error = err
   }
-  version, err := getPackageVersion(baseDir, config)
+  candidates, err := getCandidates(baseDir, packagesConfig, config, manifest)
   if err != nil {
-    handleErr(err)
+    status.Error = err
+    return status
   }
+  status.LatestVersion = candidates.latest
 
-  // check if the version is correct
-  isUpToDate := checkVersionIsAccepted(version, manifest.Version)
-  if isUpToDate {
-    return true, ""
+  resolved, err := resolveWithInstalledPackages(baseDir, packagesConfig, candidates)
+  if err != nil {
+    if status.Error == nil {
+      status.Error = err
+    }
+    return status
   }
+  status.TargetVersion = resolved.Version
+  status.UpToDate = status.InstalledVersion != "" && status.InstalledVersion == status.TargetVersion
+  return status
+}
 
-  // if autoUpdate is not enabled, prompt the user for permission to update
-  if !autoUpdateEnabled {
-    update, optIn := askForPackageUpdateAcknowledgement(config.Id, version, manifest.Version)
-    // If we don't want to update, the package is considered up to date
-    if !update {
-      return true, ""
+/*
+  Resolves the version of the package with all the other packages kept at their installed versions
+*/
+func resolveWithInstalledPackages(baseDir string, packagesConfig *configs.PackagesConfig, candidates *packageCandidates) (*configs.PackageRelease, error) {
+  packages := []*packageCandidates{candidates}
+  for _, other := range packagesConfig.Packages {
+    if other.Id == candidates.config.Id {
+      continue
     }
-    // If the user has decided to opt in, update the packages config
-    if optIn {
-      packages_config := configs.LoadPackagesConf()
-      packages_config.AutoUpdateEnabled = true
-      configs.UpdatePackagesConf(packages_config)
+    otherCandidates, err := getCandidates(baseDir, packagesConfig, other, nil)
+    if err != nil {
+      return nil, err
     }
+    packages = append(packages, getFixedCandidates(otherCandidates))
   }
+  resolved, err := resolveVersions(packages)
+  if err != nil {
+    return nil, err
+  }
+  release := resolved[candidates.config.Id]
+  return &release, nil
+}
 
-  return false, manifest.Source
+/*
+  Returns the versions of the package that are known without downloading its manifest
+*/
+func getPackageStatus(baseDir string, packagesConfig *configs.PackagesConfig, config configs.PackageConfig) *PackageStatus {
+  status := &PackageStatus{Id: config.Id, Channel: getPackageChannel(packagesConfig, config), PinnedVersion: config.PinnedVersion}
+  if doesPackageVersionFileExist(baseDir, config) {
+    status.InstalledVersion, status.Error = getPackageVersion(baseDir, config)
+  }
+  _, status.PreviousVersion = Instance().GetInstalledVersions(baseDir, config.Id)
+  return status
 }
 
 /*
-  Check the version file and returns if it matches the version defined in config
+  A release a package is switched to
 */
-func checkVersionIsAccepted(version string, manifestVersion string) bool {
-  // Check if the version defined in the file is accepted
-  accepted, err := compareVersions(manifestVersion, version)
-  if err != nil {
-    handleErr(err)
+type packageUpdate struct {
+  config  configs.PackageConfig
+  release configs.PackageRelease
+}
+
+/*
+  Installs the release of the package, switching back to it if its version is still kept under PACKAGES_DIR and
+  downloading it otherwise
+*/
+func switchToRelease(d *downloader, baseDir string, config configs.PackageConfig, release *configs.PackageRelease) error {
+  return installReleases(d, baseDir, []packageUpdate{{config, *release}})
+}
+
+/*
+  Downloads the releases whose versions are not kept since they were installed, up to MAX_CONCURRENT_DOWNLOADS at a
+  time, and then installs the releases one at a time, since installing asks for the EULA of the package to be accepted
+  Nothing is installed if any of the downloads fails, as the packages may require each other's new versions
+*/
+func installReleases(d *downloader, baseDir string, updates []packageUpdate) error {
+  var downloads []packageUpdate
+  for _, update := range updates {
+    if err := validateVersion(update.release.Version); err != nil {
+      return fmt.Errorf("%v of package %s", err, update.config.Id)
+    }
+    if !isVersionInstalled(baseDir, update.config.Id, update.release.Version) {
+      downloads = append(downloads, update)
+    }
+  }
+  files, errs := downloadReleases(d, baseDir, downloads)
+  for _, download := range downloads {
+    if err := errs[download.config.Id]; err != nil {
+      return err
+    }
+  }
+
+  var result error
+  for _, update := range updates {
+    var err error
+    if file, downloaded := files[update.config.Id]; downloaded {
+      err = installRelease(baseDir, update.config, &update.release, file)
+    } else {
+      fmt.Printf("Switching package %s to the installed version %s\n", update.config.Id, update.release.Version)
+      err = activateVersion(baseDir, filepath.Join(baseDir, update.config.Dir), update.config, update.release.Version)
+    }
+    if err == errEulaNotAccepted {
+      result = err
+      continue
+    }
+    if err != nil {
+      return err
+    }
+  }
+  return result
+}
+
+/*
+  Downloads and verifies the releases concurrently, with a progress bar for each of them
+  Returns the downloaded file and the error of each package, by id
+*/
+func downloadReleases(d *downloader, baseDir string, downloads []packageUpdate) (map[string]string, map[string]error) {
+  files := make(map[string]string)
+  errs := make(map[string]error)
+  if len(downloads) == 0 {
+    return files, errs
+  }
+
+  display := newProgressDisplay(os.Stdout)
+  bars := make([]*progressBar, len(downloads))
+  for i, download := range downloads {
+    bars[i] = display.addBar(download.config.Id)
   }
-  return accepted
+  d.display = display
+  display.start()
+  defer func() {
+    display.close()
+    d.display = nil
+  }()
+
+  var mutex sync.Mutex
+  var wg sync.WaitGroup
+  jobs := make(chan int)
+  for worker := 0; worker < MAX_CONCURRENT_DOWNLOADS && worker < len(downloads); worker++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      for i := range jobs {
+        file, err := downloadRelease(d, baseDir, downloads[i].config, &downloads[i].release, bars[i])
+        mutex.Lock()
+        if err != nil {
+          errs[downloads[i].config.Id] = err
+        } else {
+          files[downloads[i].config.Id] = file
+        }
+        mutex.Unlock()
+      }
+    }()
+  }
+  for i := range downloads {
+    jobs <- i
+  }
+  close(jobs)
+  wg.Wait()
+  return files, errs
 }
 
 /*
-  Fetch the package defined in the provided PackageConfig
+  Downloads the release of the package and verifies it, returns the downloaded file
 */
-func fetchPackage(baseDir string, config configs.PackageConfig, packageLocation string) {
+func downloadRelease(d *downloader, baseDir string, config configs.PackageConfig, release *configs.PackageRelease, bar *progressBar) (string, error) {
+  packageLocation := release.Source
+  if packageLocation == "" {
+    bar.finish(errors.New("not offered"))
+    return "", fmt.Errorf("version %s of package %s is not installed, and is not offered by its manifest", release.Version, config.Id)
+  }
   // Get the target file name based on the source
   sourceArr := strings.Split(packageLocation, "/")
   filename := sourceArr[len(sourceArr)-1]
-  dirPath := filepath.Join(baseDir, config.Dir)
-  targetFile := filepath.Join(dirPath, filename)
-
-  // Normally we would completely remove any existing directory
-  // containing this package via a call like "removeDir(dirPath)",
-  // that way we can start from a clean slate when re-downloading. But
-  // because we switched from our old directory structure of
-  // individually isolated components to a new structure of
-  // overlapping paths (where components end up sharing paths such as
-  // /bin and /etc), now there isn't a clean way to remove an old
-  // package. Therefore we just re-download and overwrite, even though
-  // this is error prone due to statefulness. A less error prone
-  // option would be to delete everything for all packages and
-  // re-download them all, but that will increase download time and
-  // kind of defeats the purpose of having a package manager for
-  // managing separate packages in the first place.
-
-  // create the package dir
-  createDir(dirPath)
-  // download the file
-  downloadFileWithHttp(targetFile, packageLocation, true)
-
-  // TODO: temp decrypt the file
-  var finalFilename string
-  if config.IsEncrypted {
-    finalFilename = decryptFile(targetFile)
+  packageDir := getPackageDir(baseDir, config.Id)
+  // the version is part of the name, so that a partial download is only resumed for the same version
+  targetFile := filepath.Join(packageDir, release.Version+"-"+filename)
+  if err := createDir(packageDir); err != nil {
+    bar.finish(err)
+    return "", err
+  }
+
+  if info, err := os.Stat(targetFile); err == nil {
+    // downloaded by an update that didn't install it, it is verified again
+    atomic.StoreInt64(&bar.current, info.Size())
+    bar.finish(nil)
   } else {
-    finalFilename = targetFile
+    // download the file, from the mirrors of the package if the source fails
+    sources := getDownloadSources(packageLocation, config.Mirrors)
+    if err := d.downloadFile(targetFile, sources, bar); err != nil {
+      return "", fmt.Errorf("Failed to download package %s: %v", config.Id, err)
+    }
   }
 
-  // assume for now we are dealing with tarballs all the time
-  getEulaAcknowledgementAndExtractTarball(finalFilename, dirPath)
+  // nothing is decrypted or extracted before the package is verified
+  if err := verifyPackage(d, targetFile, release, configs.LoadBaseConf(), config.Mirrors); err != nil {
+    removeFile(targetFile)
+    return "", fmt.Errorf("Failed to verify package %s, the download was removed: %v", config.Id, err)
+  }
+  d.println("Verified package:", config.Id)
+  return targetFile, nil
+}
+
+/*
+  Installs a downloaded release of the package, the download is removed afterwards
+*/
+func installRelease(baseDir string, config configs.PackageConfig, release *configs.PackageRelease, targetFile string) error {
+  dirPath := filepath.Join(baseDir, config.Dir)
+  packageDir := getPackageDir(baseDir, config.Id)
+
+  // Components share paths such as /bin and /etc, so a package can't
+  // simply be removed and extracted again. Instead each version is
+  // extracted into its own directory and the files in the shared paths
+  // are symlinks to the current version, which are switched over once
+  // the new version is completely extracted, see installPackage.
+
+  if err := createDir(dirPath); err != nil {
+    return err
+  }
+
+  // assume for now we are dealing with tarballs all the time, encrypted ones are decrypted while they are extracted
+  err := getEulaAcknowledgementAndInstallPackage(baseDir, targetFile, dirPath, config, release.Version)
 
   // cleanup files
   removeFile(targetFile)
-  if config.IsEncrypted {
-    removeFile(finalFilename)
+  if err == nil {
+    // kept for the requirements of the installed version on other packages
+    if err := writeReleaseRecord(packageDir, release); err != nil {
+      fmt.Println("Failed to record the release of package", config.Id+":", err)
+    }
+  }
+  if err != nil && err != errEulaNotAccepted {
+    return fmt.Errorf("Failed to install package %s: %v", config.Id, err)
   }
+  return err
 }
@@ -0,0 +1,294 @@
+package packages
+
+import (
+  "encoding/json"
+  "fmt"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "io/ioutil"
+  "path/filepath"
+  "sort"
+)
+
+const (
+  CHANNEL_STABLE = "stable"
+  CHANNEL_BETA   = "beta"
+
+  // the release a version was installed from is kept next to the list of its files, for its requirements
+  RELEASE_FILE_EXT = ".release"
+)
+
+// channels from the most to the least stable, a channel also gets the releases of the channels before it
+var CHANNELS = []string{CHANNEL_STABLE, CHANNEL_BETA}
+
+/*
+  A package and the releases it can be at, the newest first
+*/
+type packageCandidates struct {
+  config    configs.PackageConfig
+  installed *configs.PackageRelease // nil if the package is not installed
+  releases  []configs.PackageRelease
+  latest    string // the newest release of the manifest in the channel of the package, regardless of constraints
+  fixed     bool   // kept at its installed version
+}
+
+/*
+  Returns the channel of the package, the channel of the packages config if the package doesn't set one
+*/
+func getPackageChannel(packagesConfig *configs.PackagesConfig, config configs.PackageConfig) string {
+  if config.Channel != "" {
+    return config.Channel
+  }
+  if packagesConfig != nil && packagesConfig.Channel != "" {
+    return packagesConfig.Channel
+  }
+  return CHANNEL_STABLE
+}
+
+/*
+  Checks if a release of the channel is installed by packages of the other channel, every channel gets the stable
+  releases and the releases of the channels that are more stable than it, see CHANNELS
+*/
+func isInChannel(releaseChannel string, channel string) bool {
+  if releaseChannel == "" {
+    releaseChannel = CHANNEL_STABLE
+  }
+  if releaseChannel == channel || releaseChannel == CHANNEL_STABLE {
+    return true
+  }
+  for _, c := range CHANNELS {
+    if c == releaseChannel {
+      return true
+    }
+    if c == channel {
+      return false
+    }
+  }
+  return false
+}
+
+/*
+  Returns the release at the top of the manifest, if it has a version, followed by the other releases
+*/
+func getManifestReleases(manifest *configs.PackageManifest) []configs.PackageRelease {
+  var releases []configs.PackageRelease
+  if manifest.Version != "" {
+    releases = append(releases, manifest.PackageRelease)
+  }
+  return append(releases, manifest.Releases...)
+}
+
+/*
+  Collects the releases the package can be switched to, from its manifest if it could be downloaded and from the
+  versions that are kept since they were installed, the manifest is nil otherwise
+  The releases are limited to the channel, version range and pinned version of the package, except that the
+  installed version isn't dropped for being in another channel, so that switching to a more stable channel doesn't
+  downgrade packages
+*/
+func getCandidates(baseDir string, packagesConfig *configs.PackagesConfig, config configs.PackageConfig, manifest *configs.PackageManifest) (*packageCandidates, error) {
+  candidates := &packageCandidates{config: config}
+  var constraint *versionConstraint
+  if config.VersionConstraint != "" {
+    var err error
+    if constraint, err = parseVersionConstraint(config.VersionConstraint); err != nil {
+      return nil, fmt.Errorf("invalid VersionConstraint of package %s: %v", config.Id, err)
+    }
+  }
+  channel := getPackageChannel(packagesConfig, config)
+
+  var releases []configs.PackageRelease
+  if manifest != nil {
+    releases = getManifestReleases(manifest)
+    for _, release := range releases {
+      if !isInChannel(release.Channel, channel) {
+        continue
+      }
+      if version, err := parseSemanticVersion(release.Version); err == nil && isNewerVersion(version, candidates.latest) {
+        candidates.latest = release.Version
+      }
+    }
+  }
+  installedVersion := ""
+  if doesPackageVersionFileExist(baseDir, config) {
+    installedVersion, _ = getPackageVersion(baseDir, config)
+  }
+  if installedVersion != "" {
+    installed := getInstalledRelease(baseDir, config.Id, installedVersion, releases)
+    candidates.installed = &installed
+    releases = append(releases, installed)
+  }
+  current, previous := Instance().GetInstalledVersions(baseDir, config.Id)
+  for _, version := range []string{current, previous} {
+    if version != "" {
+      releases = append(releases, getInstalledRelease(baseDir, config.Id, version, releases))
+    }
+  }
+
+  seen := make(map[string]bool)
+  for _, release := range releases {
+    version, err := parseSemanticVersion(release.Version)
+    if err != nil || seen[version.String()] {
+      continue
+    }
+    seen[version.String()] = true
+    isInstalled := candidates.installed != nil && release.Version == candidates.installed.Version
+    if !isInstalled && !isInChannel(release.Channel, channel) {
+      continue
+    }
+    if constraint != nil && !constraint.allows(version) {
+      continue
+    }
+    if config.PinnedVersion != "" && !isSameVersion(version, config.PinnedVersion) {
+      continue
+    }
+    candidates.releases = append(candidates.releases, release)
+  }
+  sortReleases(candidates.releases)
+  return candidates, nil
+}
+
+/*
+  Returns the release the version was installed from, which is the release of the manifest with that version if it
+  wasn't recorded, ie. because it was installed by an earlier version of mcli
+*/
+func getInstalledRelease(baseDir string, id string, version string, manifestReleases []configs.PackageRelease) configs.PackageRelease {
+  if release, err := readReleaseRecord(getPackageDir(baseDir, id), version); err == nil {
+    return *release
+  }
+  for _, release := range manifestReleases {
+    if release.Version == version {
+      return release
+    }
+  }
+  return configs.PackageRelease{Version: version}
+}
+
+/*
+  A package that is kept at its installed version
+*/
+func getFixedCandidates(candidates *packageCandidates) *packageCandidates {
+  fixed := &packageCandidates{config: candidates.config, installed: candidates.installed, latest: candidates.latest, fixed: true}
+  if candidates.installed != nil {
+    fixed.releases = []configs.PackageRelease{*candidates.installed}
+  }
+  return fixed
+}
+
+/*
+  Chooses a release for each of the packages so that all their requirements on each other are met, preferring newer
+  releases of the packages that come first, packages without any releases, ie. that are not installed and kept at
+  their installed version, are left out
+*/
+func resolveVersions(packages []*packageCandidates) (map[string]configs.PackageRelease, error) {
+  var included []*packageCandidates
+  for _, p := range packages {
+    if len(p.releases) > 0 || !p.fixed {
+      included = append(included, p)
+    }
+  }
+
+  chosen := make(map[string]configs.PackageRelease)
+  conflict := ""
+  var resolve func(i int) bool
+  resolve = func(i int) bool {
+    if i == len(included) {
+      return true
+    }
+    p := included[i]
+    if len(p.releases) == 0 && conflict == "" {
+      conflict = fmt.Sprintf("no release of %s is in its channel and version range", p.config.Id)
+    }
+    for _, release := range p.releases {
+      if reason := checkCompatibleWithChosen(p.config, release, included[:i], chosen); reason != "" {
+        conflict = reason
+        continue
+      }
+      chosen[p.config.Id] = release
+      if resolve(i + 1) {
+        return true
+      }
+      delete(chosen, p.config.Id)
+    }
+    return false
+  }
+  if !resolve(0) {
+    return nil, fmt.Errorf("no versions of the packages meet all their version requirements, %s", conflict)
+  }
+  return chosen, nil
+}
+
+func checkCompatibleWithChosen(config configs.PackageConfig, release configs.PackageRelease, others []*packageCandidates, chosen map[string]configs.PackageRelease) string {
+  for _, other := range others {
+    otherRelease := chosen[other.config.Id]
+    if reason := checkRequirements(config, release, other.config.Id, otherRelease); reason != "" {
+      return reason
+    }
+    if reason := checkRequirements(other.config, otherRelease, config.Id, release); reason != "" {
+      return reason
+    }
+  }
+  return ""
+}
+
+/*
+  Returns why the release of the package doesn't work with the release of the other package, empty if it does
+  Requirements come from the packages config and from the release itself, requirements on packages that are not
+  configured are ignored
+*/
+func checkRequirements(config configs.PackageConfig, release configs.PackageRelease, otherId string, otherRelease configs.PackageRelease) string {
+  for _, requires := range []map[string]string{config.Requires, release.Requires} {
+    requirement, exists := requires[otherId]
+    if !exists {
+      continue
+    }
+    constraint, err := parseVersionConstraint(requirement)
+    if err != nil {
+      return fmt.Sprintf("%s %s has an invalid requirement on %s: %v", config.Id, release.Version, otherId, err)
+    }
+    version, err := parseSemanticVersion(otherRelease.Version)
+    if err != nil || !constraint.allows(version) {
+      return fmt.Sprintf("%s %s requires %s %s, not %s", config.Id, release.Version, otherId, requirement, otherRelease.Version)
+    }
+  }
+  return ""
+}
+
+/*
+  Sorts the releases from the newest to the oldest
+*/
+func sortReleases(releases []configs.PackageRelease) {
+  sort.SliceStable(releases, func(i, j int) bool {
+    a, _ := parseSemanticVersion(releases[i].Version)
+    b, _ := parseSemanticVersion(releases[j].Version)
+    return a.compare(b) > 0
+  })
+}
+
+func isNewerVersion(version *semanticVersion, than string) bool {
+  other, err := parseSemanticVersion(than)
+  return err != nil || version.compare(other) > 0
+}
+
+func isSameVersion(version *semanticVersion, other string) bool {
+  parsed, err := parseSemanticVersion(other)
+  return err == nil && version.compare(parsed) == 0
+}
+
+func writeReleaseRecord(packageDir string, release *configs.PackageRelease) error {
+  content, err := json.MarshalIndent(release, "", " ")
+  if err != nil {
+    return err
+  }
+  return ioutil.WriteFile(filepath.Join(packageDir, release.Version+RELEASE_FILE_EXT), content, 0644)
+}
+
+func readReleaseRecord(packageDir string, version string) (*configs.PackageRelease, error) {
+  content, err := ioutil.ReadFile(filepath.Join(packageDir, version+RELEASE_FILE_EXT))
+  if err != nil {
+    return nil, err
+  }
+  release := configs.PackageRelease{}
+  if err := json.Unmarshal(content, &release); err != nil {
+    return nil, err
+  }
+  return &release, nil
+}
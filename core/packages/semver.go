@@ -0,0 +1,316 @@
+package packages
+
+import (
+  "fmt"
+  "strconv"
+  "strings"
+)
+
+const (
+  CONSTRAINT_OR = "||"
+)
+
+// comparison operators of version constraints, the longer ones first so that they are matched before their prefixes
+var CONSTRAINT_OPERATORS = []string{">=", "<=", "!=", ">", "<", "=", "~", "^"}
+
+/*
+  A semantic version as defined by https://semver.org, ie. 0.2.0-beta.1+build.5
+*/
+type semanticVersion struct {
+  major      uint64
+  minor      uint64
+  patch      uint64
+  preRelease []string
+  build      string // ignored when comparing versions
+}
+
+/*
+  Parses a semantic version, a leading v is allowed
+*/
+func parseSemanticVersion(version string) (*semanticVersion, error) {
+  invalid := fmt.Errorf("invalid version %q, expected a semantic version such as 0.1.2", version)
+  text := strings.TrimPrefix(strings.TrimSpace(version), "v")
+
+  parsed := &semanticVersion{}
+  if i := strings.Index(text, "+"); i >= 0 {
+    parsed.build = text[i+1:]
+    if !isValidIdentifiers(parsed.build, false) {
+      return nil, invalid
+    }
+    text = text[:i]
+  }
+  if i := strings.Index(text, "-"); i >= 0 {
+    if !isValidIdentifiers(text[i+1:], true) {
+      return nil, invalid
+    }
+    parsed.preRelease = strings.Split(text[i+1:], ".")
+    text = text[:i]
+  }
+
+  numbers := strings.Split(text, ".")
+  if len(numbers) != 3 {
+    return nil, invalid
+  }
+  for i, target := range []*uint64{&parsed.major, &parsed.minor, &parsed.patch} {
+    if !isNumeric(numbers[i]) || (len(numbers[i]) > 1 && numbers[i][0] == '0') {
+      return nil, invalid
+    }
+    number, err := strconv.ParseUint(numbers[i], 10, 64)
+    if err != nil {
+      return nil, invalid
+    }
+    *target = number
+  }
+  return parsed, nil
+}
+
+/*
+  Checks the dot separated identifiers of a pre-release or build metadata, numeric pre-release identifiers can't have
+  leading zeros
+*/
+func isValidIdentifiers(identifiers string, preRelease bool) bool {
+  for _, identifier := range strings.Split(identifiers, ".") {
+    if identifier == "" {
+      return false
+    }
+    for _, c := range identifier {
+      if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-') {
+        return false
+      }
+    }
+    if preRelease && isNumeric(identifier) && len(identifier) > 1 && identifier[0] == '0' {
+      return false
+    }
+  }
+  return true
+}
+
+func isNumeric(text string) bool {
+  if text == "" {
+    return false
+  }
+  for _, c := range text {
+    if c < '0' || c > '9' {
+      return false
+    }
+  }
+  return true
+}
+
+/*
+  Returns -1, 0 or 1 if v has a lower, the same or a higher precedence than other
+*/
+func (v *semanticVersion) compare(other *semanticVersion) int {
+  if c := compareNumbers(v.major, other.major); c != 0 {
+    return c
+  }
+  if c := compareNumbers(v.minor, other.minor); c != 0 {
+    return c
+  }
+  if c := compareNumbers(v.patch, other.patch); c != 0 {
+    return c
+  }
+
+  // a pre-release has a lower precedence than the release
+  switch {
+  case len(v.preRelease) == 0 && len(other.preRelease) == 0:
+    return 0
+  case len(v.preRelease) == 0:
+    return 1
+  case len(other.preRelease) == 0:
+    return -1
+  }
+  for i := 0; i < len(v.preRelease) && i < len(other.preRelease); i++ {
+    if c := comparePreReleaseIdentifiers(v.preRelease[i], other.preRelease[i]); c != 0 {
+      return c
+    }
+  }
+  return compareNumbers(uint64(len(v.preRelease)), uint64(len(other.preRelease)))
+}
+
+/*
+  Numeric identifiers are compared numerically and have a lower precedence than alphanumeric ones
+*/
+func comparePreReleaseIdentifiers(a string, b string) int {
+  aNumeric, bNumeric := isNumeric(a), isNumeric(b)
+  switch {
+  case aNumeric && bNumeric:
+    aNumber, _ := strconv.ParseUint(a, 10, 64)
+    bNumber, _ := strconv.ParseUint(b, 10, 64)
+    return compareNumbers(aNumber, bNumber)
+  case aNumeric:
+    return -1
+  case bNumeric:
+    return 1
+  }
+  return strings.Compare(a, b)
+}
+
+func compareNumbers(a uint64, b uint64) int {
+  switch {
+  case a < b:
+    return -1
+  case a > b:
+    return 1
+  }
+  return 0
+}
+
+/*
+  Whether both versions are the same major.minor.patch, disregarding their pre-releases
+*/
+func (v *semanticVersion) isSameRelease(other *semanticVersion) bool {
+  return v.major == other.major && v.minor == other.minor && v.patch == other.patch
+}
+
+func (v *semanticVersion) String() string {
+  version := fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+  if len(v.preRelease) > 0 {
+    version += "-" + strings.Join(v.preRelease, ".")
+  }
+  if v.build != "" {
+    version += "+" + v.build
+  }
+  return version
+}
+
+type versionComparator struct {
+  operator string
+  version  *semanticVersion
+  implicit bool // the upper bound of a tilde or caret range
+}
+
+/*
+  A version range, the comparator sets are separated by || and a version is in the range if it satisfies all the
+  comparators of one of the sets, ie. ">=0.1.700 <0.2.0 || ^0.3.0"
+*/
+type versionConstraint struct {
+  text string
+  sets [][]versionComparator
+}
+
+/*
+  Parses a version range, the comparators are the operators =, !=, >, >=, <, <=, a bare version which is the same as =,
+  ~1.2.3 for >=1.2.3 <1.3.0 and ^1.2.3 for >=1.2.3 <2.0.0 (^0.2.3 for >=0.2.3 <0.3.0)
+*/
+func parseVersionConstraint(constraint string) (*versionConstraint, error) {
+  parsed := &versionConstraint{text: strings.TrimSpace(constraint)}
+  for _, set := range strings.Split(constraint, CONSTRAINT_OR) {
+    fields := strings.Fields(set)
+    if len(fields) == 0 {
+      return nil, fmt.Errorf("invalid version range %q, a range can't be empty", constraint)
+    }
+    var comparators []versionComparator
+    for i := 0; i < len(fields); i++ {
+      field := fields[i]
+      // allow a space between the operator and the version, ie. ">= 0.1.700"
+      if isConstraintOperator(field) && i+1 < len(fields) {
+        i++
+        field += fields[i]
+      }
+      comparator, err := parseVersionComparator(field)
+      if err != nil {
+        return nil, fmt.Errorf("invalid version range %q: %v", constraint, err)
+      }
+      comparators = append(comparators, comparator...)
+    }
+    parsed.sets = append(parsed.sets, comparators)
+  }
+  return parsed, nil
+}
+
+func isConstraintOperator(text string) bool {
+  for _, operator := range CONSTRAINT_OPERATORS {
+    if text == operator {
+      return true
+    }
+  }
+  return false
+}
+
+/*
+  Parses a comparator, tilde and caret ranges become a lower and an upper bound
+*/
+func parseVersionComparator(text string) ([]versionComparator, error) {
+  operator := "="
+  for _, candidate := range CONSTRAINT_OPERATORS {
+    if strings.HasPrefix(text, candidate) {
+      operator = candidate
+      text = text[len(candidate):]
+      break
+    }
+  }
+  version, err := parseSemanticVersion(text)
+  if err != nil {
+    return nil, err
+  }
+
+  var upper *semanticVersion
+  switch operator {
+  case "~":
+    upper = &semanticVersion{major: version.major, minor: version.minor + 1}
+  case "^":
+    switch {
+    case version.major > 0:
+      upper = &semanticVersion{major: version.major + 1}
+    case version.minor > 0:
+      upper = &semanticVersion{minor: version.minor + 1}
+    default:
+      upper = &semanticVersion{patch: version.patch + 1}
+    }
+  default:
+    return []versionComparator{{operator: operator, version: version}}, nil
+  }
+  // the upper bound excludes the pre-releases of the next version, ie. ^0.2.3 doesn't allow 0.3.0-beta
+  upper.preRelease = []string{"0"}
+  return []versionComparator{{operator: ">=", version: version}, {operator: "<", version: upper, implicit: true}}, nil
+}
+
+/*
+  Checks if the version is in the range, pre-releases are only in the range if one of the comparators of the set is
+  a pre-release of the same major.minor.patch, so that ie. <0.2.0 doesn't allow 0.2.0-beta
+*/
+func (c *versionConstraint) allows(version *semanticVersion) bool {
+  for _, set := range c.sets {
+    if allowsVersion(set, version) {
+      return true
+    }
+  }
+  return false
+}
+
+func allowsVersion(comparators []versionComparator, version *semanticVersion) bool {
+  preReleaseAllowed := len(version.preRelease) == 0
+  for _, comparator := range comparators {
+    if !comparator.allows(version) {
+      return false
+    }
+    if !comparator.implicit && len(comparator.version.preRelease) > 0 && comparator.version.isSameRelease(version) {
+      preReleaseAllowed = true
+    }
+  }
+  return preReleaseAllowed
+}
+
+func (c versionComparator) allows(version *semanticVersion) bool {
+  compared := version.compare(c.version)
+  switch c.operator {
+  case "=":
+    return compared == 0
+  case "!=":
+    return compared != 0
+  case ">":
+    return compared > 0
+  case ">=":
+    return compared >= 0
+  case "<":
+    return compared < 0
+  case "<=":
+    return compared <= 0
+  }
+  return false
+}
+
+func (c *versionConstraint) String() string {
+  return c.text
+}
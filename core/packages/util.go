@@ -3,170 +3,17 @@ package packages
 import (
   "archive/tar"
   "compress/gzip"
-  "encoding/json"
   "errors"
   "fmt"
   "github.com/MarconiProtocol/cli/core/configs"
   "io"
   "io/ioutil"
-  "net/http"
   "os"
-  "os/exec"
   "path/filepath"
   "runtime/debug"
-  "strconv"
   "strings"
-  "time"
 )
 
-/*
-  Download manifest file
-*/
-func downloadManifestWithHttp(source string) (*configs.PackageManifest, error) {
-  for attempts := 1; attempts <= 3; attempts++ {
-    // Make an http request to get the package file
-    request, err := http.NewRequest("GET", source, nil)
-    if err != nil {
-      fmt.Println("Error with GET request:", err, "Retrying...")
-      time.Sleep(3 * time.Second)
-      continue
-    }
-
-    resp, err := http.DefaultClient.Do(request)
-    if err != nil {
-      fmt.Println("Error with sending http request:", err, "Retrying...")
-      time.Sleep(3 * time.Second)
-      continue
-    }
-    defer resp.Body.Close()
-    if resp.StatusCode != 200 {
-      fmt.Println("Http response status:", resp.Status)
-    }
-
-    bytes, err := ioutil.ReadAll(resp.Body)
-    manifest := configs.PackageManifest{}
-    err = json.Unmarshal(bytes, &manifest)
-    if err != nil {
-      return nil, errors.New(fmt.Sprintf("Failed to download manifest file: %s  - Err: %s", source, err))
-    }
-    return &manifest, nil
-  }
-  return nil, errors.New(fmt.Sprintf("Maximum retry limit reached. Failed to download file: %s Exiting.", source))
-}
-
-/*
-  Downloads a file with through an HTTP request.
-*/
-func downloadFileWithHttp(filename string, source string, verbose bool) error {
-  success := false
-  // We've occasionally seen issues when downloading files, for
-  // example "connection reset by peer" which can happen when file
-  // servers are overloaded with download requests from this client
-  // code. It's not always clear what the root cause is, so we're
-  // extra conservative with retrying in most cases in the following
-  // code, even though some errors will be permanent rather than
-  // transient. This code is a bit messy and brittle and can
-  // definitely be improved upon in the future as we learn more about
-  // the common error cases.
-  for attempts := 1; attempts <= 3; attempts++ {
-    if verbose {
-      fmt.Println("\nDownloading file from:", source, "Attempt number:", attempts)
-    }
-    // Make an http request to get the package file
-    request, err := http.NewRequest("GET", source, nil)
-    if err != nil {
-      fmt.Println("Error with GET request:", err, "Retrying...")
-      time.Sleep(3 * time.Second)
-      continue
-    }
-
-    resp, err := http.DefaultClient.Do(request)
-    if err != nil {
-      fmt.Println("Error with sending http request:", err, "Retrying...")
-      time.Sleep(3 * time.Second)
-      continue
-    }
-    defer resp.Body.Close()
-    if resp.StatusCode != 200 {
-      fmt.Println("Http response status:", resp.Status)
-    }
-
-    // Start a download progress printer coroutine, channel used to signal it to end
-    signal := make(chan bool)
-    if verbose {
-      fileSize, _ := strconv.Atoi(resp.Header.Get("Content-Length"))
-      go printDownloadProgress(filename, fileSize, signal)
-    }
-    // Write the contents of body (the package) to a file
-    err = createFile(filename, 0644, resp.Body)
-    // Stop progress bar coroutine
-    if verbose {
-      signal <- true
-    }
-
-    if err != nil {
-      fmt.Println("Error with saving downloaded file:", err, "Retrying...")
-      time.Sleep(3 * time.Second)
-      continue
-    }
-    if verbose {
-      fmt.Println("Downloaded file: ", filename)
-    }
-    success = true
-    break
-  }
-  if !success {
-    handleErr(fmt.Errorf("Maximum retry limit reached. Failed to download file: %s. Exiting.", filename))
-  }
-
-  return nil
-}
-
-/*
-  Prints download progress messages for a given file.
-*/
-func printDownloadProgress(filename string, fileSize int, signal chan bool) {
-  // Continues to print until item is added to signal channel
-  for {
-    // Either end or keep printing progress messages
-    select {
-    case <-signal:
-      return
-    default:
-      // Get the current size of the target file and print a percent based on it and the expected file size
-      file, err := os.Open(filename)
-      if err != nil {
-        continue
-      }
-      fileInfo, err := file.Stat()
-      if err != nil {
-        handleErr(err)
-      }
-      size := fileInfo.Size()
-
-      percent := float64(size) / float64(fileSize) * 100
-      fmt.Printf(getProgressText(percent), percent)
-    }
-    time.Sleep(time.Second)
-  }
-}
-
-func getProgressText(percent float64) string {
-  progressString := "\r"
-  maxNumBars := 50
-  numBars := int(percent) / (100 / maxNumBars)
-  for i := 1; i <= maxNumBars; i++ {
-    switch {
-    case i <= numBars:
-      progressString += "#"
-    default:
-      progressString += " "
-    }
-  }
-  progressString += " (%.2f %%)"
-  return progressString
-}
-
 func acceptUserInput() string {
   response := ""
   _, err := fmt.Scanln(&response)
@@ -219,40 +66,51 @@ func askForPackageUpdateAcknowledgement(packageId string, packageVersion string,
   return
 }
 
-func displayEulaAndAskForAcknowledgement(eula_text string, eula_file_path_to_display string) bool {
+func displayEulaAndAskForAcknowledgement(eula_text string, eula_file_path_to_display string, eula_digest string) bool {
   fmt.Printf("\n\nPlease read the following agreement. If you'd like to re-read it again")
   fmt.Printf("\nin the future, the below text will be at:\n%s", eula_file_path_to_display)
   fmt.Printf("\n\n%s", eula_text)
+  fmt.Printf("\n\nTo accept this agreement without being asked, ie. when provisioning, pass its SHA-256 with")
+  fmt.Printf("\n-accept-eula or %s: %s", ACCEPT_EULA_ENV, eula_digest)
   fmt.Printf("\n\nDo you agree to the above terms? [yes/no]: ")
   response := acceptUserInput()
   return response == "y" || response == "yes"
 }
 
+/*
+  Asks for the EULA of mcli to be accepted, unless it was accepted before and hasn't changed since
+*/
 func CheckOrAskForMcliEulaAcknowledgement(baseDir string) bool {
-  acknowledgement_file_path := filepath.Join(baseDir, "etc/mcli/eula_acknowledgement.txt")
-  expected_ack_string := "I agree to the MCLI end user license agreement.\n"
-  ack_bytes, err := ioutil.ReadFile(acknowledgement_file_path)
-  if err == nil && string(ack_bytes) == expected_ack_string {
-    return true
-  }
-
   eula_path := filepath.Join(baseDir, "EULA.txt")
   eula_bytes, err := ioutil.ReadFile(eula_path)
   if err != nil {
     fmt.Printf("\nFailed to find EULA.txt file for MCLI. Please reinstall the MCLI.\n")
     return false
   }
-  fmt.Printf("\nHi! It looks like you're either running this version of the CLI\nsoftware for the first time or haven't yet acknowledged the license.\n")
-  if !displayEulaAndAskForAcknowledgement(string(eula_bytes), eula_path) {
-    fmt.Printf("\nExiting since you did not agree.\n")
-    return false
+  eula_digest := getEulaDigest(string(eula_bytes))
+  if isEulaAcknowledged(baseDir, MCLI_EULA_ID, eula_digest) {
+    return true
   }
 
-  err = os.MkdirAll(filepath.Dir(acknowledgement_file_path), 0755)
-  if err == nil {
-    err = ioutil.WriteFile(acknowledgement_file_path, []byte(expected_ack_string), 0644)
+  accepted_by := ACCEPTED_BY_PROMPT
+  // acknowledged by an earlier version of mcli, which didn't record the EULA that was accepted, it only counts until
+  // the EULA is recorded so that a changed EULA is asked for again
+  _, recorded := readEulaAcknowledgements(baseDir)[MCLI_EULA_ID]
+  acknowledgement_file_path := filepath.Join(baseDir, "etc/mcli/eula_acknowledgement.txt")
+  expected_ack_string := "I agree to the MCLI end user license agreement.\n"
+  ack_bytes, err := ioutil.ReadFile(acknowledgement_file_path)
+  if recorded || err != nil || string(ack_bytes) != expected_ack_string {
+    if len(Instance().acceptedEulas) == 0 {
+      fmt.Printf("\nHi! It looks like you're either running this version of the CLI\nsoftware for the first time or haven't yet acknowledged the license.\n")
+    }
+    var accepted bool
+    if accepted, accepted_by = acceptEula(MCLI_EULA_ID, string(eula_bytes), eula_path); !accepted {
+      fmt.Printf("\nExiting since you did not agree.\n")
+      return false
+    }
   }
-  if err != nil {
+
+  if err := recordEulaAcknowledgement(baseDir, MCLI_EULA_ID, eula_digest, accepted_by); err != nil {
     fmt.Printf("\nFailed to record eula acknowledgement:\n%v\n", err)
     fmt.Printf("\nThis means you'll be shown the EULA again the next time you run the program.")
     fmt.Printf("\nPerhaps check the write permissions on your MCLI installation directory to fix this for good.\n")
@@ -260,42 +118,54 @@ func CheckOrAskForMcliEulaAcknowledgement(baseDir string) bool {
   return true
 }
 
+// returned when the user doesn't agree to the EULA of a package, which is not a failure of the install
+var errEulaNotAccepted = errors.New("the EULA of the package was not accepted")
+
 /*
   Looks for a *eula.txt file in a tarball, prints it and gets user
-  acknowledgement, then extracts everything in the tarball file to a
-  target directory.
+  acknowledgement, then installs the version of the package in the tarball
+  to a target directory. Encrypted packages are decrypted while they are read.
+  The user is only asked if the EULA changed since it was last accepted for
+  the package, and not at all if its SHA-256 was passed with -accept-eula.
 */
-func getEulaAcknowledgementAndExtractTarball(tarballName string, targetDir string) {
+func getEulaAcknowledgementAndInstallPackage(baseDir string, tarballName string, targetDir string, config configs.PackageConfig, version string) error {
   // It seems tar format only allows sequential access to data, so we
   // end up reading the tarball twice, once to look for a *eula.txt
   // file and once again to actually extract the data. This is because
   // we want to be careful not to extract the data if the user doesn't
   // acknowledge the eula.
-  eula_filename, eula_text, err := extractEula(tarballName)
+  eula_filename, eula_text, err := extractEula(tarballName, config)
   if err != nil {
-    fmt.Println("FATAL ERROR: Failed to extract a EULA from downloaded package. Exiting.")
-    handleErr(err)
+    return fmt.Errorf("Failed to extract a EULA from downloaded package: %v", err)
   }
   eula_path := filepath.Join(targetDir, eula_filename)
-  if displayEulaAndAskForAcknowledgement(eula_text, eula_path) {
-    fmt.Printf("\nInstalling package.\n")
-    extractTarball(tarballName, targetDir)
-  } else {
-    fmt.Printf("\nSkipping installation of this package since you did not agree.\n")
+  eula_digest := getEulaDigest(eula_text)
+  if !isEulaAcknowledged(baseDir, config.Id, eula_digest) {
+    accepted, accepted_by := acceptEula(config.Id, eula_text, eula_path)
+    if !accepted {
+      fmt.Printf("\nSkipping installation of this package since you did not agree.\n")
+      return errEulaNotAccepted
+    }
+    if err := recordEulaAcknowledgement(baseDir, config.Id, eula_digest, accepted_by); err != nil {
+      fmt.Printf("\nFailed to record eula acknowledgement of package %s, it will be asked for again: %v\n", config.Id, err)
+    }
   }
+  fmt.Printf("\nInstalling package.\n")
+  return installPackage(baseDir, tarballName, targetDir, config, version)
 }
 
-func extractEula(tarballName string) (string, string, error) {
-  file, err := os.Open(tarballName)
+func extractEula(tarballName string, config configs.PackageConfig) (string, string, error) {
+  file, err := openPackage(tarballName, config)
   if err != nil {
-    handleErr(err)
+    return "", "", err
   }
+  defer file.Close()
 
   // file is tar'ed then gzipped, we need to do the reverse
   // gzip reader
   gzReader, err := gzip.NewReader(file)
   if err != nil {
-    handleErr(err)
+    return "", "", err
   }
   defer gzReader.Close()
   // tar reader
@@ -304,62 +174,23 @@ func extractEula(tarballName string) (string, string, error) {
   for {
     // tar's reader returns next entry in tar, or EOF if done
     header, err := tarReader.Next()
+    if err == io.EOF {
+      return "", "", errors.New("the package has no EULA")
+    }
     if err != nil {
       return "", "", err
     }
 
     lowered_name := strings.ToLower(header.Name)
     if strings.HasSuffix(lowered_name, "eula.txt") &&
-      header.FileInfo().Mode().IsRegular() {
-      content, err := ioutil.ReadAll(tarReader)
+      header.Typeflag == tar.TypeReg {
+      content, err := ioutil.ReadAll(io.LimitReader(tarReader, MAX_EULA_SIZE))
       if err != nil {
-        handleErr(err)
+        return "", "", err
       }
       return header.Name, string(content), nil
     }
   }
-  return "", "", err
-}
-
-func extractTarball(tarballName string, targetDir string) error {
-  fmt.Println("\nUntaring file: ", tarballName)
-
-  file, err := os.Open(tarballName)
-  if err != nil {
-    handleErr(err)
-  }
-
-  // file is tar'ed then gzipped, we need to do the reverse
-  // gzip reader
-  gzReader, err := gzip.NewReader(file)
-  if err != nil {
-    handleErr(err)
-  }
-  defer gzReader.Close()
-  // tar reader
-  tarReader := tar.NewReader(gzReader)
-
-  for {
-    // tar's reader returns next entry in tar, or EOF if done
-    header, err := tarReader.Next()
-    switch {
-    case err != nil:
-      return err
-    case err == io.EOF:
-      return nil
-    }
-
-    // create dir or create file
-    targetFile := filepath.Join(targetDir, header.Name)
-    switch {
-    case header.FileInfo().Mode().IsDir():
-      createDir(targetFile)
-    case header.FileInfo().Mode().IsRegular():
-      createFile(targetFile, os.FileMode(header.Mode), tarReader)
-    case header.FileInfo().Mode()&os.ModeSymlink != 0:
-      createSymlink(header.Linkname, targetFile)
-    }
-  }
 }
 
 /*
@@ -384,11 +215,12 @@ func createFile(fileName string, fileMode os.FileMode, reader io.Reader) error {
     return err
   }
 
-  file, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, fileMode)
+  file, err := os.OpenFile(fileName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, fileMode)
   if err != nil {
     return err
   }
   if _, err := io.Copy(file, reader); err != nil {
+    file.Close()
     return err
   }
   err = file.Close()
@@ -398,13 +230,6 @@ func createFile(fileName string, fileMode os.FileMode, reader io.Reader) error {
   return nil
 }
 
-/*
-  Create a symlink to sourceFile at symlinkFile
-*/
-func createSymlink(sourceFile string, symlinkFile string) {
-  os.Symlink(sourceFile, symlinkFile)
-}
-
 /*
   Removes a directory at target path
 */
@@ -416,61 +241,6 @@ func removeFile(path string) error {
   return os.Remove(path)
 }
 
-/*
-  Compare version a with version b,
-  returns true if version b is equal or later than version a
-*/
-func compareVersions(a string, b string) (bool, error) {
-  majorA, minorA, buildA, err := parseVersionString(a)
-  if err != nil {
-    return false, err
-  }
-  majorB, minorB, buildB, err := parseVersionString(b)
-  if err != nil {
-    return false, err
-  }
-  return majorB >= majorA && minorB >= minorA && buildB >= buildA, nil
-}
-
-/*
-  Version format is major.minor.build
-  Returns the integers in the version string
-*/
-func parseVersionString(version string) (int, int, int, error) {
-  versionArr := strings.Split(version, ".")
-
-  major, err := strconv.Atoi(versionArr[0])
-  if err != nil {
-    return 0, 0, 0, err
-  }
-  minor, err := strconv.Atoi(versionArr[1])
-  if err != nil {
-    return 0, 0, 0, err
-  }
-  build, err := strconv.Atoi(versionArr[2])
-  if err != nil {
-    return 0, 0, 0, err
-  }
-
-  return major, minor, build, nil
-}
-
-/*
-  TODO: fuck it, use openssl command line tool for now, this is temp anyways
-*/
-func decryptFile(filename string) string {
-  pass := "FKteu_rPb}95Mr,%" // fuck it
-  decryptedFilename := strings.TrimSuffix(filename, ".enc")
-  params := []string{"enc", "-d", "-aes-256-cbc", "-in", filename, "-out", decryptedFilename, "-pass", "pass:" + pass}
-  cmd := exec.Command("openssl", params...)
-  err := cmd.Run()
-  fmt.Println("Decrypted the file:", filename)
-  if err != nil {
-    handleErr(err)
-  }
-  return decryptedFilename
-}
-
 /*
   Generically handle error, print error, stacktrace and exit
 */
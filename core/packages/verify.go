@@ -0,0 +1,165 @@
+package packages
+
+import (
+  "bytes"
+  "crypto/ed25519"
+  "crypto/sha256"
+  "encoding/base64"
+  "encoding/hex"
+  "errors"
+  "fmt"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "io"
+  "io/ioutil"
+  "os"
+  "strings"
+)
+
+const (
+  CHECKSUM_PREFIX      = "sha256:"
+  SIGNATURE_FILE_EXT   = ".sig"
+  MAX_SIGNATURE_LENGTH = 1024
+)
+
+/*
+  Verifies a downloaded package against the SHA-256 checksum of its release in the manifest, and against its
+  detached ed25519 signature by one of the signing keys pinned in mcli.json
+  Without pinned keys the package is refused, unless AllowUnsignedPackages is set in mcli.json
+  The signature is over the SHA-256 digest of the package, so that the package doesn't have to be read into memory
+*/
+func verifyPackage(d *downloader, filename string, release *configs.PackageRelease, baseConfig *configs.BaseConfig, mirrors []string) error {
+  expected, err := parseChecksum(release.Checksum)
+  if err != nil {
+    return err
+  }
+  digest, err := computeSha256(filename)
+  if err != nil {
+    return err
+  }
+  if !bytes.Equal(digest, expected) {
+    return fmt.Errorf("checksum mismatch for %s: expected %x, got %x", release.Source, expected, digest)
+  }
+
+  if len(baseConfig.PackageSigningKeys) == 0 {
+    if !baseConfig.AllowUnsignedPackages {
+      return fmt.Errorf("no package signing keys are configured in mcli.json, refusing to install %s without verifying its signature", release.Source)
+    }
+    d.println("Warning: AllowUnsignedPackages is set in mcli.json, the signature of", release.Source, "is not verified")
+    return nil
+  }
+  publicKeys, err := parseSigningKeys(baseConfig.PackageSigningKeys)
+  if err != nil {
+    return err
+  }
+  signature, err := downloadSignature(d, getDownloadSources(getSignatureSource(release), mirrors))
+  if err != nil {
+    return err
+  }
+  for _, publicKey := range publicKeys {
+    if ed25519.Verify(publicKey, digest, signature) {
+      return nil
+    }
+  }
+  return fmt.Errorf("signature of %s is not valid for any of the package signing keys in mcli.json", release.Source)
+}
+
+func getSignatureSource(release *configs.PackageRelease) string {
+  if release.SignatureSource != "" {
+    return release.SignatureSource
+  }
+  return release.Source + SIGNATURE_FILE_EXT
+}
+
+/*
+  Parses a hex encoded SHA-256 checksum, optionally prefixed with sha256:
+*/
+func parseChecksum(checksum string) ([]byte, error) {
+  checksum = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(checksum)), CHECKSUM_PREFIX)
+  if checksum == "" {
+    return nil, errors.New("the package manifest has no checksum, refusing to install an unverified package")
+  }
+  digest, err := hex.DecodeString(checksum)
+  if err != nil || len(digest) != sha256.Size {
+    return nil, fmt.Errorf("invalid checksum %s in the package manifest, expected a hex encoded SHA-256", checksum)
+  }
+  return digest, nil
+}
+
+func computeSha256(filename string) ([]byte, error) {
+  file, err := os.Open(filename)
+  if err != nil {
+    return nil, err
+  }
+  defer file.Close()
+
+  hash := sha256.New()
+  if _, err := io.Copy(hash, file); err != nil {
+    return nil, err
+  }
+  return hash.Sum(nil), nil
+}
+
+/*
+  Parses base64 or hex encoded ed25519 public keys
+*/
+func parseSigningKeys(signingKeys []string) ([]ed25519.PublicKey, error) {
+  var publicKeys []ed25519.PublicKey
+  for _, signingKey := range signingKeys {
+    key, err := decodeKey(signingKey, ed25519.PublicKeySize)
+    if err != nil {
+      return nil, fmt.Errorf("invalid package signing key %s in mcli.json, expected a base64 or hex encoded ed25519 public key", signingKey)
+    }
+    publicKeys = append(publicKeys, ed25519.PublicKey(key))
+  }
+  return publicKeys, nil
+}
+
+/*
+  Downloads a detached signature, which is either the raw signature or its base64 or hex encoding
+*/
+func downloadSignature(d *downloader, sources []string) ([]byte, error) {
+  source := sources[0]
+  tempFile, err := ioutil.TempFile("", "mcli-signature")
+  if err != nil {
+    return nil, err
+  }
+  tempFile.Close()
+  defer removeFile(tempFile.Name())
+
+  if err := d.downloadFile(tempFile.Name(), sources, nil); err != nil {
+    return nil, fmt.Errorf("failed to download the signature %s: %v", source, err)
+  }
+  content, err := ioutil.ReadFile(tempFile.Name())
+  if err != nil {
+    return nil, err
+  }
+  if len(content) > MAX_SIGNATURE_LENGTH {
+    return nil, fmt.Errorf("%s is not a signature", source)
+  }
+  if len(content) == ed25519.SignatureSize {
+    return content, nil
+  }
+  signature, err := decodeKey(string(content), ed25519.SignatureSize)
+  if err != nil {
+    return nil, fmt.Errorf("%s is not a valid ed25519 signature", source)
+  }
+  return signature, nil
+}
+
+/*
+  Decodes a hex or base64 encoded key or signature of the given size
+*/
+func decodeKey(encoded string, size int) ([]byte, error) {
+  encoded = strings.TrimSpace(encoded)
+  var decoded []byte
+  var err error
+  if len(encoded) == hex.EncodedLen(size) {
+    decoded, err = hex.DecodeString(encoded)
+  } else {
+    decoded, err = base64.StdEncoding.DecodeString(encoded)
+  }
+  if err == nil && len(decoded) != size {
+    err = fmt.Errorf("expected %d bytes, got %d", size, len(decoded))
+  }
+  return decoded, err
+}
@@ -0,0 +1,82 @@
+package packages
+
+import (
+  "crypto/ed25519"
+  "crypto/sha256"
+  "encoding/base64"
+  "encoding/hex"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "io/ioutil"
+  "net/http"
+  "net/http/httptest"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+/*
+  Writes the test package and serves its signature, returns the release of the package
+*/
+func newSignedRelease(t *testing.T, privateKey ed25519.PrivateKey) (*configs.PackageRelease, string, *httptest.Server) {
+  filename := filepath.Join(t.TempDir(), "package.tgz")
+  if err := ioutil.WriteFile(filename, testPackageContent, 0644); err != nil {
+    t.Fatal(err)
+  }
+  digest := sha256.Sum256(testPackageContent)
+  signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, digest[:]))
+  server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if r.URL.Path != "/package.tgz"+SIGNATURE_FILE_EXT {
+      http.NotFound(w, r)
+      return
+    }
+    w.Write([]byte(signature))
+  }))
+  release := &configs.PackageRelease{Source: server.URL + "/package.tgz", Checksum: CHECKSUM_PREFIX + hex.EncodeToString(digest[:])}
+  return release, filename, server
+}
+
+func TestVerifyPackageSignature(t *testing.T) {
+  publicKey, privateKey, _ := ed25519.GenerateKey(nil)
+  otherKey, _, _ := ed25519.GenerateKey(nil)
+  release, filename, server := newSignedRelease(t, privateKey)
+  defer server.Close()
+
+  tests := []struct {
+    name       string
+    baseConfig configs.BaseConfig
+    expected   string
+  }{
+    {"signed by a pinned key", configs.BaseConfig{PackageSigningKeys: []string{hex.EncodeToString(otherKey), hex.EncodeToString(publicKey)}}, ""},
+    {"signed by another key", configs.BaseConfig{PackageSigningKeys: []string{hex.EncodeToString(otherKey)}}, "not valid"},
+    {"no pinned keys", configs.BaseConfig{}, "no package signing keys"},
+    {"unsigned packages allowed", configs.BaseConfig{AllowUnsignedPackages: true}, ""},
+    {"pinned keys with unsigned packages allowed", configs.BaseConfig{PackageSigningKeys: []string{hex.EncodeToString(otherKey)}, AllowUnsignedPackages: true}, "not valid"},
+  }
+  for _, test := range tests {
+    t.Run(test.name, func(t *testing.T) {
+      err := verifyPackage(newTestDownloader(t), filename, release, &test.baseConfig, nil)
+      if test.expected == "" && err != nil {
+        t.Fatal(err)
+      }
+      if test.expected != "" && (err == nil || !strings.Contains(err.Error(), test.expected)) {
+        t.Fatalf("expected an error containing %q, got %v", test.expected, err)
+      }
+    })
+  }
+}
+
+func TestVerifyPackageChecksum(t *testing.T) {
+  _, privateKey, _ := ed25519.GenerateKey(nil)
+  release, filename, server := newSignedRelease(t, privateKey)
+  defer server.Close()
+  baseConfig := &configs.BaseConfig{AllowUnsignedPackages: true}
+
+  release.Checksum = strings.Repeat("0", sha256.Size*2)
+  if err := verifyPackage(newTestDownloader(t), filename, release, baseConfig, nil); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+    t.Fatalf("expected a checksum mismatch, got %v", err)
+  }
+  release.Checksum = ""
+  if err := verifyPackage(newTestDownloader(t), filename, release, baseConfig, nil); err == nil || !strings.Contains(err.Error(), "no checksum") {
+    t.Fatalf("expected a package without checksum to be refused, got %v", err)
+  }
+}
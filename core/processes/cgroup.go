@@ -0,0 +1,173 @@
+package processes
+
+import (
+  "errors"
+  "fmt"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "io/ioutil"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "syscall"
+)
+
+const (
+  CGROUP_ROOT   = "/sys/fs/cgroup"
+  CGROUP_PARENT = "marconi"
+
+  CPU_MAX_PERIOD = 100000 // microseconds
+)
+
+/*
+  Creates the cgroup of a process and sets its caps, returns the path of the cgroup
+  The processes get their own cgroups under a common parent, as cgroup v2 doesn't allow enabling
+  controllers for a cgroup that has processes of its own such as the one of mcli
+*/
+func setupCgroup(cfg configs.ProcessConfig) (string, error) {
+  if _, err := os.Stat(filepath.Join(CGROUP_ROOT, "cgroup.controllers")); err != nil {
+    return "", fmt.Errorf("cgroup v2 is not mounted at %s", CGROUP_ROOT)
+  }
+
+  parent := filepath.Join(CGROUP_ROOT, CGROUP_PARENT)
+  if err := os.MkdirAll(parent, 0755); err != nil {
+    return "", err
+  }
+  controllers := getCgroupControllers(*cfg.Cgroup)
+  // controllers have to be enabled at every level down to the cgroup of the process
+  for _, dir := range []string{CGROUP_ROOT, parent} {
+    if err := enableCgroupControllers(dir, controllers); err != nil {
+      return "", err
+    }
+  }
+
+  path := filepath.Join(parent, cfg.Id)
+  if err := os.MkdirAll(path, 0755); err != nil {
+    return "", err
+  }
+
+  // only the files of the enabled controllers exist in the cgroup
+  settings := make(map[string]string)
+  if containsString(controllers, "cpu") {
+    if cfg.Cgroup.CpuPercent > 0 {
+      settings["cpu.max"] = fmt.Sprintf("%d %d", cfg.Cgroup.CpuPercent*CPU_MAX_PERIOD/100, CPU_MAX_PERIOD)
+    } else {
+      settings["cpu.max"] = fmt.Sprintf("max %d", CPU_MAX_PERIOD)
+    }
+    if cfg.Cgroup.CpuWeight > 0 {
+      settings["cpu.weight"] = strconv.Itoa(cfg.Cgroup.CpuWeight)
+    }
+  }
+  if containsString(controllers, "memory") {
+    settings["memory.max"] = getCgroupMemoryLimit(cfg.Cgroup.MemoryMax)
+    settings["memory.high"] = getCgroupMemoryLimit(cfg.Cgroup.MemoryHigh)
+  }
+
+  for file, value := range settings {
+    if err := ioutil.WriteFile(filepath.Join(path, file), []byte(value), 0644); err != nil {
+      return "", fmt.Errorf("failed to set %s of %s: %v", file, cfg.Id, err)
+    }
+  }
+  return path, nil
+}
+
+func getCgroupControllers(cfg configs.CgroupConfig) []string {
+  var controllers []string
+  if cfg.CpuPercent > 0 || cfg.CpuWeight > 0 {
+    controllers = append(controllers, "cpu")
+  }
+  if cfg.MemoryMax > 0 || cfg.MemoryHigh > 0 {
+    controllers = append(controllers, "memory")
+  }
+  return controllers
+}
+
+func getCgroupMemoryLimit(megabytes int) string {
+  if megabytes <= 0 {
+    return "max"
+  }
+  return strconv.FormatInt(int64(megabytes)*MEGABYTE, 10)
+}
+
+func enableCgroupControllers(dir string, controllers []string) error {
+  content, err := ioutil.ReadFile(filepath.Join(dir, "cgroup.subtree_control"))
+  if err != nil {
+    return err
+  }
+  enabled := strings.Fields(string(content))
+
+  for _, controller := range controllers {
+    if containsString(enabled, controller) {
+      continue
+    }
+    err := ioutil.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("+"+controller), 0644)
+    if err != nil {
+      return fmt.Errorf("failed to enable the %s controller in %s: %v", controller, dir, err)
+    }
+  }
+  return nil
+}
+
+/*
+  Starts a command inside the cgroup at cgroupPath, or outside of any cgroup if the path is empty
+  The process is placed into the cgroup as it is created, so that neither it nor its first children ever run outside
+  of the caps. Kernels before 5.7 can't do that, the process is then moved into the cgroup right after it started
+*/
+func startInCgroup(newCommand func() (*exec.Cmd, error), cfg configs.ProcessConfig, cgroupPath string) (*exec.Cmd, error) {
+  cmd, err := newCommand()
+  if err != nil {
+    return nil, err
+  }
+  if cgroupPath == "" {
+    return cmd, startWithInheritedAttributes(cmd, cfg)
+  }
+
+  cgroupDir, err := os.Open(cgroupPath)
+  if err == nil {
+    defer cgroupDir.Close()
+    cmd.SysProcAttr.UseCgroupFD = true
+    cmd.SysProcAttr.CgroupFD = int(cgroupDir.Fd())
+    err = startWithInheritedAttributes(cmd, cfg)
+    if !errors.Is(err, syscall.ENOSYS) && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, syscall.E2BIG) {
+      return cmd, err
+    }
+    fmt.Printf("Warning: the kernel can't start %s inside its cgroup, it runs without its caps until it is moved into it\n", cfg.Id)
+    // a command can't be started twice, even if starting it failed
+    if cmd, err = newCommand(); err != nil {
+      return nil, err
+    }
+  } else {
+    fmt.Printf("Warning: failed to open the cgroup of %s, it runs without its caps until it is moved into it: %v\n", cfg.Id, err)
+  }
+  if err := startWithInheritedAttributes(cmd, cfg); err != nil {
+    return nil, err
+  }
+  if err := joinCgroup(cgroupPath, cmd.Process.Pid); err != nil {
+    fmt.Printf("ProcessManager could not apply the cgroup caps of %s: %v\n", cfg.Id, err)
+  }
+  return cmd, nil
+}
+
+/*
+  Moves a started process into its cgroup, the children it creates afterwards are in the cgroup as well
+*/
+func joinCgroup(path string, pid int) error {
+  return ioutil.WriteFile(filepath.Join(path, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644)
+}
+
+/*
+  Removes the cgroup of an exited process, which fails if processes it left behind are still in it
+*/
+func removeCgroup(path string) {
+  os.Remove(path)
+}
+
+func containsString(values []string, value string) bool {
+  for _, v := range values {
+    if v == value {
+      return true
+    }
+  }
+  return false
+}
@@ -25,6 +25,32 @@ func (g *Graph) getOrderedProcessConfigs() []configs.ProcessConfig {
   return procConfigs
 }
 
+/*
+  Groups the process configs by dependency depth, processes in a level only depend on processes in earlier levels
+  so every process in a level can be started at the same time
+*/
+func (g *Graph) getProcessConfigLevels() [][]configs.ProcessConfig {
+  var levels [][]configs.ProcessConfig
+  depths := make(map[string]int)
+
+  // sorted nodes are in topological order, so the depth of every dependency is known before it is needed
+  for _, node := range g.SortedNodes {
+    depth := 0
+    for _, dependencyId := range node.ProcessConfig.Dependencies {
+      if dependencyDepth, exists := depths[dependencyId]; exists && dependencyDepth+1 > depth {
+        depth = dependencyDepth + 1
+      }
+    }
+    depths[node.ProcessConfig.Id] = depth
+
+    for len(levels) <= depth {
+      levels = append(levels, []configs.ProcessConfig{})
+    }
+    levels[depth] = append(levels[depth], node.ProcessConfig)
+  }
+  return levels
+}
+
 /*
   Builds a dependency graph from config which is topologically sorted to find the correct order for process execution
 */
@@ -32,9 +58,9 @@ func buildDependencyGraph(processes []configs.ProcessConfig) *Graph {
   graph := Graph{}
   graph.buildDependencyNodesMap(processes)
 
-  // DFS topological sort
-  for _, node := range graph.NodesMap {
-    if !node.visited && !node.done {
+  // DFS topological sort, in config order so that the result is stable
+  for _, procConfig := range processes {
+    if node := graph.NodesMap[procConfig.Id]; !node.visited && !node.done {
       graph.visit(node)
     }
   }
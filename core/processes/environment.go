@@ -0,0 +1,303 @@
+package processes
+
+import (
+  "bufio"
+  "flag"
+  "fmt"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "io/ioutil"
+  "os"
+  "os/exec"
+  "os/user"
+  "path/filepath"
+  "sort"
+  "strconv"
+  "strings"
+  "syscall"
+)
+
+const (
+  RLIM_INFINITY = ^uint64(0)
+
+  // mcli is run with this as its first argument to start a process with its umask and resource limits, see RunExecWrapper
+  EXEC_WRAPPER_ARG = "--exec-with-attributes"
+  SELF_EXE_PATH    = "/proc/self/exe"
+  // the wrapper reports why it failed to execute the process on this descriptor, which is closed once it does
+  EXEC_WRAPPER_ERROR_FD  = 3
+  EXEC_WRAPPER_EXIT_CODE = 126
+)
+
+/*
+  Set the environment and user of the command as configured
+*/
+func (pm *ProcessManager) applyProcessEnvironment(cmd *exec.Cmd, cfg configs.ProcessConfig) error {
+  env, err := pm.getProcessEnv(cfg)
+  if err != nil {
+    return err
+  }
+  cmd.Env = env
+
+  credential, err := lookupCredential(cfg.User, cfg.Group)
+  if err != nil {
+    return err
+  }
+  if credential != nil {
+    cmd.SysProcAttr.Credential = credential
+  }
+  return nil
+}
+
+/*
+  The environment of mcli, followed by the variables of EnvFile and Env, later variables take precedence
+*/
+func (pm *ProcessManager) getProcessEnv(cfg configs.ProcessConfig) ([]string, error) {
+  env := os.Environ()
+  if cfg.EnvFile != "" {
+    path := cfg.EnvFile
+    if !filepath.IsAbs(path) {
+      path = filepath.Join(pm.baseDir, path)
+    }
+    fileEnv, err := readEnvFile(path)
+    if err != nil {
+      return nil, fmt.Errorf("failed to read EnvFile of %s: %v", cfg.Id, err)
+    }
+    env = append(env, fileEnv...)
+  }
+
+  // sorted so that the environment is the same on every start
+  var keys []string
+  for key := range cfg.Env {
+    keys = append(keys, key)
+  }
+  sort.Strings(keys)
+  for _, key := range keys {
+    env = append(env, key+"="+cfg.Env[key])
+  }
+  return env, nil
+}
+
+/*
+  Reads KEY=VALUE lines, ignoring empty lines and comments, values can be quoted
+*/
+func readEnvFile(path string) ([]string, error) {
+  file, err := os.Open(path)
+  if err != nil {
+    return nil, err
+  }
+  defer file.Close()
+
+  var env []string
+  scanner := bufio.NewScanner(file)
+  for lineNumber := 1; scanner.Scan(); lineNumber++ {
+    line := strings.TrimSpace(scanner.Text())
+    if line == "" || strings.HasPrefix(line, "#") {
+      continue
+    }
+    line = strings.TrimPrefix(line, "export ")
+    separator := strings.Index(line, "=")
+    if separator <= 0 {
+      return nil, fmt.Errorf("line %d is not of the form KEY=VALUE", lineNumber)
+    }
+    key := strings.TrimSpace(line[:separator])
+    value := strings.TrimSpace(line[separator+1:])
+    if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+      value = value[1 : len(value)-1]
+    }
+    env = append(env, key+"="+value)
+  }
+  return env, scanner.Err()
+}
+
+/*
+  Resolves the user and group names or ids, returns nil if neither is set
+*/
+func lookupCredential(userName string, groupName string) (*syscall.Credential, error) {
+  if userName == "" && groupName == "" {
+    return nil, nil
+  }
+
+  credential := syscall.Credential{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())}
+  if userName != "" {
+    u, err := user.Lookup(userName)
+    if err != nil {
+      if u, err = user.LookupId(userName); err != nil {
+        return nil, fmt.Errorf("unknown user %s", userName)
+      }
+    }
+    uid, _ := strconv.ParseUint(u.Uid, 10, 32)
+    gid, _ := strconv.ParseUint(u.Gid, 10, 32)
+    credential.Uid = uint32(uid)
+    credential.Gid = uint32(gid)
+
+    // supplementary groups of the user, otherwise the process keeps the groups of mcli
+    groupIds, err := u.GroupIds()
+    if err == nil {
+      for _, groupId := range groupIds {
+        if id, err := strconv.ParseUint(groupId, 10, 32); err == nil {
+          credential.Groups = append(credential.Groups, uint32(id))
+        }
+      }
+    }
+  }
+  if groupName != "" {
+    g, err := user.LookupGroup(groupName)
+    if err != nil {
+      if g, err = user.LookupGroupId(groupName); err != nil {
+        return nil, fmt.Errorf("unknown group %s", groupName)
+      }
+    }
+    gid, _ := strconv.ParseUint(g.Gid, 10, 32)
+    credential.Gid = uint32(gid)
+  }
+  return &credential, nil
+}
+
+/*
+  Starts the command with the umask and resource limits of the process
+  SysProcAttr has no fields for them, and setting them on mcli while the process is forked would leak them into
+  everything else mcli starts or creates meanwhile, so mcli starts itself as a wrapper that sets them, along with the
+  user and group of the process, in the child and then executes the command, see RunExecWrapper
+*/
+func startWithInheritedAttributes(cmd *exec.Cmd, cfg configs.ProcessConfig) error {
+  if cfg.Umask == "" && cfg.Limits == nil || cmd.Err != nil {
+    return cmd.Start()
+  }
+
+  wrapperArgs := []string{cmd.Args[0], EXEC_WRAPPER_ARG}
+  if cfg.Umask != "" {
+    mask, err := strconv.ParseUint(cfg.Umask, 8, 32)
+    if err != nil || mask > 0777 {
+      return fmt.Errorf("invalid Umask %q of %s, it should be octal ie. \"027\"", cfg.Umask, cfg.Id)
+    }
+    wrapperArgs = append(wrapperArgs, "-umask", strconv.FormatUint(mask, 10))
+  }
+  if cfg.Limits != nil && cfg.Limits.OpenFiles != nil {
+    wrapperArgs = append(wrapperArgs, "-nofile", strconv.FormatInt(*cfg.Limits.OpenFiles, 10))
+  }
+  if cfg.Limits != nil && cfg.Limits.CoreSize != nil {
+    wrapperArgs = append(wrapperArgs, "-core", strconv.FormatInt(*cfg.Limits.CoreSize, 10))
+  }
+  // raising a hard limit requires root, so the wrapper only switches to the user of the process once the limits are set
+  if credential := cmd.SysProcAttr.Credential; credential != nil {
+    var groups []string
+    for _, group := range credential.Groups {
+      groups = append(groups, strconv.FormatUint(uint64(group), 10))
+    }
+    wrapperArgs = append(wrapperArgs, "-uid", strconv.FormatUint(uint64(credential.Uid), 10),
+      "-gid", strconv.FormatUint(uint64(credential.Gid), 10), "-groups", strings.Join(groups, ","))
+    cmd.SysProcAttr.Credential = nil
+  }
+  wrapperArgs = append(wrapperArgs, "--", cmd.Path)
+  cmd.Args = append(wrapperArgs, cmd.Args...)
+  // the executable of mcli, even if it was replaced since it was started
+  cmd.Path = SELF_EXE_PATH
+
+  errorReader, errorWriter, err := os.Pipe()
+  if err != nil {
+    return err
+  }
+  defer errorReader.Close()
+  cmd.ExtraFiles = []*os.File{errorWriter}
+  err = cmd.Start()
+  errorWriter.Close()
+  if err != nil {
+    return err
+  }
+  // nothing is written if the command was executed
+  if message, _ := ioutil.ReadAll(errorReader); len(message) > 0 {
+    cmd.Wait()
+    return fmt.Errorf("%s", message)
+  }
+  return nil
+}
+
+/*
+  Runs in the child mcli forked for a process with a umask or resource limits, with the arguments following
+  EXEC_WRAPPER_ARG: sets them, switches to the user of the process and executes the command of the process
+  Never returns, a failure is reported to the mcli that started it, see startWithInheritedAttributes
+*/
+func RunExecWrapper(args []string) {
+  errorPipe := os.NewFile(EXEC_WRAPPER_ERROR_FD, "exec wrapper errors")
+  fail := func(format string, a ...interface{}) {
+    errorPipe.Write([]byte(fmt.Sprintf(format, a...)))
+    os.Exit(EXEC_WRAPPER_EXIT_CODE)
+  }
+
+  flags := flag.NewFlagSet(EXEC_WRAPPER_ARG, flag.ContinueOnError)
+  umask := flags.Int("umask", -1, "file mode creation mask")
+  openFiles := flags.String("nofile", "", "RLIMIT_NOFILE, -1 for unlimited")
+  coreSize := flags.String("core", "", "RLIMIT_CORE in bytes, -1 for unlimited")
+  uid := flags.Int("uid", -1, "user id to execute the command as")
+  gid := flags.Int("gid", -1, "group id to execute the command as")
+  groups := flags.String("groups", "", "comma separated supplementary group ids")
+  if err := flags.Parse(args); err != nil || flags.NArg() < 2 {
+    fail("invalid arguments of the exec wrapper %v", args)
+  }
+  syscall.CloseOnExec(EXEC_WRAPPER_ERROR_FD)
+
+  limits := []struct {
+    name     string
+    resource int
+    value    string
+  }{
+    {"open files", syscall.RLIMIT_NOFILE, *openFiles},
+    {"core size", syscall.RLIMIT_CORE, *coreSize},
+  }
+  for _, limit := range limits {
+    if limit.value == "" {
+      continue
+    }
+    value, err := strconv.ParseInt(limit.value, 10, 64)
+    if err == nil {
+      err = setLimit(limit.resource, value)
+    }
+    if err != nil {
+      fail("failed to set the %s limit: %v", limit.name, err)
+    }
+  }
+  if *umask >= 0 {
+    syscall.Umask(*umask)
+  }
+  if *uid >= 0 {
+    var groupIds []int
+    for _, group := range strings.Split(*groups, ",") {
+      if id, err := strconv.Atoi(group); err == nil {
+        groupIds = append(groupIds, id)
+      }
+    }
+    if err := syscall.Setgroups(groupIds); err != nil {
+      fail("failed to set the supplementary groups: %v", err)
+    }
+    if err := syscall.Setgid(*gid); err != nil {
+      fail("failed to switch to group %d: %v", *gid, err)
+    }
+    if err := syscall.Setuid(*uid); err != nil {
+      fail("failed to switch to user %d: %v", *uid, err)
+    }
+  }
+
+  // a relative path is relative to the Dir of the process, which is the working directory of the wrapper
+  path := flags.Arg(0)
+  err := syscall.Exec(path, flags.Args()[1:], os.Environ())
+  fail("failed to execute %s: %v", path, err)
+}
+
+/*
+  Sets the soft limit, and the hard limit if it has to be raised
+*/
+func setLimit(resource int, value int64) error {
+  var previous syscall.Rlimit
+  if err := syscall.Getrlimit(resource, &previous); err != nil {
+    return err
+  }
+
+  limit := syscall.Rlimit{Cur: uint64(value), Max: uint64(value)}
+  if value < 0 {
+    limit = syscall.Rlimit{Cur: RLIM_INFINITY, Max: RLIM_INFINITY}
+  }
+  // raising the hard limit requires root, so it is only changed if needed
+  if limit.Max <= previous.Max {
+    limit.Max = previous.Max
+  }
+  return syscall.Setrlimit(resource, &limit)
+}
@@ -0,0 +1,99 @@
+package processes
+
+import (
+  "bytes"
+  "fmt"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "os"
+  "os/exec"
+  "strings"
+  "syscall"
+  "testing"
+)
+
+// the test binary is the executable the exec wrapper and log writer are started from, like mcli is
+func TestMain(m *testing.M) {
+  if len(os.Args) > 1 && os.Args[1] == EXEC_WRAPPER_ARG {
+    RunExecWrapper(os.Args[2:])
+  }
+  if len(os.Args) > 1 && os.Args[1] == LOG_WRITER_ARG {
+    RunLogWriter(os.Args[2:])
+  }
+  os.Exit(m.Run())
+}
+
+func getUmask() int {
+  umask := syscall.Umask(0)
+  syscall.Umask(umask)
+  return umask
+}
+
+func TestStartWithInheritedAttributes(t *testing.T) {
+  openFiles, coreSize := int64(256), int64(0)
+  cfg := configs.ProcessConfig{Id: "test", Umask: "027", Limits: &configs.LimitsConfig{OpenFiles: &openFiles, CoreSize: &coreSize}}
+  var previousLimit syscall.Rlimit
+  syscall.Getrlimit(syscall.RLIMIT_NOFILE, &previousLimit)
+  previousUmask := getUmask()
+
+  var output bytes.Buffer
+  cmd := exec.Command("sh", "-c", "umask; ulimit -Sn; ulimit -Sc")
+  cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+  cmd.Stdout = &output
+  if err := startWithInheritedAttributes(cmd, cfg); err != nil {
+    t.Fatal(err)
+  }
+  if err := cmd.Wait(); err != nil {
+    t.Fatal(err)
+  }
+  if output.String() != "0027\n256\n0\n" {
+    t.Errorf("the process ran with the umask, open files and core size limits %q", output.String())
+  }
+
+  var limit syscall.Rlimit
+  syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit)
+  if limit != previousLimit || getUmask() != previousUmask {
+    t.Errorf("the attributes of the process were set on mcli, limit %v umask %o", limit, getUmask())
+  }
+}
+
+func TestStartWithInheritedAttributesReportsFailures(t *testing.T) {
+  cfg := configs.ProcessConfig{Id: "test", Umask: "027"}
+  cmd := exec.Command("/nonexistent/command")
+  cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+  if err := startWithInheritedAttributes(cmd, cfg); err == nil || !strings.Contains(err.Error(), "failed to execute /nonexistent/command") {
+    t.Fatalf("expected the failure of the wrapper to be reported, got %v", err)
+  }
+
+  cfg.Umask = "0800"
+  cmd = exec.Command("true")
+  cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+  if err := startWithInheritedAttributes(cmd, cfg); err == nil || !strings.Contains(err.Error(), "invalid Umask") {
+    t.Fatalf("expected the invalid umask to be refused, got %v", err)
+  }
+}
+
+func TestStartWithInheritedAttributesAsUser(t *testing.T) {
+  if os.Geteuid() != 0 {
+    t.Skip("switching users requires root")
+  }
+  openFiles := int64(256)
+  cfg := configs.ProcessConfig{Id: "test", User: "nobody", Limits: &configs.LimitsConfig{OpenFiles: &openFiles}}
+  credential, err := lookupCredential(cfg.User, cfg.Group)
+  if err != nil {
+    t.Skip(err)
+  }
+
+  var output bytes.Buffer
+  cmd := exec.Command("sh", "-c", "id -u; ulimit -Sn")
+  cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Credential: credential}
+  cmd.Stdout = &output
+  if err := startWithInheritedAttributes(cmd, cfg); err != nil {
+    t.Fatal(err)
+  }
+  if err := cmd.Wait(); err != nil {
+    t.Fatal(err)
+  }
+  if expected := fmt.Sprintf("%d\n256\n", credential.Uid); output.String() != expected {
+    t.Errorf("expected the process to run as %q, got %q", expected, output.String())
+  }
+}
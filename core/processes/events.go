@@ -0,0 +1,86 @@
+package processes
+
+import (
+  "fmt"
+  "os"
+  "time"
+)
+
+const (
+  EVENT_STARTED   = "started"
+  EVENT_READY     = "ready"
+  EVENT_EXITED    = "exited"
+  EVENT_RESTARTED = "restarted"
+
+  EVENT_BUFFER_SIZE = 64
+)
+
+/*
+  Lifecycle event of a managed process
+*/
+type ProcessEvent struct {
+  Id            string
+  Type          string // one of started, ready, exited or restarted
+  Pid           int
+  Time          time.Time
+  ExitCode      int    // exit code of an exited process, -1 if it was killed by a signal or is unknown
+  ExitStatus    string // description of how an exited process exited
+  StopRequested bool   // whether an exited process was stopped through mcli
+  Restarts      int    // number of times a restarted process has been restarted
+}
+
+func (e ProcessEvent) String() string {
+  switch e.Type {
+  case EVENT_EXITED:
+    return fmt.Sprintf("%s (pid %d) exited: %s", e.Id, e.Pid, e.ExitStatus)
+  case EVENT_RESTARTED:
+    return fmt.Sprintf("%s restarted (%d restarts)", e.Id, e.Restarts)
+  }
+  return fmt.Sprintf("%s (pid %d) %s", e.Id, e.Pid, e.Type)
+}
+
+/*
+  Returns a channel receiving the lifecycle events of all managed processes, and a function to unsubscribe
+  Events are dropped for a subscriber that doesn't keep up, so that a slow subscriber can't hold up the process manager
+*/
+func (pm *ProcessManager) Subscribe() (<-chan ProcessEvent, func()) {
+  events := make(chan ProcessEvent, EVENT_BUFFER_SIZE)
+
+  pm.subscribersMutex.Lock()
+  pm.subscribers[events] = true
+  pm.subscribersMutex.Unlock()
+
+  unsubscribe := func() {
+    pm.subscribersMutex.Lock()
+    defer pm.subscribersMutex.Unlock()
+    if pm.subscribers[events] {
+      delete(pm.subscribers, events)
+      close(events)
+    }
+  }
+  return events, unsubscribe
+}
+
+func (pm *ProcessManager) publish(event ProcessEvent) {
+  event.Time = time.Now()
+
+  pm.subscribersMutex.Lock()
+  defer pm.subscribersMutex.Unlock()
+  for subscriber := range pm.subscribers {
+    select {
+    case subscriber <- event:
+    default:
+    }
+  }
+}
+
+func (pm *ProcessManager) publishExited(id string, pid int, state *os.ProcessState, stopRequested bool) {
+  pm.publish(ProcessEvent{
+    Id:            id,
+    Type:          EVENT_EXITED,
+    Pid:           pid,
+    ExitCode:      state.ExitCode(),
+    ExitStatus:    state.String(),
+    StopRequested: stopRequested,
+  })
+}
@@ -0,0 +1,343 @@
+package processes
+
+import (
+  "compress/gzip"
+  "flag"
+  "fmt"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "io"
+  "io/ioutil"
+  "os"
+  "os/exec"
+  "os/signal"
+  "path/filepath"
+  "sort"
+  "strconv"
+  "strings"
+  "sync"
+  "syscall"
+  "time"
+)
+
+const (
+  LOG_BACKUP_TIME_FORMAT = "2006-01-02T15-04-05.000"
+  LOG_COMPRESSED_EXT     = ".gz"
+  MEGABYTE               = 1024 * 1024
+
+  // mcli is run with this as its first argument to rotate the log of a process started in the background, see RunLogWriter
+  LOG_WRITER_ARG = "--write-rotated-log"
+)
+
+/*
+  Writer for the output of a process that rotates the log file once it grows past its size or age limit
+  The same writer is used across restarts of the process, the log file is opened on the first write
+*/
+type rotatingLogWriter struct {
+  path         string
+  cfg          configs.LogRotationConfig
+  mutex        sync.Mutex
+  file         *os.File
+  size         int64
+  segmentStart time.Time
+  // serializes compressing and pruning of rotated logs, which runs in the background
+  maintenanceMutex sync.Mutex
+}
+
+func newRotatingLogWriter(path string, cfg configs.LogRotationConfig) *rotatingLogWriter {
+  return &rotatingLogWriter{path: path, cfg: cfg}
+}
+
+/*
+  Write never fails, if the log can't be written the output is dropped, since returning an error
+  would close the pipe and get the process killed by SIGPIPE
+*/
+func (w *rotatingLogWriter) Write(p []byte) (int, error) {
+  w.mutex.Lock()
+  defer w.mutex.Unlock()
+
+  if w.file == nil {
+    if err := w.open(); err != nil {
+      fmt.Println("ProcessManager failed to open log", w.path, err)
+      return len(p), nil
+    }
+  }
+  if w.shouldRotate(int64(len(p))) {
+    if err := w.rotate(); err != nil {
+      fmt.Println("ProcessManager failed to rotate log", w.path, err)
+    }
+  }
+
+  n, err := w.file.Write(p)
+  w.size += int64(n)
+  if err != nil {
+    fmt.Println("ProcessManager failed to write log", w.path, err)
+  }
+  return len(p), nil
+}
+
+func (w *rotatingLogWriter) Close() error {
+  w.mutex.Lock()
+  defer w.mutex.Unlock()
+
+  if w.file == nil {
+    return nil
+  }
+  err := w.file.Close()
+  w.file = nil
+  return err
+}
+
+/*
+  Opens the existing log, rotating it first if it is already over its limits
+*/
+func (w *rotatingLogWriter) open() error {
+  info, err := os.Stat(w.path)
+  if os.IsNotExist(err) {
+    return w.openNew()
+  } else if err != nil {
+    return err
+  }
+
+  w.size = info.Size()
+  w.segmentStart = w.getSegmentStart()
+  if w.shouldRotate(0) {
+    return w.rotate()
+  }
+
+  file, err := os.OpenFile(w.path, os.O_APPEND|os.O_WRONLY, 0600)
+  if err != nil {
+    return err
+  }
+  w.file = file
+  return nil
+}
+
+func (w *rotatingLogWriter) openNew() error {
+  file, err := os.OpenFile(w.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+  if err != nil {
+    return err
+  }
+  w.file = file
+  w.size = 0
+  w.segmentStart = time.Now()
+  return nil
+}
+
+/*
+  The current log was started by the most recent rotation, if there was none its age is counted from now
+*/
+func (w *rotatingLogWriter) getSegmentStart() time.Time {
+  backups, err := listLogBackups(w.path)
+  if err != nil || len(backups) == 0 {
+    return time.Now()
+  }
+  return backups[0].rotatedAt
+}
+
+func (w *rotatingLogWriter) shouldRotate(writeSize int64) bool {
+  if w.size == 0 {
+    return false
+  }
+  if w.cfg.MaxSize > 0 && w.size+writeSize > int64(w.cfg.MaxSize)*MEGABYTE {
+    return true
+  }
+  if w.cfg.MaxAge > 0 && time.Since(w.segmentStart) >= time.Duration(w.cfg.MaxAge)*time.Hour {
+    return true
+  }
+  return false
+}
+
+/*
+  Moves the current log aside and starts a new one, compression and pruning of old logs happen in the background
+*/
+func (w *rotatingLogWriter) rotate() error {
+  if w.file != nil {
+    w.file.Close()
+    w.file = nil
+  }
+
+  backupPath := w.path + "." + time.Now().Format(LOG_BACKUP_TIME_FORMAT)
+  if err := os.Rename(w.path, backupPath); err != nil && !os.IsNotExist(err) {
+    // keep appending to the current log rather than losing output
+    file, openErr := os.OpenFile(w.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+    if openErr == nil {
+      w.file = file
+    }
+    return err
+  }
+  if err := w.openNew(); err != nil {
+    return err
+  }
+
+  go w.compressAndPrune()
+  return nil
+}
+
+func (w *rotatingLogWriter) compressAndPrune() {
+  w.maintenanceMutex.Lock()
+  defer w.maintenanceMutex.Unlock()
+
+  backups, err := listLogBackups(w.path)
+  if err != nil {
+    fmt.Println("ProcessManager failed to list rotated logs of", w.path, err)
+    return
+  }
+
+  if w.cfg.MaxBackups > 0 && len(backups) > w.cfg.MaxBackups {
+    for _, backup := range backups[w.cfg.MaxBackups:] {
+      if err := os.Remove(backup.path); err != nil {
+        fmt.Println("ProcessManager failed to remove rotated log", backup.path, err)
+      }
+    }
+    backups = backups[:w.cfg.MaxBackups]
+  }
+
+  if w.cfg.Compress {
+    for _, backup := range backups {
+      if !backup.compressed {
+        if err := compressLogBackup(backup.path); err != nil {
+          fmt.Println("ProcessManager failed to compress rotated log", backup.path, err)
+        }
+      }
+    }
+  }
+}
+
+/*
+  Rotates the log if it is over its limits, used for processes whose output is written to the log directly
+*/
+func rotateLogIfNeeded(path string, cfg configs.LogRotationConfig) {
+  writer := newRotatingLogWriter(path, cfg)
+  if err := writer.open(); err != nil {
+    fmt.Println("ProcessManager failed to rotate log", path, err)
+    return
+  }
+  writer.Close()
+  // compress synchronously, the writer is not kept around
+  writer.compressAndPrune()
+}
+
+/*
+  Starts a log writer process that rotates the log while a process started in the background writes to it, the
+  returned pipe is the output of the process. The log writer is in its own session so that it outlives mcli, and
+  exits once the process and its children closed the pipe
+*/
+func startLogWriterProcess(path string, cfg configs.LogRotationConfig) (*os.File, error) {
+  reader, writer, err := os.Pipe()
+  if err != nil {
+    return nil, err
+  }
+  defer reader.Close()
+
+  cmd := exec.Command(SELF_EXE_PATH, LOG_WRITER_ARG, "-path", path,
+    "-max-size", strconv.Itoa(cfg.MaxSize), "-max-age", strconv.Itoa(cfg.MaxAge),
+    "-max-backups", strconv.Itoa(cfg.MaxBackups), "-compress="+strconv.FormatBool(cfg.Compress))
+  cmd.Stdin = reader
+  cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+  if err := cmd.Start(); err != nil {
+    writer.Close()
+    return nil, err
+  }
+  // reaped if it exits while mcli is still running
+  go cmd.Wait()
+  return writer, nil
+}
+
+/*
+  Runs in the log writer process started by startLogWriterProcess, with the arguments following LOG_WRITER_ARG:
+  writes its stdin to the rotated log until the process closes it
+*/
+func RunLogWriter(args []string) {
+  var cfg configs.LogRotationConfig
+  flags := flag.NewFlagSet(LOG_WRITER_ARG, flag.ExitOnError)
+  path := flags.String("path", "", "log file to write")
+  flags.IntVar(&cfg.MaxSize, "max-size", 0, "megabytes the log can grow to before it is rotated")
+  flags.IntVar(&cfg.MaxAge, "max-age", 0, "hours after which the log is rotated")
+  flags.IntVar(&cfg.MaxBackups, "max-backups", 0, "number of rotated logs to keep, 0 keeps all of them")
+  flags.BoolVar(&cfg.Compress, "compress", false, "gzip rotated logs")
+  flags.Parse(args)
+
+  // the process keeps writing to the pipe after the terminal mcli was started from is gone
+  signal.Ignore(syscall.SIGHUP, syscall.SIGINT)
+
+  writer := newRotatingLogWriter(*path, cfg)
+  io.Copy(writer, os.Stdin)
+  writer.Close()
+  // waits for a compression started by the last rotation
+  writer.compressAndPrune()
+  os.Exit(0)
+}
+
+type logBackup struct {
+  path       string
+  rotatedAt  time.Time
+  compressed bool
+}
+
+/*
+  Lists the rotated logs of a log file, most recent first
+*/
+func listLogBackups(path string) ([]logBackup, error) {
+  files, err := ioutil.ReadDir(filepath.Dir(path))
+  if err != nil {
+    return nil, err
+  }
+
+  prefix := filepath.Base(path) + "."
+  var backups []logBackup
+  for _, file := range files {
+    name := file.Name()
+    if file.IsDir() || !strings.HasPrefix(name, prefix) {
+      continue
+    }
+    timestamp := strings.TrimPrefix(name, prefix)
+    compressed := strings.HasSuffix(timestamp, LOG_COMPRESSED_EXT)
+    timestamp = strings.TrimSuffix(timestamp, LOG_COMPRESSED_EXT)
+    rotatedAt, err := time.ParseInLocation(LOG_BACKUP_TIME_FORMAT, timestamp, time.Local)
+    if err != nil {
+      continue
+    }
+    backups = append(backups, logBackup{filepath.Join(filepath.Dir(path), name), rotatedAt, compressed})
+  }
+
+  sort.Slice(backups, func(i, j int) bool {
+    return backups[i].rotatedAt.After(backups[j].rotatedAt)
+  })
+  return backups, nil
+}
+
+/*
+  Gzips a rotated log, the uncompressed log is only removed once the compressed one is complete
+*/
+func compressLogBackup(path string) error {
+  src, err := os.Open(path)
+  if err != nil {
+    return err
+  }
+  defer src.Close()
+
+  tmpPath := path + LOG_COMPRESSED_EXT + ".tmp"
+  dst, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+  if err != nil {
+    return err
+  }
+
+  gzipWriter := gzip.NewWriter(dst)
+  _, err = io.Copy(gzipWriter, src)
+  if err == nil {
+    err = gzipWriter.Close()
+  }
+  if closeErr := dst.Close(); err == nil {
+    err = closeErr
+  }
+  if err != nil {
+    os.Remove(tmpPath)
+    return err
+  }
+
+  if err := os.Rename(tmpPath, path+LOG_COMPRESSED_EXT); err != nil {
+    os.Remove(tmpPath)
+    return err
+  }
+  return os.Remove(path)
+}
@@ -0,0 +1,43 @@
+package processes
+
+import (
+  "bytes"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "io/ioutil"
+  "path/filepath"
+  "testing"
+  "time"
+)
+
+func TestLogWriterProcessRotatesTheLog(t *testing.T) {
+  logPath := filepath.Join(t.TempDir(), "test.log")
+  pipe, err := startLogWriterProcess(logPath, configs.LogRotationConfig{MaxSize: 1, MaxBackups: 1, Compress: true})
+  if err != nil {
+    t.Fatal(err)
+  }
+  line := append(bytes.Repeat([]byte("x"), 1023), '\n')
+  for i := 0; i < 1536; i++ {
+    if _, err := pipe.Write(line); err != nil {
+      t.Fatal(err)
+    }
+  }
+  pipe.Write([]byte("last line\n"))
+  // the log writer exits once the process closed its output
+  pipe.Close()
+
+  deadline := time.Now().Add(5 * time.Second)
+  for {
+    backups, _ := listLogBackups(logPath)
+    content, _ := ioutil.ReadFile(logPath)
+    if len(backups) == 1 && backups[0].compressed && bytes.HasSuffix(content, []byte("last line\n")) {
+      if len(content) > MEGABYTE {
+        t.Fatalf("the log grew to %d bytes past its MaxSize", len(content))
+      }
+      return
+    }
+    if time.Now().After(deadline) {
+      t.Fatalf("expected the log to be rotated into a compressed backup, got %v and a log of %d bytes", backups, len(content))
+    }
+    time.Sleep(10 * time.Millisecond)
+  }
+}
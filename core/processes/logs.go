@@ -0,0 +1,285 @@
+package processes
+
+import (
+  "bufio"
+  "compress/gzip"
+  "fmt"
+  "io"
+  "os"
+  "path/filepath"
+  "regexp"
+  "time"
+)
+
+const (
+  LOG_FOLLOW_INTERVAL = 500 * time.Millisecond
+)
+
+/*
+  Filters applied when reading the log of a process
+*/
+type LogOptions struct {
+  Lines   int            // number of most recent lines to show, 0 shows all of them
+  Pattern *regexp.Regexp // only show lines matching the pattern, if set
+  Since   time.Time      // only show lines logged after this time, if set
+}
+
+// timestamp formats found at the start of lines logged by the managed processes
+var logLineTimeFormats = []struct {
+  pattern *regexp.Regexp
+  layout  string
+  noYear  bool
+}{
+  {regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2})`), "2006-01-02T15:04:05", false},
+  {regexp.MustCompile(`^(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2})`), "2006-01-02 15:04:05", false},
+  {regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2})`), "2006/01/02 15:04:05", false},
+  // go-ethereum, ie. "INFO [03-01|12:00:00.000] ..."
+  {regexp.MustCompile(`^[A-Z]+\s*\[(\d{2}-\d{2}\|\d{2}:\d{2}:\d{2})`), "01-02|15:04:05", true},
+}
+
+/*
+  A log file of a process, current or rotated
+*/
+type logSegment struct {
+  path       string
+  compressed bool
+  start      time.Time // lower bound for the time of lines in the segment that have no timestamp
+  end        time.Time // time the segment was rotated, zero for the current log
+}
+
+/*
+  Writes the lines of the process log matching the options to out, including lines in rotated logs
+*/
+func (pm *ProcessManager) ShowLogs(id string, options LogOptions, out io.Writer) error {
+  segments, err := pm.getLogSegments(id)
+  if err != nil {
+    return err
+  }
+
+  // read the most recent segments first, older ones are only needed if there are not enough lines yet
+  var lines []string
+  for i := len(segments) - 1; i >= 0; i-- {
+    if !options.Since.IsZero() && !segments[i].end.IsZero() && segments[i].end.Before(options.Since) {
+      break
+    }
+    segmentLines, err := readLogSegment(segments[i], options)
+    if err != nil {
+      return err
+    }
+    lines = append(segmentLines, lines...)
+    if options.Lines > 0 && len(lines) >= options.Lines {
+      lines = lines[len(lines)-options.Lines:]
+      break
+    }
+  }
+
+  for _, line := range lines {
+    fmt.Fprintln(out, line)
+  }
+  return nil
+}
+
+/*
+  Writes lines matching the options to out as they are logged, until stop is closed
+  When the log is rotated the rest of the old log is read before following the new one
+*/
+func (pm *ProcessManager) FollowLogs(id string, options LogOptions, out io.Writer, stop <-chan struct{}) error {
+  config, exists := pm.getProcessConfig(id)
+  if !exists {
+    return fmt.Errorf("unknown process %s", id)
+  }
+  path := filepath.Join(pm.baseDir, LOG_DIR, config.LogFilename)
+
+  var file *os.File
+  var reader *bufio.Reader
+  defer func() {
+    if file != nil {
+      file.Close()
+    }
+  }()
+  // only lines logged from now on are shown, lines already logged were shown by ShowLogs
+  startAtEnd := true
+  lastTime := time.Now()
+  var partial []byte
+
+  ticker := time.NewTicker(LOG_FOLLOW_INTERVAL)
+  defer ticker.Stop()
+  for {
+    if file == nil {
+      var err error
+      // the log doesn't exist until the process writes to it
+      if file, err = os.Open(path); err == nil {
+        if startAtEnd {
+          file.Seek(0, io.SeekEnd)
+        }
+        reader = bufio.NewReader(file)
+      }
+      startAtEnd = false
+    }
+
+    if file != nil {
+      for {
+        chunk, err := reader.ReadBytes('\n')
+        if err != nil {
+          // keep an unfinished line until the rest of it is logged
+          partial = append(partial, chunk...)
+          break
+        }
+        line := string(append(partial, chunk[:len(chunk)-1]...))
+        partial = nil
+        if t, ok := parseLogLineTime(line); ok {
+          lastTime = t
+        }
+        if matchesLogOptions(line, lastTime, options) {
+          fmt.Fprintln(out, line)
+        }
+      }
+
+      // the old log was read to the end, switch to the new one
+      if isLogReplaced(file, path) {
+        file.Close()
+        file = nil
+        partial = nil
+        continue
+      }
+    }
+
+    select {
+    case <-stop:
+      return nil
+    case <-ticker.C:
+    }
+  }
+}
+
+/*
+  Returns whether the log at path is no longer the open file, because it was rotated or truncated
+*/
+func isLogReplaced(file *os.File, path string) bool {
+  openInfo, err := file.Stat()
+  if err != nil {
+    return true
+  }
+  pathInfo, err := os.Stat(path)
+  if err != nil {
+    return false
+  }
+  if !os.SameFile(openInfo, pathInfo) {
+    return true
+  }
+  offset, err := file.Seek(0, io.SeekCurrent)
+  return err == nil && pathInfo.Size() < offset
+}
+
+/*
+  Returns the rotated logs of a process, oldest first, followed by its current log
+*/
+func (pm *ProcessManager) getLogSegments(id string) ([]logSegment, error) {
+  config, exists := pm.getProcessConfig(id)
+  if !exists {
+    return nil, fmt.Errorf("unknown process %s", id)
+  }
+  path := filepath.Join(pm.baseDir, LOG_DIR, config.LogFilename)
+
+  backups, err := listLogBackups(path)
+  if err != nil && !os.IsNotExist(err) {
+    return nil, err
+  }
+
+  var segments []logSegment
+  var start time.Time
+  for i := len(backups) - 1; i >= 0; i-- {
+    segments = append(segments, logSegment{backups[i].path, backups[i].compressed, start, backups[i].rotatedAt})
+    // the next segment was started by this rotation
+    start = backups[i].rotatedAt
+  }
+  if _, err := os.Stat(path); err == nil {
+    segments = append(segments, logSegment{path, false, start, time.Time{}})
+  } else if len(segments) == 0 {
+    return nil, fmt.Errorf("no logs found for %s at %s", id, path)
+  }
+  return segments, nil
+}
+
+/*
+  Reads the lines of a segment matching the options, keeping only as many of the most recent lines as requested
+*/
+func readLogSegment(segment logSegment, options LogOptions) ([]string, error) {
+  file, err := os.Open(segment.path)
+  if err != nil {
+    return nil, err
+  }
+  defer file.Close()
+
+  var reader io.Reader = file
+  if segment.compressed {
+    gzipReader, err := gzip.NewReader(file)
+    if err != nil {
+      return nil, fmt.Errorf("failed to read %s: %v", segment.path, err)
+    }
+    defer gzipReader.Close()
+    reader = gzipReader
+  }
+
+  var lines []string
+  lastTime := segment.start
+  scanner := bufio.NewScanner(reader)
+  scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+  for scanner.Scan() {
+    line := scanner.Text()
+    if t, ok := parseLogLineTime(line); ok {
+      lastTime = t
+    }
+    if !matchesLogOptions(line, lastTime, options) {
+      continue
+    }
+    lines = append(lines, line)
+    if options.Lines > 0 && len(lines) > 2*options.Lines {
+      lines = append([]string(nil), lines[len(lines)-options.Lines:]...)
+    }
+  }
+  if err := scanner.Err(); err != nil {
+    return nil, fmt.Errorf("failed to read %s: %v", segment.path, err)
+  }
+
+  if options.Lines > 0 && len(lines) > options.Lines {
+    lines = lines[len(lines)-options.Lines:]
+  }
+  return lines, nil
+}
+
+/*
+  Lines without a timestamp of their own, such as stack traces, are considered logged at the time of the previous timestamp
+*/
+func matchesLogOptions(line string, lineTime time.Time, options LogOptions) bool {
+  if !options.Since.IsZero() && lineTime.Before(options.Since) {
+    return false
+  }
+  if options.Pattern != nil && !options.Pattern.MatchString(line) {
+    return false
+  }
+  return true
+}
+
+func parseLogLineTime(line string) (time.Time, bool) {
+  for _, format := range logLineTimeFormats {
+    match := format.pattern.FindStringSubmatch(line)
+    if match == nil {
+      continue
+    }
+    t, err := time.ParseInLocation(format.layout, match[1], time.Local)
+    if err != nil {
+      continue
+    }
+    if format.noYear {
+      now := time.Now()
+      t = t.AddDate(now.Year(), 0, 0)
+      // a line from the end of last year read at the start of this year
+      if t.After(now.Add(24 * time.Hour)) {
+        t = t.AddDate(-1, 0, 0)
+      }
+    }
+    return t, true
+  }
+  return time.Time{}, false
+}
@@ -3,6 +3,7 @@ package processes
 import (
   "fmt"
   "github.com/MarconiProtocol/cli/core/configs"
+  "io"
   "io/ioutil"
   "os"
   "os/exec"
@@ -25,9 +26,24 @@ const (
   Simple configurable manager that starts and stops processes
 */
 type ProcessManager struct {
-  processMap      map[string]*os.Process
-  processesConfig configs.ProcessesConfig
-  baseDir         string
+  processMap       map[string]*os.Process
+  processStatuses  map[string]*ProcessStatus
+  externalWatches  map[string]int // pids of running processes that were not started by this instance
+  mutex            sync.Mutex
+  subscribers      map[chan ProcessEvent]bool
+  subscribersMutex sync.Mutex
+  processesConfig  configs.ProcessesConfig
+  baseDir          string
+}
+
+/*
+  Status of a managed process, crash and restart counts are only tracked for processes started by this instance
+*/
+type ProcessStatus struct {
+  Running        bool
+  Crashes        int
+  Restarts       int
+  LastExitStatus string
 }
 
 var instance *ProcessManager
@@ -37,6 +53,9 @@ func Instance() *ProcessManager {
   once.Do(func() {
     instance = &ProcessManager{}
     instance.processMap = make(map[string]*os.Process)
+    instance.processStatuses = make(map[string]*ProcessStatus)
+    instance.externalWatches = make(map[string]int)
+    instance.subscribers = make(map[chan ProcessEvent]bool)
   })
   return instance
 }
@@ -52,20 +71,26 @@ func (pm *ProcessManager) GetSortedProcessConfigs() []configs.ProcessConfig {
 }
 
 func (pm *ProcessManager) ContainsId(id string) bool {
+  _, exists := pm.getProcessConfig(id)
+  return exists
+}
+
+func (pm *ProcessManager) getProcessConfig(id string) (configs.ProcessConfig, bool) {
   for _, config := range pm.processesConfig.Processes {
     if config.Id == id {
-      return true
+      return config, true
     }
   }
-  return false
+  return configs.ProcessConfig{}, false
 }
 
 /*
   Start processes as defined by procConfigs
-  New goroutines are spawned to start the processes
-  TODO: we need to have way to signal between process_manager and process to orchestrate next process, ghetto sleep for now
+  Processes are started by dependency level, every process of a level is started in its own goroutine at the same time,
+  the next level is only started once every process of the current level is ready (its readiness check passed,
+  or its WaitTime has passed if it has no readiness check). Processes depending on a process that failed are not started
 */
-func (pm *ProcessManager) StartProcesses(processNames []string, background bool) {
+func (pm *ProcessManager) StartProcesses(processNames []string, background bool) error {
   var procConfigs []configs.ProcessConfig
   for _, config := range pm.processesConfig.Processes {
     for _, name := range processNames {
@@ -76,28 +101,274 @@ func (pm *ProcessManager) StartProcesses(processNames []string, background bool)
     }
   }
 
-  // Build dependency graph and calculate ordered execution
-  sortedProcConfigs := buildDependencyGraph(procConfigs).getOrderedProcessConfigs()
+  // Build dependency graph and group the processes by dependency level
+  levels := buildDependencyGraph(procConfigs).getProcessConfigLevels()
+
+  var results []startResult
+  var errs []error
+  var skipped []string
+  // ids of processes that failed or were skipped, their dependents can't be started
+  notStarted := make(map[string]bool)
+
+  for _, level := range levels {
+    var startable []configs.ProcessConfig
+    for _, config := range level {
+      if dependsOnAny(config, notStarted) {
+        skipped = append(skipped, config.Id)
+        notStarted[config.Id] = true
+      } else {
+        startable = append(startable, config)
+      }
+    }
+
+    levelResults := make([]startResult, len(startable))
+    var wg sync.WaitGroup
+    for i, config := range startable {
+      wg.Add(1)
+      go func(i int, config configs.ProcessConfig) {
+        defer wg.Done()
+        levelResults[i] = pm.startProcessAndWaitForReadiness(config, procConfigs, background)
+      }(i, config)
+    }
+    wg.Wait()
+
+    for _, result := range levelResults {
+      if result.err != nil {
+        errs = append(errs, result.err)
+        notStarted[result.id] = true
+      }
+    }
+    results = append(results, levelResults...)
+  }
+
+  printStartSummary(results, skipped)
+  if len(errs) > 0 {
+    return &StartError{errs, skipped}
+  }
+  return nil
+}
+
+func dependsOnAny(config configs.ProcessConfig, ids map[string]bool) bool {
+  for _, dependencyId := range config.Dependencies {
+    if ids[dependencyId] {
+      return true
+    }
+  }
+  return false
+}
+
+/*
+  Returned when processes failed to start or to become ready, Skipped lists the processes that were not started because of it
+*/
+type StartError struct {
+  Errors  []error
+  Skipped []string
+}
+
+func (e *StartError) Error() string {
+  var msgs []string
+  for _, err := range e.Errors {
+    msgs = append(msgs, err.Error())
+  }
+  msg := strings.Join(msgs, "; ")
+  if len(e.Skipped) > 0 {
+    msg += fmt.Sprintf(", not starting %v", e.Skipped)
+  }
+  return msg
+}
+
+type startResult struct {
+  id      string
+  latency time.Duration
+  err     error
+}
+
+/*
+  Start a process and block until it is ready, returns how long that took
+*/
+func (pm *ProcessManager) startProcessAndWaitForReadiness(config configs.ProcessConfig, startingConfigs []configs.ProcessConfig, background bool) (result startResult) {
+  result.id = config.Id
+  startTime := time.Now()
+  defer func() {
+    result.latency = time.Since(startTime)
+  }()
+
+  if result.err = pm.waitForExternalDependencies(config, startingConfigs); result.err != nil {
+    return result
+  }
+
+  // Either run process command in a coroutine or in the same thread
+  if config.WaitForCompletion {
+    pm.startProcess(config, background, nil)
+    return result
+  }
+
+  // the probe has to be created before the process starts logging
+  probe, err := newReadinessProbe(pm.baseDir, config)
+  if err != nil {
+    result.err = err
+    return result
+  }
+
+  started := make(chan error, 1)
+  go pm.startProcess(config, background, started)
+  if result.err = <-started; result.err != nil {
+    return result
+  }
 
-  for _, config := range sortedProcConfigs {
-    // Either run process command in a coroutine or in the same thread
-    if config.WaitForCompletion {
-      pm.startProcess(config, background)
+  if probe != nil {
+    result.err = probe.wait()
+  } else if config.WaitTime > 0 {
+    time.Sleep(time.Duration(config.WaitTime) * time.Second)
+  }
+  if result.err == nil {
+    pm.publishReady(config.Id)
+  }
+  return result
+}
+
+/*
+  Print how long each process took to start and become ready
+*/
+func printStartSummary(results []startResult, skipped []string) {
+  if len(results) == 0 {
+    return
+  }
+  fmt.Println("Process start summary:")
+  for _, result := range results {
+    if result.err != nil {
+      fmt.Printf("  %-15s failed after %v\n", result.id, result.latency.Round(time.Millisecond))
     } else {
-      go pm.startProcess(config, background)
-      // This is retarded, but temporary
-      if config.WaitTime > 0 {
-        time.Sleep(time.Duration(config.WaitTime) * time.Second)
+      fmt.Printf("  %-15s ready after %v\n", result.id, result.latency.Round(time.Millisecond))
+    }
+  }
+  for _, id := range skipped {
+    fmt.Printf("  %-15s not started\n", id)
+  }
+}
+
+/*
+  Wait for the dependencies of a process that are not being started together with it to be ready
+  Dependencies whose readiness is decided from their log can't be checked once they are running, so they are skipped
+*/
+func (pm *ProcessManager) waitForExternalDependencies(config configs.ProcessConfig, startingConfigs []configs.ProcessConfig) error {
+  for _, dependencyId := range config.Dependencies {
+    if containsProcessConfig(startingConfigs, dependencyId) {
+      continue
+    }
+    for _, dependencyConfig := range pm.processesConfig.Processes {
+      if dependencyConfig.Id != dependencyId || dependencyConfig.Readiness == nil || dependencyConfig.Readiness.Type == READINESS_LOG {
+        continue
+      }
+      probe, err := newReadinessProbe(pm.baseDir, dependencyConfig)
+      if err != nil {
+        return err
+      }
+      if err := probe.wait(); err != nil {
+        if readinessErr, ok := err.(*ReadinessError); ok {
+          readinessErr.Dependent = config.Id
+        }
+        return err
       }
     }
   }
+  return nil
+}
+
+func containsProcessConfig(procConfigs []configs.ProcessConfig, id string) bool {
+  for _, config := range procConfigs {
+    if config.Id == id {
+      return true
+    }
+  }
+  return false
 }
 
 /*
-  Start a single process, reference to os.Process object stored in process_manager's processMap
-  Pipes process output to a log
+  Start a single process and keep restarting it according to its restart policy
+  If started is not nil, the result of the first start attempt is sent to it
 */
-func (pm *ProcessManager) startProcess(cfg configs.ProcessConfig, background bool) {
+func (pm *ProcessManager) startProcess(cfg configs.ProcessConfig, background bool, started chan<- error) {
+  policy := newRestartPolicy(cfg)
+
+  // the output of processes started in the background is rotated by a log writer process instead,
+  // as it has to keep going once mcli exits, see runProcess
+  var logWriter *rotatingLogWriter
+  if cfg.LogRotation != nil && !background {
+    logWriter = newRotatingLogWriter(filepath.Join(pm.baseDir, LOG_DIR, cfg.LogFilename), *cfg.LogRotation)
+    defer logWriter.Close()
+  }
+
+  for {
+    startTime := time.Now()
+    state, ran := pm.runProcess(cfg, background, logWriter, started)
+    // only the first start is reported, the caller waits for it to be ready
+    started = nil
+    if !ran {
+      return
+    }
+    // the stop request names the pid, a restart right after a stop can't take the request of the stopped run
+    stopRequested := pm.consumeStopRequest(cfg, state.Pid())
+    pm.recordExit(cfg.Id, state, stopRequested)
+    pm.publishExited(cfg.Id, state.Pid(), state, stopRequested)
+
+    if stopRequested || !policy.shouldRestart(state) {
+      return
+    }
+
+    delay, ok := policy.nextDelay(time.Since(startTime))
+    if !ok {
+      fmt.Printf("ProcessManager will not restart %s, it was restarted %d times in a row\n", cfg.Id, cfg.MaxRestarts)
+      return
+    }
+    fmt.Printf("Process %s exited (%s), restarting in %v\n", cfg.Id, state, delay)
+    pm.markRestartPending(cfg, state.Pid())
+    time.Sleep(delay)
+    pm.clearRestartPending(cfg)
+
+    // the process may have been stopped while we were waiting to restart it
+    if pm.consumeStopRequest(cfg, state.Pid()) {
+      return
+    }
+    restarts := pm.incrementRestarts(cfg.Id)
+    pm.publish(ProcessEvent{Id: cfg.Id, Type: EVENT_RESTARTED, Restarts: restarts})
+    started = pm.watchRestartReadiness(cfg)
+  }
+}
+
+/*
+  Returns a channel to pass to runProcess, once the process is started its readiness is checked and published
+*/
+func (pm *ProcessManager) watchRestartReadiness(cfg configs.ProcessConfig) chan<- error {
+  // the probe has to be created before the process starts logging
+  probe, err := newReadinessProbe(pm.baseDir, cfg)
+  if err != nil {
+    return nil
+  }
+
+  started := make(chan error, 1)
+  go func() {
+    if err := <-started; err != nil {
+      return
+    }
+    if probe != nil {
+      if err := probe.wait(); err != nil {
+        fmt.Println("Restarted process", cfg.Id, "is not ready:", err)
+        return
+      }
+    }
+    pm.publishReady(cfg.Id)
+  }()
+  return started
+}
+
+/*
+  Run a single process once, reference to os.Process object stored in process_manager's processMap
+  Pipes process output to logWriter, or directly to the log file if it is nil
+  The outcome of starting the process is sent to started if it is not nil, a process that is already running is not an error
+  Returns the state of the exited process, and false if the process was not started at all
+*/
+func (pm *ProcessManager) runProcess(cfg configs.ProcessConfig, background bool, logWriter *rotatingLogWriter, started chan<- error) (*os.ProcessState, bool) {
   fmt.Println("STARTING PROCESS: ", cfg.Id)
 
   // Create directories if they don't already exist
@@ -118,35 +389,73 @@ func (pm *ProcessManager) startProcess(cfg configs.ProcessConfig, background boo
       fmt.Println(err)
     }
     fmt.Printf("ProcessManager did not startProcess as an instance with pid=%d is already running.\n", pid)
-    return
-  }
-
-  // Open the logfile
-  logFile, err := os.OpenFile(filepath.Join(pm.baseDir, LOG_DIR, cfg.LogFilename), os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-  if err != nil {
-    fmt.Println(err)
+    if err == nil {
+      pm.watchExternalProcess(cfg, pid)
+    }
+    notifyStarted(started, nil)
+    return nil, false
   }
-  defer logFile.Close()
 
   // Create the command
   fmt.Println(fmt.Sprintf("Going to excute %v, %v", cfg.Command, cfg.Arguments))
-  cmd := exec.Command(cfg.Command, cfg.Arguments...)
-  cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+  var output io.Writer
+  logPath := filepath.Join(pm.baseDir, LOG_DIR, cfg.LogFilename)
+  if logWriter != nil {
+    output = logWriter
+  } else if cfg.LogRotation != nil {
+    // started in the background, the log writer process owns the other end of the pipe once mcli exits
+    if pipe, err := startLogWriterProcess(logPath, *cfg.LogRotation); err != nil {
+      fmt.Printf("Warning: failed to start the log writer of %s, its log is only rotated when it is started: %v\n", cfg.Id, err)
+      rotateLogIfNeeded(logPath, *cfg.LogRotation)
+    } else {
+      defer pipe.Close()
+      output = pipe
+    }
+  }
+  if output == nil {
+    // Open the logfile
+    logFile, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+    if err != nil {
+      fmt.Println(err)
+    }
+    defer logFile.Close()
 
-  cmd.Stdout = logFile
-  cmd.Stderr = logFile
-  cmd.Dir = filepath.Join(pm.baseDir, cfg.Dir)
+    output = logFile
+  }
+  // with the configured environment and user, the command may be created again if starting it fails, see startInCgroup
+  newCommand := func() (*exec.Cmd, error) {
+    cmd := exec.Command(cfg.Command, cfg.Arguments...)
+    cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+    cmd.Stdout = output
+    cmd.Stderr = output
+    cmd.Dir = filepath.Join(pm.baseDir, cfg.Dir)
+    return cmd, pm.applyProcessEnvironment(cmd, cfg)
+  }
 
-  // Start command
-  if err := cmd.Start(); err != nil {
+  // the caps are optional, a process that can't be capped is still run
+  cgroupPath := ""
+  if cfg.Cgroup != nil {
+    if cgroupPath, err = setupCgroup(cfg); err != nil {
+      fmt.Printf("ProcessManager could not apply the cgroup caps of %s: %v\n", cfg.Id, err)
+    } else {
+      defer removeCgroup(cgroupPath)
+    }
+  }
+
+  // Start command with the configured umask and resource limits, inside its cgroup if it has one
+  cmd, err := startInCgroup(newCommand, cfg, cgroupPath)
+  if err != nil {
     fmt.Println("ProcessManager failed starting configured process:")
     fmt.Printf("  Tried to run command: %s with arguments: %s \n", cfg.Command, cfg.Arguments)
     fmt.Printf("  ERROR: %s\n\n", err)
-    return
+    notifyStarted(started, fmt.Errorf("failed to start %s: %v", cfg.Id, err))
+    return nil, false
   }
 
   if !background {
+    pm.mutex.Lock()
     pm.processMap[cfg.Id] = cmd.Process
+    pm.mutex.Unlock()
   }
   // write the process id to file
   content := []byte(strconv.Itoa(cmd.Process.Pid))
@@ -155,54 +464,67 @@ func (pm *ProcessManager) startProcess(cfg configs.ProcessConfig, background boo
   if err != nil {
     fmt.Print("ProcessManager failed writing pid to file", pidFilePath)
   }
+  notifyStarted(started, nil)
+  pm.publish(ProcessEvent{Id: cfg.Id, Type: EVENT_STARTED, Pid: cmd.Process.Pid})
 
-  // Blocks until command is done execution
+  // Blocks until command is done execution, reaping the process
   cmd.Wait()
-}
 
-/*
-  Stop all processes as defined in the process map by signalling SIGTERM
-*/
-func (pm *ProcessManager) StopProcesses() {
-  for id, process := range pm.processMap {
-    fmt.Println(fmt.Sprintf("Stopping process %v with pid: %v ...", id, process.Pid))
-    err := syscall.Kill(-process.Pid, syscall.SIGTERM)
-    if err != nil {
-      fmt.Println("Error:", err)
-      return
-    }
+  // the process is gone, so it no longer needs to be stopped and its pid file is stale
+  if !background {
+    pm.mutex.Lock()
+    delete(pm.processMap, cfg.Id)
+    pm.mutex.Unlock()
+  }
+  pm.removePidFile(cfg.PidFilename)
 
-    // clean up the pid files
-    for _, config := range pm.processesConfig.Processes {
-      if config.Id == id {
-        pm.removePidFile(config.PidFilename)
-      }
-    }
+  return cmd.ProcessState, true
+}
+
+func notifyStarted(started chan<- error, err error) {
+  if started != nil {
+    started <- err
   }
 }
 
 /*
-  Kill a process by name
+  Records the exit of a process, counting it as a crash if it did not exit cleanly
 */
-func (pm *ProcessManager) KillProcess(processName string) {
-  fmt.Println("Stopping process", processName)
+func (pm *ProcessManager) recordExit(id string, state *os.ProcessState, stopRequested bool) {
+  pm.mutex.Lock()
+  defer pm.mutex.Unlock()
+
+  status := pm.getOrCreateStatus(id)
+  status.LastExitStatus = state.String()
+  // a process killed after ignoring a stop request did not crash
+  if !stopRequested && !isCleanExit(state) {
+    status.Crashes++
+  }
+}
 
-  // clean up the pid file for this process
-  for _, config := range pm.processesConfig.Processes {
-    if config.Id == processName {
-      if pid, err := pm.getPidFromPidFile(config.PidFilename); err == nil {
+func (pm *ProcessManager) incrementRestarts(id string) int {
+  pm.mutex.Lock()
+  defer pm.mutex.Unlock()
 
-        // send SIGTERM to the process group
-        if err1 := syscall.Kill(-pid, syscall.SIGTERM); err1 != nil {
-          fmt.Println("Error:", err1)
-          return
-        }
+  status := pm.getOrCreateStatus(id)
+  status.Restarts++
+  return status.Restarts
+}
 
-        pm.removePidFile(config.PidFilename)
-      }
-      break
-    }
+func (pm *ProcessManager) publishReady(id string) {
+  config, _ := pm.getProcessConfig(id)
+  pid, _ := pm.getPidFromPidFile(config.PidFilename)
+  pm.publish(ProcessEvent{Id: id, Type: EVENT_READY, Pid: pid})
+}
+
+// must be called with mutex held
+func (pm *ProcessManager) getOrCreateStatus(id string) *ProcessStatus {
+  status, exists := pm.processStatuses[id]
+  if !exists {
+    status = &ProcessStatus{}
+    pm.processStatuses[id] = status
   }
+  return status
 }
 
 func (pm *ProcessManager) getPidFilePath(filename string) string {
@@ -237,56 +559,41 @@ func (pm *ProcessManager) getPidFromPidFile(filename string) (int, error) {
   return pid, nil
 }
 
-func (pm *ProcessManager) GetProcessRunningMap() map[string]bool {
-  statuses := make(map[string]bool, len(pm.processesConfig.Processes))
+/*
+  Returns the status of every configured process, keyed by process id
+*/
+func (pm *ProcessManager) GetProcessRunningMap() map[string]ProcessStatus {
+  statuses := make(map[string]ProcessStatus, len(pm.processesConfig.Processes))
+
+  pm.mutex.Lock()
+  defer pm.mutex.Unlock()
 
   for _, config := range pm.processesConfig.Processes {
-    statuses[config.Id] = pm.checkPidFileExists(config.PidFilename)
+    status := ProcessStatus{}
+    if tracked, exists := pm.processStatuses[config.Id]; exists {
+      status = *tracked
+    }
+    status.Running = pm.checkPidFileExists(config.PidFilename)
+    statuses[config.Id] = status
   }
 
   return statuses
 }
 
-func (pm *ProcessManager) monitorAllProcesses() {
-  for _, process := range pm.processesConfig.Processes {
-    go pm.monitorProcess(process.PidFilename)
-  }
-}
-
-func (pm *ProcessManager) monitorProcess(filename string) {
-  const SLEEP_DURATION = time.Duration(1) * time.Second
-  for {
-    if pm.checkPidFileExists(filename) { // pidfile exists
-
-      pid, err := pm.getPidFromPidFile(filename)
-      if err == nil { // successfully parsed PID
-
-        // note that sending the null signal is essentially a "dry-run"; no
-        // signals are actually sent see kill(2) for more details
-        killErr := syscall.Kill(pid, syscall.Signal(0))
-        if killErr == syscall.ESRCH { // process doesn't exist
-          pm.removePidFile(filename)
-        }
-      }
-    }
-
-    time.Sleep(SLEEP_DURATION)
-  }
-}
-
-// check if a marconi process exists by its name
-func (pm *ProcessManager) CheckProcessExistence(processName string) bool {
+/*
+  Returns the ids of the configured processes whose pid file names a process that is still alive
+*/
+func (pm *ProcessManager) GetLiveProcessIds() []string {
+  var ids []string
   for _, config := range pm.processesConfig.Processes {
-    if config.Id == processName {
-      if pid, err := pm.getPidFromPidFile(config.PidFilename); err == nil {
-        runCmd := exec.Command("ps", "-p", strconv.Itoa(pid))
-        output, _ := runCmd.Output()
-        if strings.Contains(string(output), strconv.Itoa(pid)) {
-          return true
-        }
-      }
-      return false
+    pid, err := pm.getPidFromPidFile(config.PidFilename)
+    if err != nil {
+      continue
+    }
+    // the null signal only checks if the process exists, see kill(2)
+    if err := syscall.Kill(pid, syscall.Signal(0)); err != syscall.ESRCH {
+      ids = append(ids, config.Id)
     }
   }
-  return false
+  return ids
 }
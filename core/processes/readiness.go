@@ -0,0 +1,249 @@
+package processes
+
+import (
+  "bufio"
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "io"
+  "net"
+  "net/http"
+  "os"
+  "path/filepath"
+  "regexp"
+  "time"
+)
+
+const (
+  READINESS_TCP     = "tcp"
+  READINESS_HTTP    = "http"
+  READINESS_JSONRPC = "jsonrpc"
+  READINESS_LOG     = "log"
+  READINESS_FILE    = "file"
+
+  DEFAULT_READINESS_TIMEOUT    = 60
+  DEFAULT_READINESS_INTERVAL   = 500
+  DEFAULT_READINESS_RPC_METHOD = "mcli_readinessCheck"
+  READINESS_REQUEST_TIMEOUT    = 2 * time.Second
+)
+
+/*
+  Returned when a process did not become ready within its readiness timeout
+*/
+type ReadinessError struct {
+  Id        string
+  Check     string
+  Timeout   time.Duration
+  Dependent string // set when the process was checked as a dependency of a process being started
+}
+
+func (e *ReadinessError) Error() string {
+  msg := fmt.Sprintf("%s did not become ready within %v (%s)", e.Id, e.Timeout, e.Check)
+  if e.Dependent != "" {
+    msg += fmt.Sprintf(", required by %s", e.Dependent)
+  }
+  return msg
+}
+
+/*
+  A readiness check for a single process, created before the process is started so that
+  log checks only look at lines written by this run of the process
+*/
+type readinessProbe struct {
+  id        string
+  cfg       configs.ReadinessConfig
+  baseDir   string
+  logPath   string
+  logOffset int64
+  pattern   *regexp.Regexp
+}
+
+func newReadinessProbe(baseDir string, cfg configs.ProcessConfig) (*readinessProbe, error) {
+  if cfg.Readiness == nil {
+    return nil, nil
+  }
+
+  probe := readinessProbe{
+    id:      cfg.Id,
+    cfg:     *cfg.Readiness,
+    baseDir: baseDir,
+    logPath: filepath.Join(baseDir, LOG_DIR, cfg.LogFilename),
+  }
+  if probe.cfg.Timeout <= 0 {
+    probe.cfg.Timeout = DEFAULT_READINESS_TIMEOUT
+  }
+  if probe.cfg.Interval <= 0 {
+    probe.cfg.Interval = DEFAULT_READINESS_INTERVAL
+  }
+  if probe.cfg.Method == "" {
+    probe.cfg.Method = DEFAULT_READINESS_RPC_METHOD
+  }
+
+  switch probe.cfg.Type {
+  case READINESS_TCP:
+    if probe.cfg.Address == "" {
+      return nil, fmt.Errorf("readiness check for %s is missing an Address", cfg.Id)
+    }
+  case READINESS_HTTP, READINESS_JSONRPC:
+    if probe.cfg.Url == "" {
+      return nil, fmt.Errorf("readiness check for %s is missing a Url", cfg.Id)
+    }
+  case READINESS_LOG:
+    pattern, err := regexp.Compile(probe.cfg.Pattern)
+    if err != nil {
+      return nil, fmt.Errorf("readiness check for %s has an invalid Pattern: %v", cfg.Id, err)
+    }
+    probe.pattern = pattern
+    // only lines logged after this point belong to the process we are about to start
+    if info, err := os.Stat(probe.logPath); err == nil {
+      probe.logOffset = info.Size()
+    }
+  case READINESS_FILE:
+    if probe.cfg.Path == "" {
+      return nil, fmt.Errorf("readiness check for %s is missing a Path", cfg.Id)
+    }
+  default:
+    return nil, fmt.Errorf("readiness check for %s has an unknown Type %q", cfg.Id, probe.cfg.Type)
+  }
+  return &probe, nil
+}
+
+/*
+  Blocks until the check succeeds, or returns a ReadinessError once the timeout is reached
+*/
+func (p *readinessProbe) wait() error {
+  timeout := time.Duration(p.cfg.Timeout) * time.Second
+  interval := time.Duration(p.cfg.Interval) * time.Millisecond
+  deadline := time.Now().Add(timeout)
+
+  fmt.Printf("Waiting for %s to become ready (%s)\n", p.id, p.describe())
+  for {
+    if p.check() {
+      fmt.Printf("%s is ready\n", p.id)
+      return nil
+    }
+    if time.Now().After(deadline) {
+      return &ReadinessError{Id: p.id, Check: p.describe(), Timeout: timeout}
+    }
+    time.Sleep(interval)
+  }
+}
+
+/*
+  Runs the check once, returns whether the process is ready
+*/
+func (p *readinessProbe) check() bool {
+  switch p.cfg.Type {
+  case READINESS_TCP:
+    return checkTcpReady(p.cfg.Address)
+  case READINESS_HTTP:
+    return checkHttpReady(p.cfg.Url)
+  case READINESS_JSONRPC:
+    return checkJsonRpcReady(p.cfg.Url, p.cfg.Method)
+  case READINESS_LOG:
+    return p.checkLogReady()
+  case READINESS_FILE:
+    return checkFileReady(p.getFullPath(p.cfg.Path))
+  }
+  return false
+}
+
+func (p *readinessProbe) describe() string {
+  switch p.cfg.Type {
+  case READINESS_TCP:
+    return fmt.Sprintf("tcp port %s open", p.cfg.Address)
+  case READINESS_HTTP:
+    return fmt.Sprintf("http request to %s succeeding", p.cfg.Url)
+  case READINESS_JSONRPC:
+    return fmt.Sprintf("json rpc call %s to %s answered", p.cfg.Method, p.cfg.Url)
+  case READINESS_LOG:
+    return fmt.Sprintf("log line matching %q", p.cfg.Pattern)
+  case READINESS_FILE:
+    return fmt.Sprintf("file %s existing", p.getFullPath(p.cfg.Path))
+  }
+  return p.cfg.Type
+}
+
+func (p *readinessProbe) getFullPath(path string) string {
+  if filepath.IsAbs(path) {
+    return path
+  }
+  return filepath.Join(p.baseDir, path)
+}
+
+/*
+  Scans the lines logged since the probe was created for the configured pattern
+*/
+func (p *readinessProbe) checkLogReady() bool {
+  file, err := os.Open(p.logPath)
+  if err != nil {
+    return false
+  }
+  defer file.Close()
+
+  // the log was rotated since the probe was created, the lines we are looking for are in the new log
+  if info, err := file.Stat(); err == nil && info.Size() < p.logOffset {
+    p.logOffset = 0
+  }
+  if _, err := file.Seek(p.logOffset, io.SeekStart); err != nil {
+    return false
+  }
+  reader := bufio.NewReader(file)
+  for {
+    line, err := reader.ReadBytes('\n')
+    // only consume complete lines, a partial line is checked again once it is finished
+    if err != nil {
+      return false
+    }
+    p.logOffset += int64(len(line))
+    if p.pattern.Match(line) {
+      return true
+    }
+  }
+}
+
+func checkTcpReady(address string) bool {
+  conn, err := net.DialTimeout("tcp", address, READINESS_REQUEST_TIMEOUT)
+  if err != nil {
+    return false
+  }
+  conn.Close()
+  return true
+}
+
+func checkHttpReady(url string) bool {
+  client := http.Client{Timeout: READINESS_REQUEST_TIMEOUT}
+  resp, err := client.Get(url)
+  if err != nil {
+    return false
+  }
+  defer resp.Body.Close()
+  return resp.StatusCode >= 200 && resp.StatusCode < 400
+}
+
+/*
+  Any well formed json rpc response means the server is answering, even an error such as method not found
+*/
+func checkJsonRpcReady(url string, method string) bool {
+  payload := []byte(fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":%q,"params":[]}`, method))
+  client := http.Client{Timeout: READINESS_REQUEST_TIMEOUT}
+  resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+  if err != nil {
+    return false
+  }
+  defer resp.Body.Close()
+
+  response := struct {
+    Version string `json:"jsonrpc"`
+  }{}
+  if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+    return false
+  }
+  return response.Version != ""
+}
+
+func checkFileReady(path string) bool {
+  _, err := os.Stat(path)
+  return err == nil
+}
@@ -0,0 +1,128 @@
+package processes
+
+import (
+  "fmt"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "os"
+  "syscall"
+  "time"
+)
+
+const (
+  RESTART_NEVER      = "never"
+  RESTART_ON_FAILURE = "on-failure"
+  RESTART_ALWAYS     = "always"
+
+  DEFAULT_RESTART_DELAY     = 1
+  DEFAULT_RESTART_DELAY_MAX = 60
+  DEFAULT_RESTART_WINDOW    = 60
+)
+
+/*
+  Keeps track of the consecutive restarts of a single process and computes the backoff between them
+*/
+type restartPolicy struct {
+  policy      string
+  maxRestarts int
+  delay       time.Duration
+  delayMax    time.Duration
+  window      time.Duration
+  consecutive int
+}
+
+func newRestartPolicy(cfg configs.ProcessConfig) *restartPolicy {
+  rp := restartPolicy{
+    policy:      cfg.RestartPolicy,
+    maxRestarts: cfg.MaxRestarts,
+    delay:       time.Duration(cfg.RestartDelay) * time.Second,
+    delayMax:    time.Duration(cfg.RestartDelayMax) * time.Second,
+    window:      time.Duration(cfg.RestartWindow) * time.Second,
+  }
+  if !isValidRestartPolicy(rp.policy) {
+    fmt.Printf("Unknown restart policy %q for process %s, the process will not be restarted\n", rp.policy, cfg.Id)
+    rp.policy = RESTART_NEVER
+  }
+  if rp.policy == "" {
+    rp.policy = RESTART_NEVER
+  }
+  if rp.delay <= 0 {
+    rp.delay = DEFAULT_RESTART_DELAY * time.Second
+  }
+  if rp.delayMax <= 0 {
+    rp.delayMax = DEFAULT_RESTART_DELAY_MAX * time.Second
+  }
+  if rp.delayMax < rp.delay {
+    rp.delayMax = rp.delay
+  }
+  if rp.window <= 0 {
+    rp.window = DEFAULT_RESTART_WINDOW * time.Second
+  }
+  return &rp
+}
+
+/*
+  Check if a restart policy string is one of the supported policies
+*/
+func isValidRestartPolicy(policy string) bool {
+  switch policy {
+  case "", RESTART_NEVER, RESTART_ON_FAILURE, RESTART_ALWAYS:
+    return true
+  }
+  return false
+}
+
+/*
+  Returns whether a process that exited with the given state should be restarted according to the policy
+*/
+func (rp *restartPolicy) shouldRestart(state *os.ProcessState) bool {
+  switch rp.policy {
+  case RESTART_ALWAYS:
+    return true
+  case RESTART_ON_FAILURE:
+    return !isCleanExit(state)
+  }
+  return false
+}
+
+/*
+  Returns how long to wait before the next restart, and false if the maximum number of restarts has been reached.
+  A process that stayed up for longer than the restart window is considered healthy and its backoff is reset.
+*/
+func (rp *restartPolicy) nextDelay(uptime time.Duration) (time.Duration, bool) {
+  if uptime >= rp.window {
+    rp.consecutive = 0
+  }
+  if rp.maxRestarts > 0 && rp.consecutive >= rp.maxRestarts {
+    return 0, false
+  }
+
+  delay := rp.delay
+  for i := 0; i < rp.consecutive && delay < rp.delayMax; i++ {
+    delay *= 2
+  }
+  if delay > rp.delayMax {
+    delay = rp.delayMax
+  }
+  rp.consecutive++
+  return delay, true
+}
+
+/*
+  A clean exit is either a zero exit code or termination by one of the signals used to ask a process to shut down,
+  this mirrors what systemd considers a successful exit for its on-failure policy
+*/
+func isCleanExit(state *os.ProcessState) bool {
+  if state == nil {
+    return false
+  }
+  if state.Success() {
+    return true
+  }
+  if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+    switch status.Signal() {
+    case syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGPIPE:
+      return true
+    }
+  }
+  return false
+}
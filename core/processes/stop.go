@@ -0,0 +1,190 @@
+package processes
+
+import (
+  "fmt"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "io/ioutil"
+  "os"
+  "strconv"
+  "strings"
+  "syscall"
+  "time"
+)
+
+const (
+  DEFAULT_STOP_TIMEOUT  = 10
+  KILL_TIMEOUT          = 5 * time.Second
+  STOP_POLL_INTERVAL    = 100 * time.Millisecond
+  STOP_REQUEST_FILE_EXT = ".stop"
+  RESTART_FILE_EXT      = ".restart"
+)
+
+/*
+  Returned when one or more processes could not be stopped
+*/
+type StopError struct {
+  Errors []error
+}
+
+func (e *StopError) Error() string {
+  var msgs []string
+  for _, err := range e.Errors {
+    msgs = append(msgs, err.Error())
+  }
+  return strings.Join(msgs, "; ")
+}
+
+/*
+  Stop all processes started by this process manager, in reverse dependency order
+  Every process is stopped even if stopping one of them fails
+*/
+func (pm *ProcessManager) StopProcesses() error {
+  pm.mutex.Lock()
+  processMap := make(map[string]*os.Process, len(pm.processMap))
+  for id, process := range pm.processMap {
+    processMap[id] = process
+  }
+  pm.mutex.Unlock()
+
+  var errs []error
+  sortedConfigs := pm.GetSortedProcessConfigs()
+  for i := len(sortedConfigs) - 1; i >= 0; i-- {
+    config := sortedConfigs[i]
+    if process, exists := processMap[config.Id]; exists {
+      if err := pm.stopProcess(config, process.Pid); err != nil {
+        fmt.Println("Error:", err)
+        errs = append(errs, err)
+      }
+    }
+  }
+
+  if len(errs) > 0 {
+    return &StopError{errs}
+  }
+  return nil
+}
+
+/*
+  Stop a process by name, the process doesn't have to be started by this process manager
+*/
+func (pm *ProcessManager) KillProcess(processName string) error {
+  config, exists := pm.getProcessConfig(processName)
+  if !exists {
+    return fmt.Errorf("unknown process %s", processName)
+  }
+
+  pid, err := pm.getPidFromPidFile(config.PidFilename)
+  if err == nil {
+    return pm.stopProcess(config, pid)
+  }
+
+  // a process that is waiting to be restarted is stopped by keeping it from being restarted
+  exitedPid, err := pm.getPidFromPidFile(config.PidFilename + RESTART_FILE_EXT)
+  if err != nil {
+    fmt.Println("Process", processName, "is not running")
+    return nil
+  }
+  fmt.Println("Process", processName, "is waiting to be restarted, it will not be restarted")
+  pm.requestStop(config, exitedPid)
+  // it may have been restarted just before the request was made
+  if pid, err := pm.getPidFromPidFile(config.PidFilename); err == nil {
+    return pm.stopProcess(config, pid)
+  }
+  return nil
+}
+
+/*
+  Signal the process group with SIGTERM, escalating to SIGKILL if it doesn't exit within the stop timeout
+  The pid file is only removed once the process group is gone
+*/
+func (pm *ProcessManager) stopProcess(config configs.ProcessConfig, pid int) error {
+  fmt.Println(fmt.Sprintf("Stopping process %v with pid: %v ...", config.Id, pid))
+  pm.requestStop(config, pid)
+
+  // send SIGTERM to the process group
+  if err := syscall.Kill(-pid, syscall.SIGTERM); err != nil {
+    if err == syscall.ESRCH {
+      // already gone, the pid file is stale
+      pm.removePidFile(config.PidFilename)
+      return nil
+    }
+    return fmt.Errorf("failed to stop %s (pid %d): %v", config.Id, pid, err)
+  }
+
+  stopTimeout := time.Duration(config.StopTimeout) * time.Second
+  if stopTimeout <= 0 {
+    stopTimeout = DEFAULT_STOP_TIMEOUT * time.Second
+  }
+  if !waitForProcessGroupExit(pid, stopTimeout) {
+    fmt.Printf("Process %s did not exit within %v, sending SIGKILL\n", config.Id, stopTimeout)
+    if err := syscall.Kill(-pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+      return fmt.Errorf("failed to kill %s (pid %d): %v", config.Id, pid, err)
+    }
+    if !waitForProcessGroupExit(pid, KILL_TIMEOUT) {
+      return fmt.Errorf("%s (pid %d) is still running after SIGKILL", config.Id, pid)
+    }
+  }
+
+  pm.removePidFile(config.PidFilename)
+  return nil
+}
+
+/*
+  Polls the process group until none of its processes exist anymore, returns false if the timeout is reached first
+*/
+func waitForProcessGroupExit(pgid int, timeout time.Duration) bool {
+  deadline := time.Now().Add(timeout)
+  for {
+    // note that sending the null signal is essentially a "dry-run"; no
+    // signals are actually sent see kill(2) for more details
+    if err := syscall.Kill(-pgid, syscall.Signal(0)); err == syscall.ESRCH {
+      return true
+    }
+    if time.Now().After(deadline) {
+      return false
+    }
+    time.Sleep(STOP_POLL_INTERVAL)
+  }
+}
+
+/*
+  Mark the run of a process with pid as intentionally stopped so that it will not be restarted
+  The request is kept in a file next to the pid file, so that a process stopped by another mcli instance is not restarted either,
+  it names the pid so that only the run that was stopped consumes it, and not a run started right after the stop
+*/
+func (pm *ProcessManager) requestStop(config configs.ProcessConfig, pid int) {
+  err := ioutil.WriteFile(pm.getStopRequestFilePath(config), []byte(strconv.Itoa(pid)), 0644)
+  if err != nil {
+    fmt.Println("ProcessManager failed to record stop request for", config.Id, err)
+  }
+}
+
+/*
+  Clears the stop request of the run with pid, returns whether there was one
+  A request for another run is left in place for that run
+*/
+func (pm *ProcessManager) consumeStopRequest(config configs.ProcessConfig, pid int) bool {
+  content, err := ioutil.ReadFile(pm.getStopRequestFilePath(config))
+  if err != nil || string(content) != strconv.Itoa(pid) {
+    return false
+  }
+  return os.Remove(pm.getStopRequestFilePath(config)) == nil
+}
+
+/*
+  Record that the run of a process with pid exited and the process is waiting to be restarted, so that it can still be stopped
+*/
+func (pm *ProcessManager) markRestartPending(config configs.ProcessConfig, pid int) {
+  err := ioutil.WriteFile(pm.getPidFilePath(config.PidFilename+RESTART_FILE_EXT), []byte(strconv.Itoa(pid)), 0644)
+  if err != nil {
+    fmt.Println("ProcessManager failed to record the pending restart of", config.Id, err)
+  }
+}
+
+func (pm *ProcessManager) clearRestartPending(config configs.ProcessConfig) {
+  os.Remove(pm.getPidFilePath(config.PidFilename + RESTART_FILE_EXT))
+}
+
+func (pm *ProcessManager) getStopRequestFilePath(config configs.ProcessConfig) string {
+  return pm.getPidFilePath(config.PidFilename) + STOP_REQUEST_FILE_EXT
+}
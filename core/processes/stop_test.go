@@ -0,0 +1,79 @@
+package processes
+
+import (
+  "github.com/MarconiProtocol/cli/core/configs"
+  "os"
+  "path/filepath"
+  "testing"
+  "time"
+)
+
+func newTestProcessManager(t *testing.T, procConfigs ...configs.ProcessConfig) *ProcessManager {
+  pm := &ProcessManager{
+    processMap:      make(map[string]*os.Process),
+    processStatuses: make(map[string]*ProcessStatus),
+    externalWatches: make(map[string]int),
+    subscribers:     make(map[chan ProcessEvent]bool),
+  }
+  pm.InitProcessManager(t.TempDir(), configs.ProcessesConfig{Processes: procConfigs})
+  if err := os.MkdirAll(filepath.Join(pm.baseDir, PID_DIR), 0700); err != nil {
+    t.Fatal(err)
+  }
+  return pm
+}
+
+func TestStopRequestIsKeyedToThePid(t *testing.T) {
+  config := configs.ProcessConfig{Id: "test", PidFilename: "test.pid"}
+  pm := newTestProcessManager(t, config)
+
+  pm.requestStop(config, 100)
+  if pm.consumeStopRequest(config, 101) {
+    t.Fatal("a run took the stop request of another run")
+  }
+  if !pm.consumeStopRequest(config, 100) {
+    t.Fatal("the stopped run did not see its stop request")
+  }
+  if pm.consumeStopRequest(config, 100) {
+    t.Fatal("the stop request was not cleared")
+  }
+}
+
+func TestStartKeepsTheStopRequestOfAStoppedRun(t *testing.T) {
+  config := configs.ProcessConfig{
+    Id:            "test",
+    Command:       "sleep",
+    Arguments:     []string{"30"},
+    LogFilename:   "test.log",
+    PidFilename:   "test.pid",
+    RestartPolicy: RESTART_ALWAYS,
+  }
+  pm := newTestProcessManager(t, config)
+  defer pm.StopProcesses()
+
+  // the run that was stopped by a restart has not seen its stop request yet when the process is started again
+  stoppedPid := 1 << 22
+  pm.requestStop(config, stoppedPid)
+  if err := pm.StartProcesses([]string{config.Id}, false); err != nil {
+    t.Fatal(err)
+  }
+  if !pm.consumeStopRequest(config, stoppedPid) {
+    t.Fatal("starting the process again took the stop request of the stopped run")
+  }
+
+  pid, err := pm.getPidFromPidFile(config.PidFilename)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err := pm.KillProcess(config.Id); err != nil {
+    t.Fatal(err)
+  }
+  // the exit is recorded once the run is reaped
+  deadline := time.Now().Add(time.Second)
+  for pm.GetProcessRunningMap()[config.Id].LastExitStatus == "" && time.Now().Before(deadline) {
+    time.Sleep(10 * time.Millisecond)
+  }
+  status := pm.GetProcessRunningMap()[config.Id]
+  if status.Running || status.Crashes != 0 || status.Restarts != 0 {
+    t.Fatalf("expected pid %d to be stopped without being restarted, got %+v", pid, status)
+  }
+}
@@ -0,0 +1,226 @@
+package processes
+
+import (
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "time"
+)
+
+const (
+  PROC_DIR = "/proc"
+  // USER_HZ, the unit of the cpu times in /proc/<pid>/stat, is 100 on all architectures linux supports
+  CLOCK_TICKS_PER_SECOND = 100
+  CPU_SAMPLE_INTERVAL    = 500 * time.Millisecond
+)
+
+/*
+  Resource usage of a managed process and the other processes in its process group, read from /proc
+*/
+type ProcessUsage struct {
+  Id            string
+  Pid           int
+  PidFileExists bool
+  Running       bool
+  StaleReason   string        // set when the pid file exists but doesn't belong to a running managed process
+  CpuPercent    float64       // cpu usage of the process group, sampled over CPU_SAMPLE_INTERVAL
+  CpuTime       time.Duration // cpu time used by the process group
+  Rss           uint64        // resident memory in bytes of the process group
+  OpenFds       int           // open file descriptors of the process group, -1 if they couldn't be read
+  Threads       int
+  Uptime        time.Duration
+  Children      []int // pids of the other processes in the process group
+}
+
+/*
+  Subset of the fields of /proc/<pid>/stat, see proc(5)
+*/
+type procStat struct {
+  pid       int
+  state     string
+  pgrp      int
+  cpuTicks  uint64 // utime + stime
+  threads   int
+  startTime uint64 // clock ticks after boot
+  rssPages  uint64
+}
+
+/*
+  Returns the resource usage of all managed processes, in dependency order
+  Blocks for CPU_SAMPLE_INTERVAL to measure cpu usage
+*/
+func (pm *ProcessManager) GetProcessUsage() []ProcessUsage {
+  processConfigs := pm.GetSortedProcessConfigs()
+  usages := make([]ProcessUsage, len(processConfigs))
+
+  for i, config := range processConfigs {
+    usages[i] = ProcessUsage{Id: config.Id, OpenFds: -1}
+    pid, err := pm.getPidFromPidFile(config.PidFilename)
+    if err != nil {
+      if pm.checkPidFileExists(config.PidFilename) {
+        usages[i].PidFileExists = true
+        usages[i].StaleReason = fmt.Sprintf("pid file could not be read: %v", err)
+      }
+      continue
+    }
+    usages[i].PidFileExists = true
+    usages[i].Pid = pid
+  }
+
+  // sample cpu time of all process groups at once, so that status only has to wait once
+  before := make(map[int]uint64)
+  for _, usage := range usages {
+    if usage.Pid > 0 {
+      before[usage.Pid] = sumCpuTicks(readProcessGroup(usage.Pid))
+    }
+  }
+  if len(before) > 0 {
+    time.Sleep(CPU_SAMPLE_INTERVAL)
+  }
+
+  bootTime := readBootTime()
+  for i := range usages {
+    if usages[i].Pid > 0 {
+      fillProcessUsage(&usages[i], before[usages[i].Pid], bootTime)
+    }
+  }
+  return usages
+}
+
+func fillProcessUsage(usage *ProcessUsage, ticksBefore uint64, bootTime time.Time) {
+  leader, err := readProcStat(usage.Pid)
+  if err != nil {
+    usage.StaleReason = fmt.Sprintf("no process with pid %d", usage.Pid)
+    if orphans := readProcessGroup(usage.Pid); len(orphans) > 0 {
+      usage.StaleReason += fmt.Sprintf(", but %d processes of its process group are still running", len(orphans))
+    }
+    return
+  }
+  // processes are started in their own process group, a pid outside of its group was reused by another process
+  if leader.pgrp != usage.Pid {
+    usage.StaleReason = fmt.Sprintf("pid %d belongs to an unrelated process", usage.Pid)
+    return
+  }
+  if leader.state == "Z" {
+    usage.StaleReason = fmt.Sprintf("pid %d is a zombie process", usage.Pid)
+    return
+  }
+  usage.Running = true
+
+  group := readProcessGroup(usage.Pid)
+  ticks := sumCpuTicks(group)
+  if ticks > ticksBefore {
+    usage.CpuPercent = float64(ticks-ticksBefore) / CLOCK_TICKS_PER_SECOND / CPU_SAMPLE_INTERVAL.Seconds() * 100
+  }
+  usage.CpuTime = ticksToDuration(ticks)
+
+  usage.OpenFds = 0
+  for _, stat := range group {
+    usage.Rss += stat.rssPages * uint64(os.Getpagesize())
+    usage.Threads += stat.threads
+    if stat.pid != usage.Pid {
+      usage.Children = append(usage.Children, stat.pid)
+    }
+    if usage.OpenFds >= 0 {
+      if fds, err := ioutil.ReadDir(filepath.Join(PROC_DIR, strconv.Itoa(stat.pid), "fd")); err == nil {
+        usage.OpenFds += len(fds)
+      } else {
+        usage.OpenFds = -1
+      }
+    }
+  }
+
+  if !bootTime.IsZero() {
+    usage.Uptime = time.Since(bootTime.Add(ticksToDuration(leader.startTime))).Truncate(time.Second)
+  }
+}
+
+/*
+  Reads the stat of every process in the process group
+*/
+func readProcessGroup(pgid int) []procStat {
+  entries, err := ioutil.ReadDir(PROC_DIR)
+  if err != nil {
+    return nil
+  }
+
+  var group []procStat
+  for _, entry := range entries {
+    pid, err := strconv.Atoi(entry.Name())
+    if err != nil {
+      continue
+    }
+    // processes can exit while we are reading them
+    stat, err := readProcStat(pid)
+    if err == nil && stat.pgrp == pgid {
+      group = append(group, stat)
+    }
+  }
+  return group
+}
+
+func readProcStat(pid int) (procStat, error) {
+  content, err := ioutil.ReadFile(filepath.Join(PROC_DIR, strconv.Itoa(pid), "stat"))
+  if err != nil {
+    return procStat{}, err
+  }
+
+  // the command name is in parentheses and can contain spaces, the remaining fields start at field 3
+  data := string(content)
+  end := strings.LastIndex(data, ")")
+  if end < 0 {
+    return procStat{}, fmt.Errorf("malformed stat for pid %d", pid)
+  }
+  fields := strings.Fields(data[end+1:])
+  if len(fields) < 22 {
+    return procStat{}, fmt.Errorf("malformed stat for pid %d", pid)
+  }
+  field := func(n int) uint64 {
+    value, _ := strconv.ParseUint(fields[n-3], 10, 64)
+    return value
+  }
+
+  return procStat{
+    pid:       pid,
+    state:     fields[0],
+    pgrp:      int(field(5)),
+    cpuTicks:  field(14) + field(15),
+    threads:   int(field(20)),
+    startTime: field(22),
+    rssPages:  field(24),
+  }, nil
+}
+
+func sumCpuTicks(group []procStat) uint64 {
+  var ticks uint64
+  for _, stat := range group {
+    ticks += stat.cpuTicks
+  }
+  return ticks
+}
+
+func ticksToDuration(ticks uint64) time.Duration {
+  return time.Duration(ticks) * time.Second / CLOCK_TICKS_PER_SECOND
+}
+
+/*
+  Reads the boot time from /proc/stat, returns the zero time if it can't be read
+*/
+func readBootTime() time.Time {
+  content, err := ioutil.ReadFile(filepath.Join(PROC_DIR, "stat"))
+  if err != nil {
+    return time.Time{}
+  }
+  for _, line := range strings.Split(string(content), "\n") {
+    if strings.HasPrefix(line, "btime ") {
+      seconds, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, "btime ")), 10, 64)
+      if err == nil {
+        return time.Unix(seconds, 0)
+      }
+    }
+  }
+  return time.Time{}
+}
@@ -0,0 +1,104 @@
+package processes
+
+import (
+  "fmt"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "syscall"
+  "time"
+  "unsafe"
+)
+
+const (
+  // pidfd_open(2) has the same number on every architecture, it is available since linux 5.3
+  SYS_PIDFD_OPEN = 434
+
+  EXTERNAL_POLL_INTERVAL = 1 * time.Second
+)
+
+/*
+  Watch the processes that are already running when the process manager is initialized, they were started by
+  another mcli instance so they can't be waited on, their pid files are removed once they exit
+*/
+func (pm *ProcessManager) monitorAllProcesses() {
+  for _, config := range pm.processesConfig.Processes {
+    if pid, err := pm.getPidFromPidFile(config.PidFilename); err == nil {
+      pm.watchExternalProcess(config, pid)
+    }
+  }
+}
+
+/*
+  Watch a process that is not a child of this instance until it exits, at most once per process
+*/
+func (pm *ProcessManager) watchExternalProcess(config configs.ProcessConfig, pid int) {
+  pm.mutex.Lock()
+  // children of this instance are reaped by runProcess
+  if process, exists := pm.processMap[config.Id]; (exists && process.Pid == pid) || pm.externalWatches[config.Id] == pid {
+    pm.mutex.Unlock()
+    return
+  }
+  pm.externalWatches[config.Id] = pid
+  pm.mutex.Unlock()
+
+  go func() {
+    waitForExternalExit(pid)
+
+    pm.mutex.Lock()
+    if pm.externalWatches[config.Id] == pid {
+      delete(pm.externalWatches, config.Id)
+    }
+    pm.mutex.Unlock()
+
+    // the pid file may already belong to a new instance of the process
+    if current, err := pm.getPidFromPidFile(config.PidFilename); err == nil && current == pid {
+      pm.removePidFile(config.PidFilename)
+    }
+    pm.publish(ProcessEvent{
+      Id:         config.Id,
+      Type:       EVENT_EXITED,
+      Pid:        pid,
+      ExitCode:   -1,
+      ExitStatus: "unknown, not started by this instance",
+    })
+  }()
+}
+
+/*
+  Blocks until the process exits, using a pidfd if the kernel supports it and polling otherwise
+*/
+func waitForExternalExit(pid int) {
+  var readFds syscall.FdSet
+  bitsPerWord := 8 * int(unsafe.Sizeof(readFds.Bits[0]))
+  pidfd, _, errno := syscall.Syscall(SYS_PIDFD_OPEN, uintptr(pid), 0, 0)
+  if errno == 0 && int(pidfd) >= len(readFds.Bits)*bitsPerWord {
+    // select can't wait on descriptors past FD_SETSIZE
+    syscall.Close(int(pidfd))
+  } else if errno == 0 {
+    defer syscall.Close(int(pidfd))
+    // a pidfd becomes readable once the process exits
+    for {
+      readFds = syscall.FdSet{}
+      readFds.Bits[int(pidfd)/bitsPerWord] |= 1 << uint(int(pidfd)%bitsPerWord)
+      n, err := syscall.Select(int(pidfd)+1, &readFds, nil, nil, nil)
+      if err == syscall.EINTR {
+        continue
+      }
+      if err == nil && n > 0 {
+        return
+      }
+      fmt.Println("ProcessManager failed to wait on pidfd, polling instead:", err)
+      break
+    }
+  } else if errno == syscall.ESRCH {
+    return
+  }
+
+  for {
+    // note that sending the null signal is essentially a "dry-run"; no
+    // signals are actually sent see kill(2) for more details
+    if err := syscall.Kill(pid, syscall.Signal(0)); err == syscall.ESRCH {
+      return
+    }
+    time.Sleep(EXTERNAL_POLL_INTERVAL)
+  }
+}
@@ -0,0 +1,323 @@
+package reset
+
+import (
+  "fmt"
+  "github.com/MarconiProtocol/cli/core/mkey"
+  "github.com/MarconiProtocol/cli/core/processes"
+  "github.com/MarconiProtocol/cli/core/supervisor"
+  "io/ioutil"
+  "net"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+  "time"
+)
+
+const (
+  BACKUP_DIR         = "backup"
+  BACKUP_TIME_FORMAT = "2006-01-02T15:04:05"
+  ACCOUNTS_DIR       = "accounts"
+  CONFIGS_DIR        = "configs"
+  CHAIN_DATA_DIR     = "etc/meth/datadir"
+
+  KEEP_CHAIN = "chain"
+  KEEP_KEYS  = "keys"
+  KEEP_LOGS  = "logs"
+)
+
+// files kept by --keep, relative to the base dir
+var KEEP_PATHS = map[string][]string{
+  KEEP_CHAIN: {CHAIN_DATA_DIR},
+  KEEP_KEYS:  {relativePath(mkey.ACCOUNT_CHILD_DIR), relativePath(mkey.MARCONI_KEY_CHILD_DIR)},
+  KEEP_LOGS:  {processes.LOG_DIR},
+}
+
+// files that are never removed, they are part of the mcli release or are needed to restore a backup
+var PRESERVED_PATHS = []string{
+  CONFIGS_DIR,
+  BACKUP_DIR,
+  "EULA.txt",
+  "bin/mcli",
+  supervisor.SOCKET_PATH,
+}
+
+/*
+  A file that is backed up by a reset, it is moved into the backup if it is removed, and copied otherwise
+*/
+type BackupItem struct {
+  Path string
+  Move bool
+}
+
+/*
+  What a reset of the base dir does, all paths are relative to the base dir
+*/
+type Plan struct {
+  BaseDir   string
+  Timestamp string
+  Backups   []BackupItem
+  Removals  []string
+  Kept      []string
+}
+
+/*
+  Plans the removal of everything under the base dir that was not part of the mcli release, except for the files
+  of the keep selections, nothing is changed until the plan is executed
+*/
+func PlanReset(baseDir string, keep []string) (*Plan, error) {
+  protected := append([]string(nil), PRESERVED_PATHS...)
+  // the running mcli may not be named mcli
+  if executable, err := os.Executable(); err == nil {
+    if rel, err := filepath.Rel(baseDir, executable); err == nil && !strings.HasPrefix(rel, "..") {
+      protected = append(protected, rel)
+    }
+  }
+
+  plan := Plan{BaseDir: baseDir, Timestamp: time.Now().Format(BACKUP_TIME_FORMAT)}
+  keepAccounts := false
+  for _, selection := range keep {
+    paths, exists := KEEP_PATHS[selection]
+    if !exists {
+      return nil, fmt.Errorf("unknown keep selection %s, it should be one of %s", selection, strings.Join(GetKeepSelections(), ", "))
+    }
+    for _, path := range paths {
+      protected = append(protected, path)
+      plan.Kept = append(plan.Kept, path)
+      keepAccounts = keepAccounts || path == ACCOUNTS_DIR
+    }
+  }
+
+  if exists(filepath.Join(baseDir, CONFIGS_DIR)) {
+    plan.Backups = append(plan.Backups, BackupItem{CONFIGS_DIR, false})
+  }
+  if exists(filepath.Join(baseDir, ACCOUNTS_DIR)) {
+    plan.Backups = append(plan.Backups, BackupItem{ACCOUNTS_DIR, !keepAccounts})
+    // moved by the backup, so it doesn't need to be removed
+    protected = append(protected, ACCOUNTS_DIR)
+  }
+
+  removals, err := collectRemovals(baseDir, "", protected)
+  if err != nil {
+    return nil, err
+  }
+  plan.Removals = removals
+  return &plan, nil
+}
+
+/*
+  Backs up the credentials and configs, and only then removes the files of the plan
+*/
+func (p *Plan) Execute() error {
+  backupDir := p.GetBackupDir()
+  if len(p.Backups) > 0 {
+    if err := os.MkdirAll(backupDir, 0700); err != nil {
+      return fmt.Errorf("could not create folder %s: %v", backupDir, err)
+    }
+  }
+  for _, item := range p.Backups {
+    source := filepath.Join(p.BaseDir, item.Path)
+    destination := filepath.Join(backupDir, item.Path)
+    var err error
+    if item.Move {
+      err = os.Rename(source, destination)
+    } else {
+      err = copyTree(source, destination)
+    }
+    if err != nil {
+      return fmt.Errorf("could not back up %s, nothing was removed: %v", item.Path, err)
+    }
+  }
+
+  for _, path := range p.Removals {
+    if err := os.RemoveAll(filepath.Join(p.BaseDir, path)); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func (p *Plan) GetBackupDir() string {
+  return filepath.Join(p.BaseDir, BACKUP_DIR, p.Timestamp)
+}
+
+/*
+  Returns the timestamps of the backups in the base dir, oldest first
+*/
+func ListBackups(baseDir string) ([]string, error) {
+  files, err := ioutil.ReadDir(filepath.Join(baseDir, BACKUP_DIR))
+  if err != nil {
+    if os.IsNotExist(err) {
+      return nil, nil
+    }
+    return nil, err
+  }
+  var timestamps []string
+  for _, file := range files {
+    if _, err := time.Parse(BACKUP_TIME_FORMAT, file.Name()); err == nil && file.IsDir() {
+      timestamps = append(timestamps, file.Name())
+    }
+  }
+  sort.Strings(timestamps)
+  return timestamps, nil
+}
+
+/*
+  Puts the accounts and configs of a backup back in the base dir
+  The current accounts and configs are backed up first, the timestamp of that backup is returned
+*/
+func Restore(baseDir string, timestamp string) (string, error) {
+  if _, err := time.Parse(BACKUP_TIME_FORMAT, timestamp); err != nil {
+    return "", fmt.Errorf("invalid backup timestamp %s", timestamp)
+  }
+  if err := checkNothingRunning(baseDir); err != nil {
+    return "", err
+  }
+  backupDir := filepath.Join(baseDir, BACKUP_DIR, timestamp)
+  var items []string
+  for _, item := range []string{ACCOUNTS_DIR, CONFIGS_DIR} {
+    if exists(filepath.Join(backupDir, item)) {
+      items = append(items, item)
+    }
+  }
+  if len(items) == 0 {
+    return "", fmt.Errorf("no backup found at %s", backupDir)
+  }
+
+  current := time.Now().Format(BACKUP_TIME_FORMAT)
+  if current == timestamp {
+    // a backup made within the same second as the one being restored
+    time.Sleep(time.Second)
+    current = time.Now().Format(BACKUP_TIME_FORMAT)
+  }
+  currentDir := filepath.Join(baseDir, BACKUP_DIR, current)
+  for _, item := range items {
+    path := filepath.Join(baseDir, item)
+    if !exists(path) {
+      continue
+    }
+    if err := os.MkdirAll(currentDir, 0700); err != nil {
+      return "", fmt.Errorf("could not create folder %s: %v", currentDir, err)
+    }
+    if err := os.Rename(path, filepath.Join(currentDir, item)); err != nil {
+      return "", fmt.Errorf("could not back up the current %s: %v", item, err)
+    }
+  }
+
+  // copied so that the backup can be restored again
+  for _, item := range items {
+    if err := copyTree(filepath.Join(backupDir, item), filepath.Join(baseDir, item)); err != nil {
+      return current, fmt.Errorf("could not restore %s, the previous %s is in %s: %v", item, item, currentDir, err)
+    }
+  }
+  return current, nil
+}
+
+/*
+  Checks that neither the supervisor nor any of the managed processes are running, they would keep using the accounts
+  and configs that are replaced
+*/
+func checkNothingRunning(baseDir string) error {
+  if conn, err := net.DialTimeout("unix", supervisor.GetSocketPath(baseDir), supervisor.SOCKET_DIAL_TIMEOUT); err == nil {
+    conn.Close()
+    return fmt.Errorf("the supervisor is running, stop it before restoring a backup")
+  }
+  if ids := processes.Instance().GetLiveProcessIds(); len(ids) > 0 {
+    return fmt.Errorf("the processes %s are still running, stop them before restoring a backup", strings.Join(ids, ", "))
+  }
+  return nil
+}
+
+func GetKeepSelections() []string {
+  return []string{KEEP_CHAIN, KEEP_KEYS, KEEP_LOGS}
+}
+
+/*
+  Collects the files under dir that are not protected, a directory containing a protected file is descended into
+  instead of being removed
+*/
+func collectRemovals(baseDir string, dir string, protected []string) ([]string, error) {
+  files, err := ioutil.ReadDir(filepath.Join(baseDir, dir))
+  if err != nil {
+    return nil, fmt.Errorf("could not read from path %s: %v", filepath.Join(baseDir, dir), err)
+  }
+
+  var removals []string
+  for _, file := range files {
+    path := filepath.Join(dir, file.Name())
+    switch {
+    case isProtected(path, protected):
+    case file.IsDir() && containsProtected(path, protected):
+      nested, err := collectRemovals(baseDir, path, protected)
+      if err != nil {
+        return nil, err
+      }
+      removals = append(removals, nested...)
+    default:
+      removals = append(removals, path)
+    }
+  }
+  return removals, nil
+}
+
+func isProtected(path string, protected []string) bool {
+  for _, protectedPath := range protected {
+    if path == protectedPath {
+      return true
+    }
+  }
+  return false
+}
+
+func containsProtected(dir string, protected []string) bool {
+  for _, protectedPath := range protected {
+    if strings.HasPrefix(protectedPath, dir+string(filepath.Separator)) {
+      return true
+    }
+  }
+  return false
+}
+
+/*
+  Copies a file or directory tree, keeping permissions and symlinks
+*/
+func copyTree(source string, destination string) error {
+  return filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+    if err != nil {
+      return err
+    }
+    rel, err := filepath.Rel(source, path)
+    if err != nil {
+      return err
+    }
+    target := filepath.Join(destination, rel)
+
+    switch {
+    case info.IsDir():
+      return os.MkdirAll(target, info.Mode().Perm())
+    case info.Mode()&os.ModeSymlink != 0:
+      link, err := os.Readlink(path)
+      if err != nil {
+        return err
+      }
+      return os.Symlink(link, target)
+    case info.Mode().IsRegular():
+      content, err := ioutil.ReadFile(path)
+      if err != nil {
+        return err
+      }
+      return ioutil.WriteFile(target, content, info.Mode().Perm())
+    }
+    // sockets and other special files are not backed up
+    return nil
+  })
+}
+
+func exists(path string) bool {
+  _, err := os.Lstat(path)
+  return err == nil
+}
+
+func relativePath(childPath string) string {
+  return strings.TrimPrefix(filepath.Clean(childPath), "/")
+}
@@ -0,0 +1,46 @@
+package supervisor
+
+import (
+  "fmt"
+  "github.com/MarconiProtocol/cli/core/processes"
+  "net/http"
+)
+
+/*
+  RPC service controlling the processes managed by the supervisor
+*/
+type ProcessService struct{}
+
+/*
+  Start processes, blocks until they are ready
+*/
+func (s *ProcessService) StartRPC(r *http.Request, args *StartArgs, reply *EmptyReply) error {
+  for _, id := range args.Ids {
+    if !processes.Instance().ContainsId(id) {
+      return fmt.Errorf("unknown process %s", id)
+    }
+  }
+  // the supervisor outlives the request, so the processes are always supervised
+  return processes.Instance().StartProcesses(args.Ids, false)
+}
+
+func (s *ProcessService) StopRPC(r *http.Request, args *ProcessArgs, reply *EmptyReply) error {
+  return processes.Instance().KillProcess(args.Id)
+}
+
+func (s *ProcessService) RestartRPC(r *http.Request, args *ProcessArgs, reply *EmptyReply) error {
+  if err := processes.Instance().KillProcess(args.Id); err != nil {
+    return err
+  }
+  return processes.Instance().StartProcesses([]string{args.Id}, false)
+}
+
+func (s *ProcessService) ListRPC(r *http.Request, args *EmptyArgs, reply *ListReply) error {
+  reply.Statuses = processes.Instance().GetProcessRunningMap()
+  return nil
+}
+
+func (s *ProcessService) StatusRPC(r *http.Request, args *EmptyArgs, reply *StatusReply) error {
+  reply.Usages = processes.Instance().GetProcessUsage()
+  return nil
+}
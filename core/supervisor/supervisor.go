@@ -0,0 +1,206 @@
+package supervisor
+
+import (
+  "fmt"
+  "github.com/MarconiProtocol/cli/core/processes"
+  "github.com/MarconiProtocol/cli/core/systemd"
+  "github.com/gorilla/rpc/v2"
+  "github.com/gorilla/rpc/v2/json2"
+  "net"
+  "net/http"
+  "os"
+  "path/filepath"
+  "regexp"
+  "strconv"
+  "sync"
+  "time"
+)
+
+const (
+  SOCKET_PATH = "var/run/marconi/mcli.sock"
+  RPC_PATH    = "/rpc/supervisor"
+  LOGS_PATH   = "/logs"
+
+  SOCKET_DIAL_TIMEOUT = 1 * time.Second
+)
+
+/*
+  Long lived process manager that other mcli instances control through a unix socket
+*/
+type Supervisor struct {
+  listener net.Listener
+  mutex    sync.Mutex
+}
+
+var instance *Supervisor
+var once sync.Once
+
+func Instance() *Supervisor {
+  once.Do(func() {
+    instance = &Supervisor{}
+  })
+  return instance
+}
+
+func GetSocketPath(baseDir string) string {
+  return filepath.Join(baseDir, SOCKET_PATH)
+}
+
+/*
+  Listen on the control socket, requests are served once Serve is called
+*/
+func (s *Supervisor) Listen(baseDir string) error {
+  // the socket is created by systemd when socket activated
+  listener, err := systemd.ActivationListener()
+  if err != nil {
+    return err
+  }
+  if listener != nil {
+    s.mutex.Lock()
+    s.listener = listener
+    s.mutex.Unlock()
+    fmt.Println("Supervisor listening on socket passed by systemd", listener.Addr())
+    return nil
+  }
+
+  socketPath := GetSocketPath(baseDir)
+  if err := os.MkdirAll(filepath.Dir(socketPath), 0700); err != nil {
+    return err
+  }
+
+  // a socket left behind by a supervisor that didn't exit cleanly can be replaced, a live one can't
+  if conn, err := net.DialTimeout("unix", socketPath, SOCKET_DIAL_TIMEOUT); err == nil {
+    conn.Close()
+    return fmt.Errorf("a supervisor is already listening on %s", socketPath)
+  }
+  os.Remove(socketPath)
+
+  listener, err = net.Listen("unix", socketPath)
+  if err != nil {
+    return err
+  }
+  // only the user running the supervisor can control it
+  if err := os.Chmod(socketPath, 0600); err != nil {
+    listener.Close()
+    return err
+  }
+
+  s.mutex.Lock()
+  s.listener = listener
+  s.mutex.Unlock()
+  fmt.Println("Supervisor listening on", socketPath)
+  return nil
+}
+
+/*
+  Serve requests on the control socket until Close is called
+*/
+func (s *Supervisor) Serve() error {
+  s.mutex.Lock()
+  listener := s.listener
+  s.mutex.Unlock()
+  if listener == nil {
+    return fmt.Errorf("supervisor is not listening")
+  }
+
+  rpcServer := rpc.NewServer()
+  rpcServer.RegisterCodec(json2.NewCodec(), "application/json")
+  if err := rpcServer.RegisterService(new(ProcessService), "ProcessService"); err != nil {
+    return err
+  }
+
+  mux := http.NewServeMux()
+  mux.Handle(RPC_PATH, rpcServer)
+  mux.HandleFunc(LOGS_PATH, handleLogs)
+
+  err := http.Serve(listener, mux)
+
+  s.mutex.Lock()
+  defer s.mutex.Unlock()
+  if s.listener == nil {
+    // closed by Close
+    return nil
+  }
+  return err
+}
+
+/*
+  Stop serving requests and remove the control socket
+*/
+func (s *Supervisor) Close() {
+  s.mutex.Lock()
+  defer s.mutex.Unlock()
+
+  if s.listener != nil {
+    // closing a unix listener also removes its socket file
+    s.listener.Close()
+    s.listener = nil
+  }
+}
+
+/*
+  Streams the log of a process, the query parameters correspond to the options of the logs command
+*/
+func handleLogs(w http.ResponseWriter, r *http.Request) {
+  query := r.URL.Query()
+  id := query.Get("id")
+  if !processes.Instance().ContainsId(id) {
+    http.Error(w, "unknown process "+id, http.StatusNotFound)
+    return
+  }
+
+  options := processes.LogOptions{}
+  if lines := query.Get("lines"); lines != "" {
+    n, err := strconv.Atoi(lines)
+    if err != nil {
+      http.Error(w, "invalid lines: "+err.Error(), http.StatusBadRequest)
+      return
+    }
+    options.Lines = n
+  }
+  if pattern := query.Get("grep"); pattern != "" {
+    regex, err := regexp.Compile(pattern)
+    if err != nil {
+      http.Error(w, "invalid grep pattern: "+err.Error(), http.StatusBadRequest)
+      return
+    }
+    options.Pattern = regex
+  }
+  if since := query.Get("since"); since != "" {
+    seconds, err := strconv.ParseInt(since, 10, 64)
+    if err != nil {
+      http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+      return
+    }
+    options.Since = time.Unix(seconds, 0)
+  }
+  follow, _ := strconv.ParseBool(query.Get("follow"))
+
+  w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+  out := &flushWriter{w}
+  if err := processes.Instance().ShowLogs(id, options, out); err != nil {
+    fmt.Fprintln(out, "Error:", err)
+    if !follow {
+      return
+    }
+  }
+  if follow {
+    // following ends when the client goes away
+    processes.Instance().FollowLogs(id, options, out, r.Context().Done())
+  }
+}
+
+/*
+  Sends every write to the client right away
+*/
+type flushWriter struct {
+  w http.ResponseWriter
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+  n, err := fw.w.Write(p)
+  if flusher, ok := fw.w.(http.Flusher); ok {
+    flusher.Flush()
+  }
+  return n, err
+}
@@ -0,0 +1,25 @@
+package supervisor
+
+import (
+  "github.com/MarconiProtocol/cli/core/processes"
+)
+
+type StartArgs struct {
+  Ids []string
+}
+
+type ProcessArgs struct {
+  Id string
+}
+
+type EmptyArgs struct{}
+
+type EmptyReply struct{}
+
+type ListReply struct {
+  Statuses map[string]processes.ProcessStatus
+}
+
+type StatusReply struct {
+  Usages []processes.ProcessUsage
+}
@@ -0,0 +1,43 @@
+package systemd
+
+import (
+  "fmt"
+  "net"
+  "os"
+  "strconv"
+)
+
+const (
+  // first file descriptor passed by systemd, see sd_listen_fds(3)
+  LISTEN_FDS_START = 3
+)
+
+/*
+  Returns the listener passed by systemd socket activation, or nil if the process was not socket activated
+*/
+func ActivationListener() (net.Listener, error) {
+  pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+  if err != nil || pid != os.Getpid() {
+    return nil, nil
+  }
+  count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+  if err != nil || count < 1 {
+    return nil, nil
+  }
+  // child processes must not think they are socket activated as well
+  os.Unsetenv("LISTEN_PID")
+  os.Unsetenv("LISTEN_FDS")
+  os.Unsetenv("LISTEN_FDNAMES")
+
+  if count > 1 {
+    fmt.Printf("Socket activation passed %d sockets, only the first one is used\n", count)
+  }
+  file := os.NewFile(uintptr(LISTEN_FDS_START), "systemd-socket")
+  listener, err := net.FileListener(file)
+  // the listener has its own copy of the descriptor
+  file.Close()
+  if err != nil {
+    return nil, fmt.Errorf("failed to use the socket passed by systemd: %v", err)
+  }
+  return listener, nil
+}
@@ -0,0 +1,83 @@
+package systemd
+
+import (
+  "net"
+  "os"
+  "strconv"
+  "time"
+)
+
+const (
+  NOTIFY_READY    = "READY=1"
+  NOTIFY_STOPPING = "STOPPING=1"
+  NOTIFY_WATCHDOG = "WATCHDOG=1"
+)
+
+/*
+  Sends a state change to systemd as described in sd_notify(3), does nothing when not run by systemd
+  Returns whether the notification was sent
+*/
+func Notify(state string) (bool, error) {
+  socketPath := os.Getenv("NOTIFY_SOCKET")
+  if socketPath == "" {
+    return false, nil
+  }
+  // abstract socket
+  if socketPath[0] == '@' {
+    socketPath = "\x00" + socketPath[1:]
+  }
+
+  conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+  if err != nil {
+    return false, err
+  }
+  defer conn.Close()
+
+  if _, err := conn.Write([]byte(state)); err != nil {
+    return false, err
+  }
+  return true, nil
+}
+
+/*
+  Status shown by systemctl status
+*/
+func NotifyStatus(status string) (bool, error) {
+  return Notify("STATUS=" + status)
+}
+
+/*
+  Returns the interval at which systemd expects a keep-alive, 0 if the watchdog is disabled
+*/
+func WatchdogInterval() time.Duration {
+  usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+  if err != nil || usec <= 0 {
+    return 0
+  }
+  // the watchdog is meant for this process only
+  if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+    return 0
+  }
+  return time.Duration(usec) * time.Microsecond
+}
+
+/*
+  Sends keep-alives to the systemd watchdog at half its interval until stop is closed, if the watchdog is enabled
+*/
+func RunWatchdog(stop <-chan struct{}) {
+  interval := WatchdogInterval()
+  if interval == 0 {
+    return
+  }
+
+  ticker := time.NewTicker(interval / 2)
+  defer ticker.Stop()
+  for {
+    select {
+    case <-stop:
+      return
+    case <-ticker.C:
+      Notify(NOTIFY_WATCHDOG)
+    }
+  }
+}
@@ -0,0 +1,275 @@
+package systemd
+
+import (
+  "fmt"
+  "github.com/MarconiProtocol/cli/core/configs"
+  "github.com/MarconiProtocol/cli/core/processes"
+  "io/ioutil"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "sort"
+  "strings"
+)
+
+const (
+  UNIT_PREFIX          = "marconi-"
+  SUPERVISOR_UNIT_NAME = "mcli-supervisor"
+)
+
+/*
+  A rendered unit file
+*/
+type Unit struct {
+  Name    string
+  Content string
+}
+
+func GetUnitName(id string) string {
+  return UNIT_PREFIX + id + ".service"
+}
+
+/*
+  Renders a service unit for every managed process, so that systemd manages the processes instead of mcli
+*/
+func RenderProcessUnits(baseDir string, processConfigs []configs.ProcessConfig) ([]Unit, error) {
+  var units []Unit
+  for _, config := range processConfigs {
+    unit, err := renderProcessUnit(baseDir, config)
+    if err != nil {
+      return nil, err
+    }
+    units = append(units, unit)
+  }
+  return units, nil
+}
+
+func renderProcessUnit(baseDir string, config configs.ProcessConfig) (Unit, error) {
+  workingDir := filepath.Join(baseDir, config.Dir)
+  command := config.Command
+  // systemd requires an absolute path, commands are run from the process dir, or found on the PATH if they are only a
+  // name, the same as the process manager runs them
+  if !filepath.IsAbs(command) && strings.Contains(command, "/") {
+    command = filepath.Join(workingDir, command)
+  } else if !filepath.IsAbs(command) {
+    resolved, err := exec.LookPath(command)
+    if err == nil {
+      resolved, err = filepath.Abs(resolved)
+    }
+    if err != nil {
+      return Unit{}, fmt.Errorf("failed to resolve the command %s of process %s to an absolute path: %v", command, config.Id, err)
+    }
+    command = resolved
+  }
+  execStart := []string{quoteArgument(command)}
+  for _, argument := range config.Arguments {
+    execStart = append(execStart, quoteArgument(argument))
+  }
+  logPath := filepath.Join(baseDir, processes.LOG_DIR, config.LogFilename)
+
+  var b strings.Builder
+  fmt.Fprintln(&b, "[Unit]")
+  fmt.Fprintf(&b, "Description=Marconi %s\n", config.Id)
+  after := []string{"network.target"}
+  var requires []string
+  for _, dependency := range config.Dependencies {
+    after = append(after, GetUnitName(dependency))
+    requires = append(requires, GetUnitName(dependency))
+  }
+  fmt.Fprintf(&b, "After=%s\n", strings.Join(after, " "))
+  if len(requires) > 0 {
+    fmt.Fprintf(&b, "Requires=%s\n", strings.Join(requires, " "))
+  }
+  if config.MaxRestarts > 0 {
+    window := config.RestartWindow
+    if window <= 0 {
+      window = processes.DEFAULT_RESTART_WINDOW
+    }
+    fmt.Fprintf(&b, "StartLimitIntervalSec=%d\n", window)
+    fmt.Fprintf(&b, "StartLimitBurst=%d\n", config.MaxRestarts)
+  }
+
+  fmt.Fprintln(&b)
+  fmt.Fprintln(&b, "[Service]")
+  if config.WaitForCompletion {
+    fmt.Fprintln(&b, "Type=oneshot")
+    fmt.Fprintln(&b, "RemainAfterExit=yes")
+  } else {
+    fmt.Fprintln(&b, "Type=simple")
+  }
+  fmt.Fprintf(&b, "WorkingDirectory=%s\n", workingDir)
+  fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(execStart, " "))
+  fmt.Fprintf(&b, "StandardOutput=append:%s\n", logPath)
+  fmt.Fprintf(&b, "StandardError=append:%s\n", logPath)
+  if !config.WaitForCompletion {
+    fmt.Fprintf(&b, "Restart=%s\n", getRestartSetting(config.RestartPolicy))
+    if config.RestartDelay > 0 {
+      fmt.Fprintf(&b, "RestartSec=%d\n", config.RestartDelay)
+    }
+  }
+  stopTimeout := config.StopTimeout
+  if stopTimeout <= 0 {
+    stopTimeout = processes.DEFAULT_STOP_TIMEOUT
+  }
+  fmt.Fprintln(&b, "KillMode=control-group")
+  fmt.Fprintf(&b, "TimeoutStopSec=%d\n", stopTimeout)
+  writeProcessEnvironment(&b, baseDir, config)
+
+  fmt.Fprintln(&b)
+  fmt.Fprintln(&b, "[Install]")
+  fmt.Fprintln(&b, "WantedBy=multi-user.target")
+
+  return Unit{GetUnitName(config.Id), b.String()}, nil
+}
+
+/*
+  Writes the environment, user, umask, resource limits and cgroup caps of the process as service settings
+*/
+func writeProcessEnvironment(b *strings.Builder, baseDir string, config configs.ProcessConfig) {
+  if config.EnvFile != "" {
+    envFile := config.EnvFile
+    if !filepath.IsAbs(envFile) {
+      envFile = filepath.Join(baseDir, envFile)
+    }
+    fmt.Fprintf(b, "EnvironmentFile=%s\n", envFile)
+  }
+  var keys []string
+  for key := range config.Env {
+    keys = append(keys, key)
+  }
+  sort.Strings(keys)
+  for _, key := range keys {
+    fmt.Fprintf(b, "Environment=%s\n", quoteEnvironment(key+"="+config.Env[key]))
+  }
+  if config.User != "" {
+    fmt.Fprintf(b, "User=%s\n", config.User)
+  }
+  if config.Group != "" {
+    fmt.Fprintf(b, "Group=%s\n", config.Group)
+  }
+  if config.Umask != "" {
+    fmt.Fprintf(b, "UMask=%s\n", config.Umask)
+  }
+  if config.Limits != nil {
+    if config.Limits.OpenFiles != nil {
+      fmt.Fprintf(b, "LimitNOFILE=%s\n", getLimitSetting(*config.Limits.OpenFiles))
+    }
+    if config.Limits.CoreSize != nil {
+      fmt.Fprintf(b, "LimitCORE=%s\n", getLimitSetting(*config.Limits.CoreSize))
+    }
+  }
+  if config.Cgroup != nil {
+    if config.Cgroup.CpuPercent > 0 {
+      fmt.Fprintf(b, "CPUQuota=%d%%\n", config.Cgroup.CpuPercent)
+    }
+    if config.Cgroup.CpuWeight > 0 {
+      fmt.Fprintf(b, "CPUWeight=%d\n", config.Cgroup.CpuWeight)
+    }
+    if config.Cgroup.MemoryMax > 0 {
+      fmt.Fprintf(b, "MemoryMax=%dM\n", config.Cgroup.MemoryMax)
+    }
+    if config.Cgroup.MemoryHigh > 0 {
+      fmt.Fprintf(b, "MemoryHigh=%dM\n", config.Cgroup.MemoryHigh)
+    }
+  }
+}
+
+/*
+  Renders a service unit running mcli as supervisor, and a socket unit for its control socket,
+  so that systemd supervises mcli which manages the processes
+*/
+func RenderSupervisorUnits(baseDir string, mcliPath string, socketPath string) []Unit {
+  var service strings.Builder
+  fmt.Fprintln(&service, "[Unit]")
+  fmt.Fprintln(&service, "Description=Marconi mCLI supervisor")
+  fmt.Fprintln(&service, "After=network.target")
+  fmt.Fprintf(&service, "Requires=%s.socket\n", SUPERVISOR_UNIT_NAME)
+  fmt.Fprintln(&service)
+  fmt.Fprintln(&service, "[Service]")
+  // mcli reports when all processes are ready
+  fmt.Fprintln(&service, "Type=notify")
+  fmt.Fprintln(&service, "NotifyAccess=main")
+  fmt.Fprintf(&service, "WorkingDirectory=%s\n", baseDir)
+  fmt.Fprintf(&service, "ExecStart=%s -mode supervisor -basedir %s\n", quoteArgument(mcliPath), quoteArgument(baseDir))
+  fmt.Fprintln(&service, "Restart=on-failure")
+  fmt.Fprintln(&service, "RestartSec=5")
+  // starting waits for all processes to be ready
+  fmt.Fprintln(&service, "TimeoutStartSec=300")
+  // give mcli time to stop the processes itself
+  fmt.Fprintln(&service, "TimeoutStopSec=60")
+  fmt.Fprintln(&service, "WatchdogSec=30")
+  fmt.Fprintln(&service)
+  fmt.Fprintln(&service, "[Install]")
+  fmt.Fprintln(&service, "WantedBy=multi-user.target")
+
+  var socket strings.Builder
+  fmt.Fprintln(&socket, "[Unit]")
+  fmt.Fprintln(&socket, "Description=Marconi mCLI supervisor control socket")
+  fmt.Fprintln(&socket)
+  fmt.Fprintln(&socket, "[Socket]")
+  fmt.Fprintf(&socket, "ListenStream=%s\n", socketPath)
+  fmt.Fprintln(&socket, "SocketMode=0600")
+  fmt.Fprintln(&socket)
+  fmt.Fprintln(&socket, "[Install]")
+  fmt.Fprintln(&socket, "WantedBy=sockets.target")
+
+  return []Unit{
+    {SUPERVISOR_UNIT_NAME + ".service", service.String()},
+    {SUPERVISOR_UNIT_NAME + ".socket", socket.String()},
+  }
+}
+
+/*
+  Writes the units to dir, which is created if it doesn't exist
+*/
+func WriteUnits(dir string, units []Unit) error {
+  if err := os.MkdirAll(dir, 0755); err != nil {
+    return err
+  }
+  for _, unit := range units {
+    if err := ioutil.WriteFile(filepath.Join(dir, unit.Name), []byte(unit.Content), 0644); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+/*
+  Maps a restart policy of processes_conf.json to the Restart setting of systemd
+*/
+func getRestartSetting(policy string) string {
+  if policy == "" || policy == processes.RESTART_NEVER {
+    return "no"
+  }
+  // on-failure and always mean the same in both
+  return policy
+}
+
+/*
+  Maps a resource limit of processes_conf.json to a Limit setting of systemd, -1 is unlimited
+*/
+func getLimitSetting(value int64) string {
+  if value < 0 {
+    return "infinity"
+  }
+  return fmt.Sprintf("%d", value)
+}
+
+/*
+  Quotes an assignment of the Environment setting, variables are not expanded there but specifiers are
+*/
+func quoteEnvironment(assignment string) string {
+  replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `%`, `%%`)
+  return `"` + replacer.Replace(assignment) + `"`
+}
+
+/*
+  Quotes an argument of a systemd command line if needed, see systemd.service(5)
+*/
+func quoteArgument(argument string) string {
+  if argument != "" && !strings.ContainsAny(argument, " \t\"'\\$%;") {
+    return argument
+  }
+  replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`, `%`, `%%`)
+  return `"` + replacer.Replace(argument) + `"`
+}
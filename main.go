@@ -8,27 +8,41 @@ import (
   "github.com/MarconiProtocol/cli/console/execution"
   "github.com/MarconiProtocol/cli/console/modes/credentials"
   "github.com/MarconiProtocol/cli/console/modes/marconi_net"
+  "github.com/MarconiProtocol/cli/console/modes/package_manager"
+  "github.com/MarconiProtocol/cli/console/modes/process"
   "github.com/MarconiProtocol/cli/console/modes/process/commands"
   "github.com/MarconiProtocol/cli/console/util"
   "github.com/MarconiProtocol/cli/core"
   "github.com/MarconiProtocol/cli/core/configs"
   "github.com/MarconiProtocol/cli/core/packages"
+  "github.com/MarconiProtocol/cli/core/processes"
   mlog "github.com/MarconiProtocol/log"
   "os"
   "os/signal"
+  "strconv"
   "strings"
   "syscall"
 )
 
 const (
-  MODE_EXEC      = "exec"
-  MODE_NODE      = "node"
-  MODE_UPGRADE   = "upgrade"
-  MODE_DAEMON    = "daemon"
-  LOG_CHILD_PATH = "/var/log/marconi"
+  MODE_EXEC       = "exec"
+  MODE_NODE       = "node"
+  MODE_UPGRADE    = "upgrade"
+  MODE_DAEMON     = "daemon"
+  MODE_SUPERVISOR = "supervisor"
+  LOG_CHILD_PATH  = "/var/log/marconi"
 )
 
 func main() {
+  // mcli starts itself to execute processes with their umask and resource limits, and to rotate the logs of
+  // processes started in the background, nothing else may run before
+  if len(os.Args) > 1 && os.Args[1] == processes.EXEC_WRAPPER_ARG {
+    processes.RunExecWrapper(os.Args[2:])
+  }
+  if len(os.Args) > 1 && os.Args[1] == processes.LOG_WRITER_ARG {
+    processes.RunLogWriter(os.Args[2:])
+  }
+
   mode := flag.String("mode", "node", "The mode Marconi Client will launch in")
   baseDir := flag.String("basedir", "/opt/marconi", "Base of directory tree that will "+
     "be used to store all configs and data files related to Marconi components, including "+
@@ -38,7 +52,18 @@ func main() {
   processStop := flag.String("stop", "", "Stop a running process")
   processRestart := flag.String("restart", "", "Restart a running process")
   processList := flag.Bool("list", false, "List running processes")
+  processLogs := flag.String("logs", "", "Show the log of a process")
+  logLines := flag.Int("lines", process_commands.DEFAULT_LOG_LINES, "Number of most recent log lines to show, used with -logs")
+  logFollow := flag.Bool("follow", false, "Keep showing log lines as they are logged, used with -logs")
+  logGrep := flag.String("grep", "", "Only show log lines matching the regular expression, used with -logs")
+  logSince := flag.String("since", "", "Only show log lines logged within the duration, ie. 30m, used with -logs")
   readCommandsFromStdin := flag.Bool("read-commands-from-stdin", false, "Whether to read commands from stdin")
+  autostart := flag.Bool("autostart", true, "Start all processes when the supervisor starts, used with supervisor mode")
+  validateConfig := flag.Bool("validate", false, "Validate the processes config and exit, used with daemon mode")
+  bundle := flag.String("bundle", "", "Install and upgrade the packages from a bundle made with package bundle, "+
+    "instead of downloading them, used with upgrade mode")
+  acceptEula := flag.String("accept-eula", os.Getenv(packages.ACCEPT_EULA_ENV), "Comma separated SHA-256 digests of "+
+    "the EULAs of mcli and the packages to accept without asking, defaults to $"+packages.ACCEPT_EULA_ENV)
 
   flag.Parse()
   configs.SetBaseDir(*baseDir)
@@ -51,11 +76,35 @@ func main() {
   osIntChan := make(chan os.Signal, 1)
   signal.Notify(osIntChan, syscall.SIGINT, syscall.SIGKILL, syscall.SIGTERM)
   go func() {
-    <-osIntChan
-    core.Cleanup()
-    os.Exit(1)
+    for {
+      sig := <-osIntChan
+      // Ctrl-C stops commands such as following a log, instead of exiting
+      if sig == syscall.SIGINT && util.HandleInterrupt() {
+        continue
+      }
+      core.Cleanup()
+      // being stopped is how the supervisor is meant to exit, ie. by systemctl stop
+      if *mode == MODE_SUPERVISOR {
+        os.Exit(0)
+      }
+      os.Exit(1)
+    }
   }()
 
+  // Validation is meant to be run unattended (ie. in CI) so it happens before asking for the EULA acknowledgement
+  if *mode == MODE_DAEMON && *validateConfig {
+    if err := core.ValidateProcessesConf(*baseDir); err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+    fmt.Println("Processes config is valid")
+    return
+  }
+
+  if err := packages.Instance().AcceptEulas(*acceptEula); err != nil {
+    fmt.Fprintln(os.Stderr, err)
+    os.Exit(1)
+  }
   if !packages.CheckOrAskForMcliEulaAcknowledgement(*baseDir) {
     os.Exit(1)
   }
@@ -67,7 +116,7 @@ func main() {
     core.Bootstrap(*baseDir)
 
     // Load the managed processes config
-    core.StartProcessManager(*baseDir)
+    startProcessManager(*baseDir)
 
     go console.LaunchREPL(signal, true, *readCommandsFromStdin)
 
@@ -75,7 +124,7 @@ func main() {
     <-signal
 
   case MODE_DAEMON:
-    core.StartProcessManager(*baseDir)
+    startProcessManager(*baseDir)
 
     var processName string
     var mode string
@@ -100,29 +149,60 @@ func main() {
       argumentCount++
     }
 
+    if *processLogs != "" {
+      argumentCount++
+    }
+
     if argumentCount != 1 {
-      fmt.Println("Only one of -start, -stop, -restart, -list can be specified at once")
+      fmt.Println("Only one of -start, -stop, -restart, -list, -logs can be specified at once")
       return
     }
 
     if *processList {
       console.ListProcesses()
+    } else if *processLogs != "" {
+      logArgs := []string{"-n", strconv.Itoa(*logLines)}
+      if *logFollow {
+        logArgs = append(logArgs, "-f")
+      }
+      if *logGrep != "" {
+        logArgs = append(logArgs, "-grep", *logGrep)
+      }
+      if *logSince != "" {
+        logArgs = append(logArgs, "-since", *logSince)
+      }
+      console.ShowProcessLogs(*processLogs, logArgs)
     } else {
       console.LaunchProcess(mode, processName)
     }
 
+  case MODE_SUPERVISOR:
+    startProcessManager(*baseDir)
+
+    // Blocks until the supervisor is stopped by a signal
+    if err := core.RunSupervisor(*baseDir, *autostart); err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+
   case MODE_UPGRADE:
     // NO-OP, nothing more to do than bootstrap
-    core.Bootstrap(*baseDir)
+    if *bundle != "" {
+      core.BootstrapFromBundle(*baseDir, *bundle)
+    } else {
+      core.Bootstrap(*baseDir)
+    }
 
   case MODE_EXEC:
-    core.StartProcessManager(*baseDir)
+    startProcessManager(*baseDir)
 
     context := context.NewContext()
 
     // Register Modes onto the context
     context.RegisterMode(credentials.NewCredsMode(context), "Credential Mode")
     context.RegisterMode(marconi_net.NewMarconiNetMode(context), "Marconi Net Mode")
+    context.RegisterMode(process.NewProcessMode(context), "Process Mode")
+    context.RegisterMode(package_manager.NewPackageMode(context), "Package Mode")
 
     execMode := execution.NewExecMode(context)
 
@@ -142,3 +222,13 @@ func main() {
     os.Exit(1)
   }
 }
+
+/*
+  Load the managed processes config and start the process manager, exits if the config is invalid
+*/
+func startProcessManager(baseDir string) {
+  if err := core.StartProcessManager(baseDir); err != nil {
+    fmt.Fprintln(os.Stderr, err)
+    os.Exit(1)
+  }
+}